@@ -1,16 +1,128 @@
 package config
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type APIConfig struct {
-	Environment       string
+	Environment string
+	// AppMode is "api" (HTTP server, the default) or "worker" (renders jobs pulled from Redis)
+	AppMode string
+	// RenderBackend is "local" (render in the API process) or "redis" (hand renders to workers)
+	RenderBackend     string
+	RedisURL          string
 	ElevenLabsAPIKey  string
 	ElevenLabsBaseURL string
+	// ElevenLabsModelID is the TTS model; phoneme tags from lexicons only work on models that support them
+	ElevenLabsModelID string
+	// Generator writes compositions: "n8n" (the N8N webhooks), "openai" (an OpenAI-compatible
+	// chat completions endpoint with structured output against CompositionSchema) or "rules"
+	// (deterministic, no network). Every generator's output is checked against CompositionSchema.
+	Generator         string
+	CompositionSchema string
+	OpenAIBaseURL     string
+	OpenAIAPIKey      string
+	OpenAIModel       string
 	N8NPLEXELSURL     string
 	N8NREELSURL       string
 	N8NAPIKey         string
-	ShortVideoBaseURL string
-	Port              string
+	// N8NSigningSecret signs requests to n8n (HMAC-SHA256 of timestamp and body) and verifies its
+	// callbacks. With N8NCallbackURL (the public URL of /api/n8n/callback) set, async reel requests
+	// do not wait on n8n: it posts the composition there later, or the job fails after N8NCallbackTimeout.
+	N8NSigningSecret   string
+	N8NCallbackURL     string
+	N8NCallbackTimeout time.Duration
+	ShortVideoBaseURL  string
+	Port               string
+	// AdminAddr is the internal listener for runtime and janitor counters (/debug/vars); it
+	// defaults to localhost so the counters never reach the public port. "off" disables it.
+	AdminAddr string
+	// RenderOutputDir stages kept renders until they are moved to storage
+	RenderOutputDir string
+	// DataDir holds persistent app data (brand kits, ...)
+	DataDir string
+	// UploadDir is the root for per-request upload workspaces
+	UploadDir string
+	// StorageBackend is "local" (files under StorageDir, served at /files) or "s3" (any
+	// S3-compatible endpoint such as MinIO). Kept render outputs and their inputs live there.
+	StorageBackend string
+	StorageDir     string
+	// StorageURLSecret signs local download URLs; StorageURLTTL is how long handed-out URLs work
+	StorageURLSecret string
+	StorageURLTTL    time.Duration
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	// S3PathStyle addresses objects as endpoint/bucket/key (MinIO) instead of bucket.endpoint/key
+	S3PathStyle bool
+	// Upload limits; pixel limits reject decompression bombs before decoding
+	MaxRequestBytes   int64
+	MaxUploadBytes    int64
+	MaxImagePixels    int64
+	MaxImageDimension int
+	// Ingestion: transparent images are flattened onto IngestBackground and
+	// images are downscaled to cover at most IngestMaxCanvas x IngestMaxCanvas
+	IngestBackground string
+	IngestMaxCanvas  int
+	// Render scheduling: concurrent ffmpeg jobs and how many may wait behind them. With the
+	// redis backend RenderConcurrency on the API caps jobs in flight across all workers, and on
+	// a worker it is that worker's number of parallel renders.
+	RenderConcurrency int
+	RenderQueueSize   int
+	// Job priority is decided server-side: users in UserPriorities ("<user id>=high,<user id>=low",
+	// matched case-insensitively against X-User-ID, which the gateway in front of the API sets) get
+	// their tier, everyone else JobPriority. Clients may ask for less than that, never for more.
+	JobPriority    string
+	UserPriorities map[string]string
+	// Per-stage timeouts; N8NTimeout bounds any composition generator call, JobTimeout bounds a whole render job including TTS and every ffmpeg run
+	N8NTimeout    time.Duration
+	TTSTimeout    time.Duration
+	FFmpegTimeout time.Duration
+	JobTimeout    time.Duration
+	// JobMaxAttempts caps how often a job interrupted by a restart is started again
+	JobMaxAttempts int
+	// ShutdownTimeout is how long in-flight renders may run after SIGTERM before they are killed
+	ShutdownTimeout time.Duration
+	// TTS cache: narration audio is reused for identical text and voice settings. Entries expire
+	// after TTSCacheTTL (0 never) and the oldest are dropped above TTSCacheMaxBytes (0 disables the cache).
+	TTSCacheDir      string
+	TTSCacheTTL      time.Duration
+	TTSCacheMaxBytes int64
+	// ElevenLabs client limits: TTSTimeout applies per attempt, failed attempts caused by rate
+	// limits or server errors are retried up to TTSMaxRetries times with exponential backoff from
+	// TTSRetryBaseDelay, and at most TTSRatePerMinute requests (0 unlimited) and TTSMaxConcurrent
+	// calls are in flight at once, leaving headroom under the subscription's concurrency limit.
+	TTSMaxRetries     int
+	TTSRetryBaseDelay time.Duration
+	TTSRatePerMinute  int
+	TTSMaxConcurrent  int
+	// Janitor: how often it runs and how long each kind of file is kept (0 keeps forever).
+	// Uploads covers request workspaces and stored render inputs, Outputs the videos, captions
+	// and narration of finished jobs, Previews their thumbnails, previews, proxies and contact sheets.
+	JanitorInterval   time.Duration
+	RetentionUploads  time.Duration
+	RetentionTTS      time.Duration
+	RetentionOutputs  time.Duration
+	RetentionPreviews time.Duration
+	// Disk usage (percent) above DiskHighWater evicts the oldest files until usage is below DiskLowWater
+	DiskHighWater int
+	DiskLowWater  int
+	// Localization: Translator is "dictionary" (TranslationDictionary, a JSON file of
+	// {"<lang>": {"<source text>": "<translation>"}}) or "libretranslate" (TranslateURL);
+	// unset turns localization off.
+	// TTSVoices picks the narration voice per language ("en=<voice id>,es=<voice id>").
+	Translator            string
+	TranslationDictionary string
+	TranslateURL          string
+	TranslateAPIKey       string
+	TTSVoices             map[string]string
 }
 
 func LoadAPIConfig() *APIConfig {
@@ -26,21 +138,130 @@ func LoadAPIConfig() *APIConfig {
 	}
 
 	return &APIConfig{
-		Environment: env,
+		Environment:   env,
+		AppMode:       getEnvOrDefault("APP_MODE", "api"),
+		RenderBackend: getEnvOrDefault("RENDER_BACKEND", "local"),
+		RedisURL:      getEnvOrDefault("REDIS_URL", "redis://localhost:6379/0"),
 		//using the mary voice id: spanish, young BITCH!
-		ElevenLabsAPIKey:  getEnvOrDefault("ELEVENLABS_API_KEY", "sk_c78e929e9d436804555d72838e56b279d994faf76151a3b6"),
-		ElevenLabsBaseURL: getEnvOrDefault("ELEVENLABS_BASE_URL", "https://api.elevenlabs.io/v1"),
-		N8NPLEXELSURL:     N8NPLEXELSURL,
-		N8NREELSURL:       N8NREELSURL,
-		N8NAPIKey:         getEnvOrDefault("N8N_API_KEY", "n8n_api_key_here"),
-		ShortVideoBaseURL: getEnvOrDefault("SHORT_VIDEO_BASE_URL", "http://34.66.33.115:3123"),
-		Port:              getEnvOrDefault("PORT", "8080"),
+		ElevenLabsAPIKey:   getEnvOrDefault("ELEVENLABS_API_KEY", "sk_c78e929e9d436804555d72838e56b279d994faf76151a3b6"),
+		ElevenLabsBaseURL:  getEnvOrDefault("ELEVENLABS_BASE_URL", "https://api.elevenlabs.io/v1"),
+		ElevenLabsModelID:  getEnvOrDefault("ELEVENLABS_MODEL_ID", "eleven_multilingual_v2"),
+		Generator:          getEnvOrDefault("GENERATOR", "n8n"),
+		CompositionSchema:  getEnvOrDefault("COMPOSITION_SCHEMA", "./schema/video_composition.json"),
+		OpenAIBaseURL:      getEnvOrDefault("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		OpenAIAPIKey:       os.Getenv("OPENAI_API_KEY"),
+		OpenAIModel:        getEnvOrDefault("OPENAI_MODEL", "gpt-4o-mini"),
+		N8NPLEXELSURL:      N8NPLEXELSURL,
+		N8NREELSURL:        N8NREELSURL,
+		N8NAPIKey:          os.Getenv("N8N_API_KEY"),
+		N8NSigningSecret:   os.Getenv("N8N_SIGNING_SECRET"),
+		N8NCallbackURL:     os.Getenv("N8N_CALLBACK_URL"),
+		N8NCallbackTimeout: getEnvDurationOrDefault("N8N_CALLBACK_TIMEOUT", 30*time.Minute),
+		ShortVideoBaseURL:  getEnvOrDefault("SHORT_VIDEO_BASE_URL", "http://34.66.33.115:3123"),
+		Port:               getEnvOrDefault("PORT", "8080"),
+		AdminAddr:          getEnvOrDefault("ADMIN_ADDR", "127.0.0.1:6060"),
+		RenderOutputDir:    getEnvOrDefault("RENDER_OUTPUT_DIR", "./tmp/renders"),
+		DataDir:            getEnvOrDefault("DATA_DIR", "./data"),
+		UploadDir:          getEnvOrDefault("UPLOAD_DIR", filepath.Join(os.TempDir(), "reels_uploads")),
+		StorageBackend:     getEnvOrDefault("STORAGE_BACKEND", "local"),
+		StorageDir:         getEnvOrDefault("STORAGE_DIR", "./data/storage"),
+		StorageURLSecret:   os.Getenv("STORAGE_URL_SECRET"),
+		StorageURLTTL:      getEnvDurationOrDefault("STORAGE_URL_TTL", time.Hour),
+		S3Endpoint:         getEnvOrDefault("S3_ENDPOINT", "http://localhost:9000"),
+		S3Region:           getEnvOrDefault("S3_REGION", "us-east-1"),
+		S3Bucket:           os.Getenv("S3_BUCKET"),
+		S3AccessKey:        os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:        os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle:        getEnvOrDefault("S3_PATH_STYLE", "true") != "false",
+		MaxRequestBytes:    getEnvInt64OrDefault("MAX_REQUEST_BYTES", 200<<20),
+		MaxUploadBytes:     getEnvInt64OrDefault("MAX_UPLOAD_BYTES", 25<<20),
+		MaxImagePixels:     getEnvInt64OrDefault("MAX_IMAGE_PIXELS", 50_000_000),
+		MaxImageDimension:  int(getEnvInt64OrDefault("MAX_IMAGE_DIMENSION", 12000)),
+		IngestBackground:   getEnvOrDefault("INGEST_BACKGROUND", "#FFFFFF"),
+		IngestMaxCanvas:    int(getEnvInt64OrDefault("INGEST_MAX_CANVAS", 1920)),
+		RenderConcurrency:  int(getEnvInt64OrDefault("RENDER_CONCURRENCY", int64(defaultRenderConcurrency()))),
+		RenderQueueSize:    int(getEnvInt64OrDefault("RENDER_QUEUE_SIZE", 16)),
+		JobPriority:        getEnvOrDefault("JOB_PRIORITY", "normal"),
+		UserPriorities:     getEnvMapOrDefault("USER_PRIORITIES", ""),
+		N8NTimeout:         getEnvDurationOrDefault("N8N_TIMEOUT", 2*time.Minute),
+		TTSTimeout:         getEnvDurationOrDefault("TTS_TIMEOUT", time.Minute),
+		FFmpegTimeout:      getEnvDurationOrDefault("FFMPEG_TIMEOUT", 10*time.Minute),
+		JobTimeout:         getEnvDurationOrDefault("JOB_TIMEOUT", 15*time.Minute),
+		ShutdownTimeout:    getEnvDurationOrDefault("SHUTDOWN_TIMEOUT", 2*time.Minute),
+		JobMaxAttempts:     int(getEnvInt64OrDefault("JOB_MAX_ATTEMPTS", 2)),
+		TTSCacheDir:        getEnvOrDefault("TTS_CACHE_DIR", "./data/tts_cache"),
+		TTSCacheTTL:        getEnvRetentionOrDefault("TTS_CACHE_TTL", 30*24*time.Hour),
+		TTSCacheMaxBytes:   getEnvInt64OrDefault("TTS_CACHE_MAX_BYTES", 1<<30),
+		TTSMaxRetries:      int(getEnvInt64OrDefault("TTS_MAX_RETRIES", 3)),
+		TTSRetryBaseDelay:  getEnvDurationOrDefault("TTS_RETRY_BASE_DELAY", 500*time.Millisecond),
+		TTSRatePerMinute:   int(getEnvInt64OrDefault("TTS_RATE_PER_MINUTE", 60)),
+		TTSMaxConcurrent:   int(getEnvInt64OrDefault("TTS_MAX_CONCURRENT", 2)),
+		JanitorInterval:    getEnvDurationOrDefault("JANITOR_INTERVAL", 10*time.Minute),
+		RetentionUploads:   getEnvRetentionOrDefault("RETENTION_UPLOADS", 24*time.Hour),
+		RetentionTTS:       getEnvRetentionOrDefault("RETENTION_TTS", time.Hour),
+		RetentionOutputs:   getEnvRetentionOrDefault("RETENTION_OUTPUTS", 7*24*time.Hour),
+		RetentionPreviews:  getEnvRetentionOrDefault("RETENTION_PREVIEWS", 3*24*time.Hour),
+		DiskHighWater:      int(getEnvInt64OrDefault("DISK_HIGH_WATER", 90)),
+		DiskLowWater:       int(getEnvInt64OrDefault("DISK_LOW_WATER", 80)),
+		Translator:         os.Getenv("TRANSLATOR"),
+		// relative to DATA_DIR unless absolute
+		TranslationDictionary: getEnvOrDefault("TRANSLATION_DICTIONARY", "translations.json"),
+		TranslateURL:          getEnvOrDefault("TRANSLATE_URL", "http://localhost:5000"),
+		TranslateAPIKey:       os.Getenv("TRANSLATE_API_KEY"),
+		TTSVoices:             getEnvMapOrDefault("TTS_VOICES", "en=21m00Tcm4TlvDq8ikWAM,es=tvWD4i07Hg5L4uEvbxYV"),
 	}
 }
 
+// defaultRenderConcurrency leaves room for ffmpeg's own threading: one job per two cores
+func defaultRenderConcurrency() int {
+	if n := runtime.NumCPU() / 2; n > 1 {
+		return n
+	}
+	return 1
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt64OrDefault(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDurationOrDefault parses Go durations such as "90s" or "5m"
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvRetentionOrDefault is getEnvDurationOrDefault that also accepts "0" (keep forever)
+func getEnvRetentionOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if os.Getenv(key) == "0" {
+		return 0
+	}
+	return getEnvDurationOrDefault(key, defaultValue)
+}
+
+// getEnvMapOrDefault parses comma-separated key=value pairs; keys are lowercased
+func getEnvMapOrDefault(key, defaultValue string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(getEnvOrDefault(key, defaultValue), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if k, v = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v); ok && k != "" && v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
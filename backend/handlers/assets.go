@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"social-media-ai-video/config"
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssetHandler exposes the asset library. Assets belong to the X-User-ID they were uploaded
+// under (anonymous callers share one namespace) and are invisible to everybody else.
+type AssetHandler struct {
+	cfg      *config.APIConfig
+	library  *services.AssetLibrary
+	ingestor *services.ImageIngestor
+}
+
+func NewAssetHandler(cfg *config.APIConfig, library *services.AssetLibrary) *AssetHandler {
+	return &AssetHandler{cfg: cfg, library: library, ingestor: services.NewImageIngestor(cfg)}
+}
+
+// UploadAssets accepts multipart "image" files plus optional "tags" (comma-separated/repeated).
+// Content the user already uploaded is not stored again; its existing asset is returned with created=false.
+func (ah *AssetHandler) UploadAssets(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ah.cfg.MaxRequestBytes)
+	form, err := c.MultipartForm()
+	if err != nil || form == nil {
+		status := http.StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"status": "error", "error": "invalid multipart form"})
+		return
+	}
+	files := form.File["image"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "at least one image is required (field name: image)"})
+		return
+	}
+	tags, err := services.NormalizeTags(splitList(form.Value["tags"]))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+
+	ws, err := services.NewWorkspace(ah.cfg.UploadDir, services.UploadLimitsFromConfig(ah.cfg))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	defer ws.Cleanup()
+
+	results := make([]gin.H, 0, len(files))
+	anyCreated := false
+	for _, fh := range files {
+		path, err := ws.SaveUpload(fh)
+		var info models.ImageInfo
+		if err == nil {
+			// make sure the image decodes and learn its real dimensions; the original is what gets stored
+			_, info, err = ah.ingestor.Normalize(c.Request.Context(), ws, path, "")
+		}
+		if err != nil {
+			c.JSON(uploadErrorStatus(err), gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		asset, created, err := ah.library.Add(c.Request.Context(), userID, fh.Filename, path, info, tags)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		signed, err := ah.library.Sign(*asset, ah.cfg.StorageURLTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		anyCreated = anyCreated || created
+		results = append(results, gin.H{"asset": signed, "created": created})
+	}
+
+	status := http.StatusOK
+	if anyCreated {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"status": "ok", "assets": results})
+}
+
+// ListAssets returns the caller's assets, newest first. Query: tag, limit (default 50, max 200).
+func (ah *AssetHandler) ListAssets(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": fmt.Sprintf("invalid limit %q", raw)})
+			return
+		}
+		limit = min(n, 200)
+	}
+	assets, err := ah.library.List(userID, strings.ToLower(strings.TrimSpace(c.Query("tag"))), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	signed := make([]models.Asset, len(assets))
+	for i, a := range assets {
+		if signed[i], err = ah.library.Sign(a, ah.cfg.StorageURLTTL); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "assets": signed})
+}
+
+func (ah *AssetHandler) GetAsset(c *gin.Context) {
+	asset, ok := ah.lookup(c)
+	if !ok {
+		return
+	}
+	ah.respond(c, asset)
+}
+
+// SetAssetTags replaces the tags from a JSON body {"tags": [...]}
+func (ah *AssetHandler) SetAssetTags(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "invalid JSON body"})
+		return
+	}
+	asset, err := ah.library.SetTags(userID, c.Param("id"), body.Tags)
+	if err != nil {
+		c.JSON(assetErrorStatus(err), gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	ah.respond(c, asset)
+}
+
+func (ah *AssetHandler) DeleteAsset(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if err := ah.library.Delete(c.Request.Context(), userID, c.Param("id")); err != nil {
+		c.JSON(assetErrorStatus(err), gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (ah *AssetHandler) lookup(c *gin.Context) (*models.Asset, bool) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return nil, false
+	}
+	asset, err := ah.library.Get(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(assetErrorStatus(err), gin.H{"status": "error", "error": err.Error()})
+		return nil, false
+	}
+	return asset, true
+}
+
+func (ah *AssetHandler) respond(c *gin.Context, asset *models.Asset) {
+	signed, err := ah.library.Sign(*asset, ah.cfg.StorageURLTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "asset": signed})
+}
+
+func assetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAssetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTags):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BrandKitHandler struct {
+	store *services.BrandKitStore
+}
+
+func NewBrandKitHandler(store *services.BrandKitStore) *BrandKitHandler {
+	return &BrandKitHandler{store: store}
+}
+
+// allowed logo formats, keyed by sniffed content type
+var logoExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+// CreateBrandKit accepts multipart/form-data with the kit fields and an optional "logo" file.
+// The kit belongs to the X-User-ID caller; other users cannot see, use or delete it.
+func (bh *BrandKitHandler) CreateBrandKit(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if !strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"status": "error", "error": "Content-Type must be multipart/form-data"})
+		return
+	}
+
+	kit := models.BrandKit{
+		Name:           strings.TrimSpace(c.PostForm("name")),
+		PrimaryColor:   strings.TrimSpace(c.PostForm("primary_color")),
+		SecondaryColor: strings.TrimSpace(c.PostForm("secondary_color")),
+		Fonts: models.BrandFonts{
+			Heading: strings.TrimSpace(c.PostForm("heading_font")),
+			Body:    strings.TrimSpace(c.PostForm("body_font")),
+		},
+		Watermark: models.Watermark{
+			Position: models.WatermarkPosition(strings.TrimSpace(c.PostForm("watermark_position"))),
+		},
+		IntroText: strings.TrimSpace(c.PostForm("intro_text")),
+		OutroText: strings.TrimSpace(c.PostForm("outro_text")),
+		CTA:       strings.TrimSpace(c.PostForm("cta")),
+	}
+	for field, dst := range map[string]*float64{
+		"watermark_opacity": &kit.Watermark.Opacity,
+		"watermark_scale":   &kit.Watermark.Scale,
+		"end_card_duration": &kit.EndCardDuration,
+	} {
+		if raw := strings.TrimSpace(c.PostForm(field)); raw != "" {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": fmt.Sprintf("invalid %s: %q", field, raw)})
+				return
+			}
+			*dst = v
+		}
+	}
+
+	var created *models.BrandKit
+	fh, err := c.FormFile("logo")
+	if err == nil {
+		src, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to open uploaded logo: %v", err)})
+			return
+		}
+		defer src.Close()
+
+		head := make([]byte, 512)
+		n, _ := src.Read(head)
+		ext, ok := logoExtensions[http.DetectContentType(head[:n])]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "logo must be a PNG, JPEG or WebP image"})
+			return
+		}
+		if _, err := src.Seek(0, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to read uploaded logo: %v", err)})
+			return
+		}
+		created, err = bh.store.Create(userID, kit, src, ext)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+	} else {
+		created, err = bh.store.Create(userID, kit, nil, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": "ok", "brandKit": created})
+}
+
+func (bh *BrandKitHandler) ListBrandKits(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	kits, err := bh.store.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "brandKits": kits})
+}
+
+func (bh *BrandKitHandler) GetBrandKit(c *gin.Context) {
+	kit, ok := bh.lookup(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "brandKit": kit})
+}
+
+func (bh *BrandKitHandler) GetBrandKitLogo(c *gin.Context) {
+	kit, ok := bh.lookup(c)
+	if !ok {
+		return
+	}
+	logo := bh.store.LogoPath(kit)
+	if logo == "" {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "error": "brand kit has no logo"})
+		return
+	}
+	c.File(logo)
+}
+
+func (bh *BrandKitHandler) DeleteBrandKit(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if err := bh.store.Delete(userID, c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrBrandKitNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// lookup returns the caller's kit named by the id param; on failure it has already responded
+func (bh *BrandKitHandler) lookup(c *gin.Context) (*models.BrandKit, bool) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return nil, false
+	}
+	kit, err := bh.store.Get(userID, c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrBrandKitNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error()})
+		return nil, false
+	}
+	return kit, true
+}
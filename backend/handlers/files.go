@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileHandler serves objects of the local storage backend through their signed URLs
+type FileHandler struct {
+	storage *services.LocalStorage
+}
+
+func NewFileHandler(storage *services.LocalStorage) *FileHandler {
+	return &FileHandler{storage: storage}
+}
+
+// GetFile serves /files/<key>?expires=...&signature=...; Range requests work for video scrubbing
+func (fh *FileHandler) GetFile(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	path, err := fh.storage.Verify(key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "error": "file not found"})
+		return
+	}
+	c.File(path)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-media-ai-video/config"
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	cfg       *config.APIConfig
+	scheduler *services.RenderScheduler
+	storage   services.Storage
+}
+
+func NewJobHandler(cfg *config.APIConfig, scheduler *services.RenderScheduler, storage services.Storage) *JobHandler {
+	return &JobHandler{cfg: cfg, scheduler: scheduler, storage: storage}
+}
+
+// ListJobs returns the job history of the user in X-User-ID, newest first.
+// Query: status (generating, queued, running, succeeded, failed, canceled), limit (default 50, max 200).
+func (jh *JobHandler) ListJobs(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err == nil && userID == "" {
+		err = fmt.Errorf("X-User-ID header is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+
+	status := models.JobStatus(c.Query("status"))
+	switch status {
+	case "", models.JobGenerating, models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobFailed, models.JobCanceled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": fmt.Sprintf("invalid status %q", status)})
+		return
+	}
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": fmt.Sprintf("invalid limit %q", raw)})
+			return
+		}
+		limit = min(n, 200)
+	}
+
+	jobs, err := jh.scheduler.History(userID, status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if jobs == nil {
+		jobs = []models.RenderJob{}
+	}
+	for i := range jobs {
+		if jobs[i], err = signedJob(jh.storage, jh.cfg.StorageURLTTL, jobs[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "jobs": jobs})
+}
+
+// GetJob reports a render job's status, queue position and, once finished, its result. Jobs
+// submitted under an X-User-ID are only found by that user.
+func (jh *JobHandler) GetJob(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	job, err := jh.scheduler.Get(c.Param("id"))
+	if err == nil && job.UserID != "" && job.UserID != userID {
+		err = services.ErrJobNotFound
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if job, err = signedJob(jh.storage, jh.cfg.StorageURLTTL, job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "job": job})
+}
+
+// CancelJob stops a queued or running job; ffmpeg is killed and its temp files removed. Like
+// GetJob, only the submitting user finds the job.
+func (jh *JobHandler) CancelJob(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	job, err := jh.scheduler.Get(c.Param("id"))
+	if err == nil && job.UserID != "" && job.UserID != userID {
+		job, err = models.RenderJob{}, services.ErrJobNotFound
+	}
+	if err == nil {
+		job, err = jh.scheduler.Cancel(job.ID)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrJobFinished):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error(), "job": job})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "job": job})
+}
+
+// signedJob fills fresh download URLs, valid for ttl, into a finished job's artifacts
+func signedJob(storage services.Storage, ttl time.Duration, job models.RenderJob) (models.RenderJob, error) {
+	result, err := services.SignResult(storage, job.Result, ttl)
+	job.Result = result
+	return job, err
+}
+
+// userIDFromHeader returns the caller's X-User-ID (empty when absent)
+func userIDFromHeader(c *gin.Context) (string, error) {
+	id := strings.TrimSpace(c.GetHeader("X-User-ID"))
+	if len(id) > 128 || strings.ContainsAny(id, "\x00\x01") {
+		return "", fmt.Errorf("invalid X-User-ID header")
+	}
+	return id, nil
+}
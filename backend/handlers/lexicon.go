@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LexiconHandler manages the caller's (X-User-ID) pronunciation lexicon, applied to the
+// narration of every render they submit afterwards
+type LexiconHandler struct {
+	store *services.LexiconStore
+}
+
+func NewLexiconHandler(store *services.LexiconStore) *LexiconHandler {
+	return &LexiconHandler{store: store}
+}
+
+func (lh *LexiconHandler) GetLexicon(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	lex, err := lh.store.Get(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "lexicon": lex})
+}
+
+// PutLexicon replaces the lexicon with a JSON body {"entries": [{"word", "alias", "phoneme", "alphabet"}]}
+func (lh *LexiconHandler) PutLexicon(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	var body struct {
+		Entries []models.LexiconEntry `json:"entries"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	lex, err := lh.store.Put(userID, body.Entries)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidLexicon) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "lexicon": lex})
+}
+
+func (lh *LexiconHandler) DeleteLexicon(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if err := lh.store.Delete(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
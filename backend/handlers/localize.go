@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLocalizeLanguages bounds one localize batch
+const maxLocalizeLanguages = 10
+
+// LocalizedJob is one render of a localize batch
+type LocalizedJob struct {
+	Language string           `json:"language"`
+	Voice    string           `json:"voiceId,omitempty"`
+	Job      models.RenderJob `json:"job"`
+}
+
+// LocalizeJob renders a stored job's composition again in other languages, one async job per
+// language. JSON body: {"languages": ["es", "fr"], "source": "en", "priority": "normal"};
+// priority is capped at the user's tier (see jobPriority) and source defaults to the job's own
+// language, else "en". The job's inputs must still be available (kept renders keep them until
+// RETENTION_UPLOADS).
+func (vh *VideoHandler) LocalizeJob(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	job, src, err := vh.scheduler.Task(c.Param("id"))
+	if err == nil && job.UserID != "" && job.UserID != userID {
+		err = services.ErrJobNotFound
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+
+	var body struct {
+		Languages []string           `json:"languages"`
+		Source    string             `json:"source"`
+		Priority  models.JobPriority `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	languages, source, err := localizeLanguages(body.Languages, body.Source, src.Options.Language)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	priority, err := vh.jobPriority(userID, body.Priority)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if job.Status == models.JobGenerating {
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "error": fmt.Sprintf("job %s has no composition yet", job.ID)})
+		return
+	}
+	if !src.HasInputs() {
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "error": fmt.Sprintf("the input images of job %s are no longer available", job.ID)})
+		return
+	}
+	lex, err := vh.lexicons.Get(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	src.Options.Lexicon = lex.Entries
+
+	// prepare every language before queueing any, so a bad translation fails the whole batch
+	ctx := c.Request.Context()
+	tasks := make([]services.RenderTask, 0, len(languages))
+	workspaces := make([]*services.Workspace, 0, len(languages))
+	defer func() {
+		for _, ws := range workspaces {
+			ws.Cleanup()
+		}
+	}()
+	for _, lang := range languages {
+		ws, err := services.NewWorkspace(vh.cfg.UploadDir, services.UploadLimitsFromConfig(vh.cfg))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		workspaces = append(workspaces, ws)
+		task, err := vh.localizer.Task(ctx, vh.storage, src, source, lang, ws)
+		if err != nil {
+			vh.dropStoredInputs(tasks)
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, services.ErrLocalizationDisabled):
+				status = http.StatusNotImplemented
+			case errors.Is(err, services.ErrUntranslatable):
+				status = http.StatusUnprocessableEntity
+			}
+			c.JSON(status, gin.H{"status": "error", "error": fmt.Sprintf("localize %s: %v", lang, err)})
+			return
+		}
+		tasks = append(tasks, task)
+	}
+
+	batch := make([]LocalizedJob, 0, len(tasks))
+	for i, task := range tasks {
+		job, err := vh.scheduler.Submit(task, priority, userID)
+		if err != nil {
+			// all or nothing: take back what was already queued
+			for _, done := range batch {
+				vh.scheduler.Cancel(done.Job.ID)
+			}
+			vh.dropStoredInputs(tasks[i:])
+			vh.rejectJob(c, err)
+			return
+		}
+		// the job now owns the workspace
+		workspaces[i].Detach()
+		batch = append(batch, LocalizedJob{Language: task.Options.Language, Voice: task.Options.VoiceID, Job: job})
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "ok", "source": source, "jobs": batch})
+}
+
+// localizeLanguages validates and dedupes the target languages and resolves the source language
+func localizeLanguages(targets []string, source, fallback string) ([]string, string, error) {
+	if source == "" {
+		source = fallback
+	}
+	if source == "" {
+		source = "en"
+	}
+	source, err := services.NormalizeLanguage(source)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(targets) == 0 || len(targets) > maxLocalizeLanguages {
+		return nil, "", fmt.Errorf("languages must list 1 to %d languages", maxLocalizeLanguages)
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, lang := range targets {
+		lang, err := services.NormalizeLanguage(lang)
+		if err != nil {
+			return nil, "", err
+		}
+		if !seen[lang] {
+			seen[lang] = true
+			out = append(out, lang)
+		}
+	}
+	return out, source, nil
+}
+
+// dropStoredInputs deletes the stored inputs of tasks that never made it into the queue
+func (vh *VideoHandler) dropStoredInputs(tasks []services.RenderTask) {
+	for _, task := range tasks {
+		for _, key := range task.ImageKeys {
+			vh.storage.Delete(context.Background(), key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"social-media-ai-video/config"
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCallbackBytes bounds a callback body; compositions are a few kilobytes
+const maxCallbackBytes = 4 << 20
+
+// N8NCallbackHandler receives compositions n8n generated for held jobs
+type N8NCallbackHandler struct {
+	cfg       *config.APIConfig
+	scheduler *services.RenderScheduler
+	schema    *services.JSONSchema
+}
+
+func NewN8NCallbackHandler(cfg *config.APIConfig, scheduler *services.RenderScheduler, schema *services.JSONSchema) *N8NCallbackHandler {
+	return &N8NCallbackHandler{cfg: cfg, scheduler: scheduler, schema: schema}
+}
+
+// Callback takes a signed JSON body {"jobId", "composition"} and queues the job's render, or
+// {"jobId", "error"} and fails it. A composition that breaks the schema or does not decode
+// fails the job too.
+func (nh *N8NCallbackHandler) Callback(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCallbackBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"status": "error", "error": "callback body too large"})
+		return
+	}
+	if err := services.VerifyWebhook(nh.cfg.N8NSigningSecret, c.Request.Header, body, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	var payload struct {
+		JobID       string          `json:"jobId"`
+		Composition json.RawMessage `json:"composition"`
+		Error       string          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.JobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "expected a JSON body with jobId"})
+		return
+	}
+
+	// a reported error is delivered fine; an unusable composition is rejected as well
+	var genErr, invalid error
+	switch {
+	case payload.Error != "":
+		genErr = fmt.Errorf("composition generation failed: %s", payload.Error)
+	case len(payload.Composition) == 0 || string(payload.Composition) == "null":
+		invalid = fmt.Errorf("callback carried no composition")
+	default:
+		if err := nh.schema.ValidateComposition(payload.Composition); err != nil {
+			invalid = err
+		} else if _, err := services.ParseComposition(payload.Composition); err != nil {
+			invalid = err
+		}
+	}
+	if invalid != nil {
+		genErr = invalid
+	}
+
+	var job models.RenderJob
+	if genErr != nil {
+		job, err = nh.scheduler.FailGeneration(payload.JobID, genErr)
+	} else {
+		job, err = nh.scheduler.Release(payload.JobID, payload.Composition)
+	}
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "error": err.Error()})
+	case errors.Is(err, services.ErrNotGenerating):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "error": err.Error(), "job": job})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+	case invalid != nil:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": "error", "error": invalid.Error(), "job": job})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "job": job})
+	}
+}
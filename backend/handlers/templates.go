@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TemplateHandler struct {
+	registry *services.TemplateRegistry
+}
+
+func NewTemplateHandler(registry *services.TemplateRegistry) *TemplateHandler {
+	return &TemplateHandler{registry: registry}
+}
+
+func (th *TemplateHandler) ListTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "templates": th.registry.List()})
+}
+
+func (th *TemplateHandler) GetTemplate(c *gin.Context) {
+	t, err := th.registry.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "template": t})
+}
+
+// GenerateFromTemplate fills a template with the uploaded images (or asset_id assets) and renders it.
+// Slot text comes from "slot_<name>" fields (e.g. slot_hook, slot_story[0], slot_cta); when a
+// "prompt" is given, slots left empty are written by the AI generator. All render options of
+// /generate-video-reels apply.
+func (vh *VideoHandler) GenerateFromTemplate(c *gin.Context) {
+	if !strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"status": "error", "error": "Content-Type must be multipart/form-data"})
+		return
+	}
+
+	tpl, err := vh.templates.Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrTemplateNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, vh.cfg.MaxRequestBytes)
+	form, err := c.MultipartForm()
+	if err != nil || form == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "invalid multipart form"})
+		return
+	}
+	renderOpts, err := parseRenderOptions(form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	jobOpts, err := vh.parseJobOptions(c, form)
+	if err == nil {
+		err = vh.checkBrandKit(jobOpts.UserID, renderOpts.BrandKitID)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+
+	texts := map[string]string{}
+	for key, vals := range form.Value {
+		if slot, ok := strings.CutPrefix(key, "slot_"); ok && len(vals) > 0 {
+			texts[slot] = vals[0]
+		}
+	}
+
+	ws, localImagePaths, imageInfos, imageNames, ok := vh.inputImages(c, form, jobOpts.UserID, &renderOpts)
+	if !ok {
+		return
+	}
+	defer ws.Cleanup()
+
+	// Let the AI write whatever slots the client left open
+	var ai *models.VideoCompositionResponse
+	if prompt := firstFormValue(form, "prompt"); prompt != "" && hasOpenSlots(tpl, texts) {
+		vr := models.VideoGenerationRequest{Prompt: prompt, Source: models.VideoSourceReels, ImageContext: services.ImageContexts(imageNames, imageInfos)}
+		for i, p := range localImagePaths {
+			b, err := os.ReadFile(p)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to read image: %v", err)})
+				return
+			}
+			vr.Images = append(vr.Images, b)
+			vr.ImageNames = append(vr.ImageNames, imageNames[i])
+		}
+		ai, err = services.GenerateComposition(c.Request.Context(), vh.generator, vr)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+	}
+
+	composition, err := vh.templates.Fill(tpl, len(localImagePaths), texts, ai)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	blob, err := json.Marshal(composition)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to encode composition: %v", err)})
+		return
+	}
+
+	vh.render(c, ws, blob, localImagePaths, imageInfos, renderOpts, jobOpts)
+}
+
+func hasOpenSlots(tpl models.CompositionTemplate, texts map[string]string) bool {
+	for _, slot := range tpl.TextSlots {
+		if strings.TrimSpace(texts[slot.Slot]) == "" {
+			return true
+		}
+	}
+	return false
+}
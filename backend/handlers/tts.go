@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TTSHandler reports narration spend. Usage is counted by the process that ran the TTS calls,
+// so with RENDER_BACKEND=redis it only covers renders this API process executed itself.
+type TTSHandler struct {
+	voice *services.ElevenLabsService
+}
+
+func NewTTSHandler(voice *services.ElevenLabsService) *TTSHandler {
+	return &TTSHandler{voice: voice}
+}
+
+// GetUsage returns the caller's characters spent since startup and the account's quota
+func (th *TTSHandler) GetUsage(c *gin.Context) {
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	resp := gin.H{"status": "ok", "usage": th.voice.Usage(userID)}
+	if sub, err := th.voice.Subscription(c.Request.Context()); err != nil {
+		resp["subscriptionError"] = err.Error()
+	} else {
+		resp["subscription"] = sub
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"social-media-ai-video/models"
+	"social-media-ai-video/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// variantOptions asks for A/B variants of one reel
+type variantOptions struct {
+	Count int
+	Vary  []models.VariantDimension
+}
+
+// parseVariantOptions reads the optional variant form fields:
+//   - variants: how many versions of the reel to render (2 to services.MaxVariants)
+//   - vary: comma-separated dimensions they differ in: hook, music, transition, grading (default hook)
+func parseVariantOptions(form *multipart.Form) (variantOptions, error) {
+	var opts variantOptions
+	raw := firstFormValue(form, "variants")
+	if raw == "" {
+		return opts, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 2 || n > services.MaxVariants {
+		return opts, fmt.Errorf("invalid variants %q (expected 2 to %d)", raw, services.MaxVariants)
+	}
+	opts.Count = n
+	vary := firstFormValue(form, "vary")
+	if vary == "" {
+		vary = string(models.VaryHook)
+	}
+	if opts.Vary, err = services.ParseVariantDimensions(vary); err != nil {
+		return opts, err
+	}
+	if limit := services.MaxDistinctVariants(opts.Vary); n > limit {
+		return opts, fmt.Errorf("vary=%s gives at most %d distinct variants, got variants=%d", vary, limit, n)
+	}
+	return opts, nil
+}
+
+// renderVariants renders variants of a generated composition as one group. Every variant gets
+// its own copy of the inputs and is kept in storage like any JSON render. With async the jobs
+// are returned right away (202); otherwise the request waits for all of them and returns each
+// job with its result or error.
+func (vh *VideoHandler) renderVariants(c *gin.Context, composition []byte, vr models.VideoGenerationRequest, imagePaths []string, imageInfos []models.ImageInfo, opts models.RenderOptions, jobOpts jobOptions, vo variantOptions) {
+	ctx := c.Request.Context()
+	var hooks []string
+	if slices.Contains(vo.Vary, models.VaryHook) {
+		var err error
+		if hooks, err = vh.variantHooks(ctx, vr, vo.Count); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+	}
+	blobs, params, err := services.BuildVariants(composition, vo.Count, vo.Vary, hooks)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	lex, err := vh.lexicons.Get(jobOpts.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	opts.Lexicon = lex.Entries
+
+	group := services.NewID()
+	src := services.RenderTask{ImagePaths: imagePaths}
+	tasks := make([]services.RenderTask, 0, len(blobs))
+	workspaces := make([]*services.Workspace, 0, len(blobs))
+	defer func() {
+		for _, vws := range workspaces {
+			vws.Cleanup()
+		}
+	}()
+	for k, blob := range blobs {
+		vws, err := services.NewWorkspace(vh.cfg.UploadDir, services.UploadLimitsFromConfig(vh.cfg))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		workspaces = append(workspaces, vws)
+		paths, err := services.CopyInputs(ctx, vh.storage, src, vws)
+		if err != nil {
+			vh.dropStoredInputs(tasks)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		keys, err := services.StoreInputs(ctx, vh.storage, vws.Dir, paths)
+		if err != nil {
+			vh.dropStoredInputs(tasks)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		vopts := opts
+		vopts.Variant = &models.VariantRef{Group: group, Index: k, Params: params[k]}
+		tasks = append(tasks, services.RenderTask{
+			Composition:  blob,
+			ImagePaths:   paths,
+			ImageKeys:    keys,
+			ImageInfos:   imageInfos,
+			Options:      vopts,
+			WorkspaceDir: vws.Dir,
+			Keep:         true,
+			Detached:     jobOpts.Async,
+		})
+	}
+
+	variants := make([]models.RenderVariant, 0, len(tasks))
+	for k, task := range tasks {
+		job, err := vh.scheduler.Submit(task, jobOpts.Priority, jobOpts.UserID)
+		if err != nil {
+			// all or nothing: take back what was already queued
+			for _, v := range variants {
+				vh.scheduler.Cancel(v.Job.ID)
+			}
+			vh.dropStoredInputs(tasks[k:])
+			vh.rejectJob(c, err)
+			return
+		}
+		if jobOpts.Async {
+			// the job now owns the workspace
+			workspaces[k].Detach()
+		}
+		variants = append(variants, models.RenderVariant{Index: k, Params: params[k], Job: job})
+	}
+	if jobOpts.Async {
+		c.JSON(http.StatusAccepted, gin.H{"status": "ok", "group": group, "vary": vo.Vary, "variants": variants})
+		return
+	}
+
+	// a client disconnect cancels every render of the group
+	for i := range variants {
+		job, err := vh.scheduler.Wait(ctx, variants[i].Job.ID)
+		if err != nil && job.Error == "" {
+			job.Error = err.Error()
+		}
+		if job, err = signedJob(vh.storage, vh.cfg.StorageURLTTL, job); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		variants[i].Job = job
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "group": group, "vary": vo.Vary, "variants": variants})
+}
+
+// variantHooks asks the generator for a fresh composition per extra variant and keeps its hook;
+// hooks[0] stays empty (variant 0 keeps the original)
+func (vh *VideoHandler) variantHooks(ctx context.Context, vr models.VideoGenerationRequest, n int) ([]string, error) {
+	hooks := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for k := 1; k < n; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			req := vr
+			req.Prompt = fmt.Sprintf("%s\n\nThis is variant %d of %d for an A/B test: write a different opening hook than the other variants.", vr.Prompt, k+1, n)
+			vc, err := services.GenerateComposition(ctx, vh.generator, req)
+			if err != nil {
+				errs[k] = fmt.Errorf("variant %d: %v", k, err)
+				return
+			}
+			i := services.HookSegment(vc)
+			if i < 0 {
+				errs[k] = fmt.Errorf("variant %d: the generated composition has no hook", k)
+				return
+			}
+			hooks[k] = vc.Timeline.TextTimeline.TextSegments[i].Text
+		}(k)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hooks, nil
+}
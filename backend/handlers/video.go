@@ -1,15 +1,17 @@
 package handlers
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"social-media-ai-video/config"
@@ -20,20 +22,34 @@ import (
 )
 
 type VideoHandler struct {
-	cfg              *config.APIConfig
-	contentGenerator *services.ContentGenerator
-	elevenLabs       *services.ElevenLabsService
-	backgroundMusic  *services.BackgroundMusic
-	ffmpegCompiler   *services.CompositionCompiler
+	cfg             *config.APIConfig
+	generator       services.CompositionGenerator
+	elevenLabs      *services.ElevenLabsService
+	backgroundMusic *services.BackgroundMusic
+	scheduler       *services.RenderScheduler
+	templates       *services.TemplateRegistry
+	ingestor        *services.ImageIngestor
+	storage         services.Storage
+	assets          *services.AssetLibrary
+	brandKits       *services.BrandKitStore
+	lexicons        *services.LexiconStore
+	localizer       *services.Localizer
 }
 
-func NewVideoHandler(cfg *config.APIConfig) *VideoHandler {
+func NewVideoHandler(cfg *config.APIConfig, scheduler *services.RenderScheduler, templates *services.TemplateRegistry, storage services.Storage, assets *services.AssetLibrary, brandKits *services.BrandKitStore, lexicons *services.LexiconStore, localizer *services.Localizer, generator services.CompositionGenerator) *VideoHandler {
 	return &VideoHandler{
-		cfg:              cfg,
-		contentGenerator: services.NewContentGenerator(cfg),
-		elevenLabs:       services.NewElevenLabsService(cfg),
-		backgroundMusic:  services.NewBackgroundMusic(cfg),
-		ffmpegCompiler:   services.NewCompositionCompiler(services.NewFFmpegCommandBuilder(), services.NewBackgroundMusic(cfg), services.NewElevenLabsService(cfg)),
+		cfg:             cfg,
+		generator:       generator,
+		elevenLabs:      services.NewElevenLabsService(cfg),
+		backgroundMusic: services.NewBackgroundMusic(cfg),
+		scheduler:       scheduler,
+		templates:       templates,
+		ingestor:        services.NewImageIngestor(cfg),
+		storage:         storage,
+		assets:          assets,
+		brandKits:       brandKits,
+		lexicons:        lexicons,
+		localizer:       localizer,
 	}
 }
 
@@ -48,132 +64,218 @@ func (vh *VideoHandler) GenerateVideoReels(c *gin.Context) {
 		return
 	}
 
-	// Buffer the original request body so we can both parse and forward it
-	origBody, readErr := io.ReadAll(c.Request.Body)
-	if readErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": fmt.Sprintf("failed to read request body: %v", readErr)})
-		return
-	}
-
-	//reset request body
-	c.Request.Body = io.NopCloser(bytes.NewReader(origBody))
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, vh.cfg.MaxRequestBytes)
 
 	// Parse incoming multipart form to extract and save images locally
 	form, err := c.MultipartForm()
 	if err != nil || form == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "invalid multipart form"})
+		status := http.StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"status": "error", "error": "invalid multipart form"})
 		return
 	}
-	files := form.File["image"]
-	if len(files) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "at least one image is required (field name: image)"})
+	renderOpts, err := parseRenderOptions(form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
 		return
 	}
-
-	imageTmpDir := filepath.Join(os.TempDir(), "reels_images")
-	if err := os.MkdirAll(imageTmpDir, 0o755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to create temp dir: %v", err)})
+	jobOpts, err := vh.parseJobOptions(c, form)
+	if err == nil {
+		err = vh.checkBrandKit(jobOpts.UserID, renderOpts.BrandKitID)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	variantOpts, err := parseVariantOptions(form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
 		return
 	}
 
-	var localImagePaths []string
-	for idx, fh := range files {
-		src, err := fh.Open()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to open uploaded file: %v", err)})
-			return
-		}
-		defer src.Close()
+	ws, localImagePaths, imageInfos, imageNames, ok := vh.inputImages(c, form, jobOpts.UserID, &renderOpts)
+	if !ok {
+		return
+	}
+	defer ws.Cleanup()
 
-		basename := fmt.Sprintf("%03d_%s", idx, fh.Filename)
-		localPath := filepath.Join(imageTmpDir, basename)
-		out, err := os.Create(localPath)
+	// Forward the normalized images (not the raw uploads) so the generator sees what gets rendered,
+	// along with what the ingestion found out about them
+	vr := models.VideoGenerationRequest{
+		Prompt:       firstFormValue(form, "prompt"),
+		Source:       models.VideoSourceReels,
+		ImageContext: services.ImageContexts(imageNames, imageInfos),
+	}
+	for i, p := range localImagePaths {
+		b, err := os.ReadFile(p)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to create temp image file: %v", err)})
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to read image: %v", err)})
 			return
 		}
-		if _, err := io.Copy(out, src); err != nil {
-			out.Close()
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to write temp image file: %v", err)})
-			return
-		}
-		out.Close()
-		localImagePaths = append(localImagePaths, localPath)
+		vr.Images = append(vr.Images, b)
+		vr.ImageNames = append(vr.ImageNames, imageNames[i])
 	}
 
-	// Forward the original multipart body to N8N Reels webhook without rebuilding
-	targetURL := vh.cfg.N8NREELSURL
-	if targetURL == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": "N8N Reels URL not configured"})
+	// async reels need not wait on the generator when it can call back with the composition
+	if ag, ok := vh.generator.(services.AsyncCompositionGenerator); ok && jobOpts.Async && variantOpts.Count <= 1 && vh.cfg.N8NCallbackURL != "" {
+		vh.generateAsync(c, ag, ws, vr, localImagePaths, imageInfos, renderOpts, jobOpts)
 		return
 	}
 
-	req, err := http.NewRequest("POST", targetURL, bytes.NewReader(origBody))
+	respBytes, err := vh.generator.Generate(c.Request.Context(), vr)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": fmt.Sprintf("failed to create upstream request: %v", err)})
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": err.Error()})
 		return
 	}
-	// Preserve the original Content-Type with boundary
-	req.Header.Set("Content-Type", ct)
 
-	resp, err := http.DefaultClient.Do(req)
+	if variantOpts.Count > 1 {
+		vh.renderVariants(c, respBytes, vr, localImagePaths, imageInfos, renderOpts, jobOpts, variantOpts)
+		return
+	}
+	vh.render(c, ws, respBytes, localImagePaths, imageInfos, renderOpts, jobOpts)
+}
+
+// render schedules the composition for rendering and responds.
+// Without extra outputs the MP4 is rendered inside the request workspace and streamed; otherwise
+// the render and its input images are kept in storage and a JSON RenderResult with signed
+// artifact URLs is returned. With async the job is queued in the background and 202 with the
+// job is returned right away.
+func (vh *VideoHandler) render(c *gin.Context, ws *services.Workspace, composition []byte, imagePaths []string, imageInfos []models.ImageInfo, opts models.RenderOptions, jobOpts jobOptions) {
+	// the lexicon travels with the job so workers and retries pronounce the same way
+	lex, err := vh.lexicons.Get(jobOpts.UserID)
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": fmt.Sprintf("upstream request failed: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
 		return
 	}
-	defer resp.Body.Close()
+	opts.Lexicon = lex.Entries
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		upstreamBody, _ := io.ReadAll(resp.Body)
-		c.JSON(http.StatusBadGateway, gin.H{
-			"status": "error",
-			"error":  fmt.Sprintf("upstream %s: %s", resp.Status, string(upstreamBody)),
-		})
+	task := services.RenderTask{
+		Composition:  composition,
+		ImagePaths:   imagePaths,
+		ImageInfos:   imageInfos,
+		Options:      opts,
+		WorkspaceDir: ws.Dir,
+		Keep:         len(opts.Outputs) > 0 || jobOpts.Async,
+		Detached:     jobOpts.Async,
+	}
+	if task.Keep {
+		keys, err := services.StoreInputs(c.Request.Context(), vh.storage, ws.Dir, imagePaths)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return
+		}
+		task.ImageKeys = keys
+	}
+	job, err := vh.scheduler.Submit(task, jobOpts.Priority, jobOpts.UserID)
+	if err != nil {
+		vh.rejectJob(c, err)
 		return
 	}
 
-	// Read upstream JSON response body
-	respBytes, readUpErr := io.ReadAll(resp.Body)
-	if readUpErr != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": fmt.Sprintf("failed to read upstream response: %v", readUpErr)})
+	if jobOpts.Async {
+		// the job now owns the workspace
+		ws.Detach()
+		c.Header("Location", "/api/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, gin.H{"status": "ok", "job": job})
 		return
 	}
 
-	// Compile with AI schema blob and local image paths
-	args, _, outputPath, err := vh.ffmpegCompiler.Compile(respBytes, localImagePaths)
+	// a client disconnect cancels the render
+	job, err = vh.scheduler.Wait(c.Request.Context(), job.ID)
+	if errors.Is(err, services.ErrSchedulerClosed) {
+		vh.rejectJob(c, err)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": err.Error()})
+		status := http.StatusInternalServerError
+		var compileErr *services.CompileError
+		var ttsErr *services.TTSError
+		switch {
+		case errors.As(err, &compileErr):
+			status = http.StatusBadRequest
+		case errors.As(err, &ttsErr):
+			status = ttsErrorStatus(c, ttsErr)
+		}
+		resp := gin.H{"status": "error", "error": err.Error()}
+		if job.ErrorDetails != "" {
+			resp["details"] = job.ErrorDetails
+		}
+		c.JSON(status, resp)
 		return
 	}
-	defer os.Remove(outputPath)
 
-	cmd := exec.Command("ffmpeg", args...)
-	// Run ffmpeg and capture output for diagnostics
-	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Printf("ffmpeg args: %v\n", args)
-		fmt.Printf("ffmpeg error: %v\n", err)
-		fmt.Printf("ffmpeg output: %s\n", string(output))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"error":   fmt.Sprintf("ffmpeg failed: %v", err),
-			"details": string(output),
-		})
+	if !task.Keep {
+		video, _ := job.Result.Artifact(models.ArtifactVideo)
+		c.Header("Content-Type", "video/mp4")
+		c.File(video.Path) // streams via http.ServeFile; supports Range (seek/scrub)
 		return
 	}
+	result, err := services.SignResult(vh.storage, job.Result, vh.cfg.StorageURLTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "render": result})
+}
 
-	// Ensure output file exists and is non-empty before serving
-	if fi, statErr := os.Stat(outputPath); statErr != nil || fi.Size() == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status": "error",
-			"error":  fmt.Sprintf("output file missing or empty: %v", statErr),
-		})
+// generateAsync holds a job for the composition the generator will post to the callback
+// webhook, and responds 202 with the job (status generating) once the generator accepted it
+func (vh *VideoHandler) generateAsync(c *gin.Context, ag services.AsyncCompositionGenerator, ws *services.Workspace, vr models.VideoGenerationRequest, imagePaths []string, imageInfos []models.ImageInfo, opts models.RenderOptions, jobOpts jobOptions) {
+	lex, err := vh.lexicons.Get(jobOpts.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	opts.Lexicon = lex.Entries
+	keys, err := services.StoreInputs(c.Request.Context(), vh.storage, ws.Dir, imagePaths)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
 		return
 	}
+	job, err := vh.scheduler.Hold(services.RenderTask{
+		ImagePaths:   imagePaths,
+		ImageKeys:    keys,
+		ImageInfos:   imageInfos,
+		Options:      opts,
+		WorkspaceDir: ws.Dir,
+		Keep:         true,
+		Detached:     true,
+	}, jobOpts.Priority, jobOpts.UserID)
+	if err != nil {
+		vh.dropStoredInputs([]services.RenderTask{{ImageKeys: keys}})
+		vh.rejectJob(c, err)
+		return
+	}
+	// the job now owns the workspace
+	ws.Detach()
 
-	// After ffmpeg finishes and you have outputPath
-	c.Header("Content-Type", "video/mp4")
-	c.File(outputPath) // streams via http.ServeFile; supports Range (seek/scrub)
+	if err := ag.GenerateAsync(c.Request.Context(), vr, job.ID); err != nil {
+		vh.scheduler.FailGeneration(job.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	job, _ = vh.scheduler.Get(job.ID)
+	c.Header("Location", "/api/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"status": "ok", "job": job})
+}
 
+// rejectJob answers a failed Submit: 429 when the queue is full, 503 while shutting down
+func (vh *VideoHandler) rejectJob(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrQueueFull):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, services.ErrSchedulerClosed):
+		status = http.StatusServiceUnavailable
+	}
+	if status != http.StatusInternalServerError {
+		retry := int(math.Ceil(vh.scheduler.RetryAfter().Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retry))
+	}
+	c.JSON(status, gin.H{"status": "error", "error": err.Error()})
 }
 
 // this function is currently broken; fix later
@@ -225,7 +327,7 @@ func (vh *VideoHandler) GenerateVideoPexels(c *gin.Context) {
 		vr.ImageNames = append(vr.ImageNames, fh.Filename)
 	}
 
-	resp, svcErr := vh.contentGenerator.GenerateVideoSchemaMultipart(vr)
+	resp, svcErr := services.GenerateComposition(c.Request.Context(), vh.generator, vr)
 	if svcErr != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": svcErr.Error()})
 		return
@@ -233,3 +335,323 @@ func (vh *VideoHandler) GenerateVideoPexels(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// saveUploadedImages validates the uploads, stores them in a fresh per-request workspace and
+// normalizes them for rendering, in upload order. The caller must Cleanup the workspace. On
+// failure it has already written the error response.
+func (vh *VideoHandler) saveUploadedImages(c *gin.Context, files []*multipart.FileHeader, background string) (*services.Workspace, []string, []models.ImageInfo, bool) {
+	ws, err := services.NewWorkspace(vh.cfg.UploadDir, services.UploadLimitsFromConfig(vh.cfg))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return nil, nil, nil, false
+	}
+
+	var localImagePaths []string
+	var infos []models.ImageInfo
+	for _, fh := range files {
+		localPath, err := ws.SaveUpload(fh)
+		if err == nil {
+			var info models.ImageInfo
+			localPath, info, err = vh.ingestor.Normalize(c.Request.Context(), ws, localPath, background)
+			infos = append(infos, info)
+		}
+		if err != nil {
+			ws.Cleanup()
+			c.JSON(uploadErrorStatus(err), gin.H{"status": "error", "error": err.Error()})
+			return nil, nil, nil, false
+		}
+		localImagePaths = append(localImagePaths, localPath)
+	}
+	return ws, localImagePaths, infos, true
+}
+
+// inputImages stores the request's images in a fresh workspace and normalizes them: either the
+// uploaded "image" files or the library assets named by repeated "asset_id" fields, in form
+// order. Besides paths and infos it returns the names to show the generator; asset renders also
+// get opts.AssetIDs, the list the segments' imageIndex picks from. On failure it has already
+// responded.
+func (vh *VideoHandler) inputImages(c *gin.Context, form *multipart.Form, userID string, opts *models.RenderOptions) (*services.Workspace, []string, []models.ImageInfo, []string, bool) {
+	files := form.File["image"]
+	assetIDs := splitList(form.Value["asset_id"])
+	switch {
+	case len(files) > 0 && len(assetIDs) > 0:
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "send either image files or asset_id values, not both"})
+		return nil, nil, nil, nil, false
+	case len(files) == 0 && len(assetIDs) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "at least one image is required (field name: image, or asset_id for library assets)"})
+		return nil, nil, nil, nil, false
+	case len(assetIDs) > 0:
+		ws, paths, infos, names, ok := vh.loadAssetImages(c, userID, assetIDs, opts.Background)
+		if ok {
+			opts.AssetIDs = assetIDs
+		}
+		return ws, paths, infos, names, ok
+	}
+
+	ws, paths, infos, ok := vh.saveUploadedImages(c, files, opts.Background)
+	if !ok {
+		return nil, nil, nil, nil, false
+	}
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = normalizedName(files[i].Filename, p)
+	}
+	return ws, paths, infos, names, true
+}
+
+// loadAssetImages fetches the user's assets into a fresh workspace and normalizes them
+func (vh *VideoHandler) loadAssetImages(c *gin.Context, userID string, ids []string, background string) (*services.Workspace, []string, []models.ImageInfo, []string, bool) {
+	ws, err := services.NewWorkspace(vh.cfg.UploadDir, services.UploadLimitsFromConfig(vh.cfg))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return nil, nil, nil, nil, false
+	}
+	var paths, names []string
+	var infos []models.ImageInfo
+	for _, id := range ids {
+		asset, err := vh.assets.Get(userID, id)
+		if err != nil {
+			ws.Cleanup()
+			c.JSON(assetErrorStatus(err), gin.H{"status": "error", "error": fmt.Sprintf("asset %s: %v", id, err)})
+			return nil, nil, nil, nil, false
+		}
+		path, err := vh.assets.Fetch(c.Request.Context(), asset, ws.Dir)
+		if err == nil {
+			var info models.ImageInfo
+			path, info, err = vh.ingestor.Normalize(c.Request.Context(), ws, path, background)
+			infos = append(infos, info)
+		}
+		if err != nil {
+			ws.Cleanup()
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+			return nil, nil, nil, nil, false
+		}
+		paths = append(paths, path)
+		names = append(names, normalizedName(asset.Name, path))
+	}
+	return ws, paths, infos, names, true
+}
+
+// ProbeImages runs the ingestion stage on the uploaded images and returns their metadata without rendering
+func (vh *VideoHandler) ProbeImages(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, vh.cfg.MaxRequestBytes)
+	form, err := c.MultipartForm()
+	if err != nil || form == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "invalid multipart form"})
+		return
+	}
+	files := form.File["image"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "at least one image is required (field name: image)"})
+		return
+	}
+	ws, _, infos, ok := vh.saveUploadedImages(c, files, "")
+	if !ok {
+		return
+	}
+	defer ws.Cleanup()
+
+	images := make([]gin.H, len(infos))
+	for i, info := range infos {
+		images[i] = gin.H{"name": files[i].Filename, "info": info}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "images": images})
+}
+
+// normalizedName keeps the client's file stem but uses the extension of the stored (possibly converted) file
+func normalizedName(clientName, storedPath string) string {
+	stem := strings.TrimSuffix(filepath.Base(clientName), filepath.Ext(clientName))
+	if stem == "" || stem == "." {
+		stem = strings.TrimSuffix(filepath.Base(storedPath), filepath.Ext(storedPath))
+	}
+	return stem + filepath.Ext(storedPath)
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnsupportedMedia):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrUploadTooLarge), errors.Is(err, services.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// ttsErrorStatus maps a narration failure: a misconfigured key is the gateway's fault (502), an
+// exhausted quota or an outage that outlasted the retries means try later (503)
+func ttsErrorStatus(c *gin.Context, err *services.TTSError) int {
+	switch {
+	case errors.Is(err, services.ErrTTSAuth), errors.Is(err, services.ErrTTSRejected):
+		return http.StatusBadGateway
+	case errors.Is(err, services.ErrTTSTransient) && err.RetryAfter > 0:
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+	return http.StatusServiceUnavailable
+}
+
+// parseRenderOptions reads optional render knobs from the multipart form:
+//   - crop_mode: "fit" (default) or "fill"
+//   - focal_point: repeated, one per image in upload order, formatted "x,y" (0..1); empty means auto-detect
+//   - outputs: comma-separated/repeated extras: thumbnail, preview_gif, preview_webp, proxy, contact_sheet,
+//     subtitles_srt, subtitles_vtt, subtitles_ass, narration
+//   - captions: "drawtext" (default) or "burn" to burn karaoke-styled ASS captions
+//   - brand_kit_id: stored brand kit to apply
+//   - thumbnail_segment: image segment (playback order) to take the thumbnail from; default picks the best frame
+//   - background: "#RRGGBB" used to flatten transparent images; default INGEST_BACKGROUND
+//   - narration_fit: "atempo" (default) time-stretches narration to the timeline, "regenerate" re-synthesizes
+//     it at an adjusted speed, "reflow" rescales the segments to the narration, "none" leaves both as they are
+func parseRenderOptions(form *multipart.Form) (models.RenderOptions, error) {
+	var opts models.RenderOptions
+
+	switch mode := models.CropMode(firstFormValue(form, "crop_mode")); mode {
+	case "", models.CropModeFit, models.CropModeFill:
+		opts.CropMode = mode
+	default:
+		return opts, fmt.Errorf("invalid crop_mode %q (expected fit or fill)", mode)
+	}
+
+	for idx, raw := range form.Value["focal_point"] {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			opts.FocalPoints = append(opts.FocalPoints, nil)
+			continue
+		}
+		parts := strings.Split(raw, ",")
+		if len(parts) != 2 {
+			return opts, fmt.Errorf("invalid focal_point %d: expected \"x,y\"", idx)
+		}
+		x, errX := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if errX != nil || errY != nil || x < 0 || x > 1 || y < 0 || y > 1 {
+			return opts, fmt.Errorf("invalid focal_point %d: coordinates must be numbers in 0..1", idx)
+		}
+		opts.FocalPoints = append(opts.FocalPoints, &models.FocalPoint{X: x, Y: y})
+	}
+
+	outputs, err := services.ParseArtifactKinds(form.Value["outputs"])
+	if err != nil {
+		return opts, err
+	}
+	opts.Outputs = outputs
+
+	switch captions := firstFormValue(form, "captions"); captions {
+	case "", "drawtext":
+	case "burn":
+		opts.BurnCaptions = true
+	default:
+		return opts, fmt.Errorf("invalid captions %q (expected drawtext or burn)", captions)
+	}
+
+	opts.BrandKitID = firstFormValue(form, "brand_kit_id")
+
+	if raw := firstFormValue(form, "thumbnail_segment"); raw != "" {
+		seg, err := strconv.Atoi(raw)
+		if err != nil || seg < 0 {
+			return opts, fmt.Errorf("invalid thumbnail_segment %q", raw)
+		}
+		opts.ThumbnailSegment = &seg
+	}
+
+	if bg := firstFormValue(form, "background"); bg != "" {
+		if _, err := services.ParseHexColor(bg); err != nil {
+			return opts, fmt.Errorf("invalid background: %v", err)
+		}
+		opts.Background = bg
+	}
+
+	switch fit := models.NarrationFit(firstFormValue(form, "narration_fit")); fit {
+	case "", models.NarrationFitTempo, models.NarrationFitRegenerate, models.NarrationFitReflow, models.NarrationFitNone:
+		opts.NarrationFit = fit
+	default:
+		return opts, fmt.Errorf("invalid narration_fit %q (expected atempo, regenerate, reflow or none)", fit)
+	}
+	return opts, nil
+}
+
+// jobOptions are scheduling knobs, kept apart from what shapes the render itself
+type jobOptions struct {
+	Priority models.JobPriority
+	Async    bool
+	UserID   string
+}
+
+// parseJobOptions reads the X-User-ID header (job history owner) and the form fields:
+//   - priority: "low" (previews), "normal" or "high"; capped at the user's tier (see jobPriority)
+//   - async: "true" queues the render and returns 202 with a job to poll at /api/jobs/:id
+func (vh *VideoHandler) parseJobOptions(c *gin.Context, form *multipart.Form) (jobOptions, error) {
+	var opts jobOptions
+	userID, err := userIDFromHeader(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.UserID = userID
+	if opts.Priority, err = vh.jobPriority(userID, models.JobPriority(firstFormValue(form, "priority"))); err != nil {
+		return opts, err
+	}
+	if raw := firstFormValue(form, "async"); raw != "" {
+		async, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid async %q", raw)
+		}
+		opts.Async = async
+	}
+	return opts, nil
+}
+
+// checkBrandKit rejects a brand_kit_id that is not one of userID's kits. Renders load the kit
+// by ID, so this is where its owner is checked.
+func (vh *VideoHandler) checkBrandKit(userID, id string) error {
+	if id == "" {
+		return nil
+	}
+	if _, err := vh.brandKits.Get(userID, id); err != nil {
+		return fmt.Errorf("brand kit %s: %v", id, err)
+	}
+	return nil
+}
+
+// jobPriority decides a job's priority from the server's tiers: the user's entry in
+// USER_PRIORITIES, else JOB_PRIORITY. requested may lower it (e.g. "low" for a preview) but
+// never raise it; empty means the tier itself.
+func (vh *VideoHandler) jobPriority(userID string, requested models.JobPriority) (models.JobPriority, error) {
+	tier := models.JobPriority(vh.cfg.JobPriority)
+	if p, ok := vh.cfg.UserPriorities[strings.ToLower(userID)]; ok && userID != "" {
+		tier = models.JobPriority(p)
+	}
+	switch tier {
+	case models.PriorityLow, models.PriorityNormal, models.PriorityHigh:
+	default:
+		tier = models.PriorityNormal
+	}
+	switch requested {
+	case "":
+		return tier, nil
+	case models.PriorityLow, models.PriorityNormal, models.PriorityHigh:
+		if requested.Rank() > tier.Rank() {
+			return tier, nil
+		}
+		return requested, nil
+	default:
+		return "", fmt.Errorf("invalid priority %q (expected low, normal or high)", requested)
+	}
+}
+
+// splitList flattens repeated and comma-separated form values, dropping empty entries
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func firstFormValue(form *multipart.Form, key string) string {
+	if vals := form.Value[key]; len(vals) > 0 {
+		return strings.TrimSpace(vals[0])
+	}
+	return ""
+}
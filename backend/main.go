@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"social-media-ai-video/config"
 	"social-media-ai-video/handlers"
+	"social-media-ai-video/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,6 +23,53 @@ func main() {
 	// Load configuration
 	cfg := config.LoadAPIConfig()
 
+	// Shared stores
+	brandKits := services.NewBrandKitStore(cfg)
+	storage, err := services.NewStorage(cfg)
+	if err != nil {
+		log.Fatal("Failed to open storage:", err)
+	}
+
+	// One ElevenLabs client so its rate limit, concurrency cap and usage counters are process-wide
+	voice := services.NewElevenLabsService(cfg)
+
+	// The render step: compile the composition, run ffmpeg, derive artifacts
+	pipeline := services.NewRenderPipeline(
+		cfg,
+		services.NewCompositionCompiler(services.NewFFmpegCommandBuilder(), services.NewBackgroundMusic(cfg), voice, services.NewSaliencyAnalyzer(nil), brandKits),
+		services.NewRenderer(cfg),
+		storage,
+	)
+
+	switch cfg.AppMode {
+	case "worker":
+		runWorker(cfg, pipeline, storage)
+	case "api":
+		runAPI(cfg, pipeline, brandKits, storage, voice)
+	default:
+		log.Fatalf("Unknown APP_MODE %q (expected api or worker)", cfg.AppMode)
+	}
+}
+
+// runWorker renders jobs pulled from the Redis queue until SIGINT/SIGTERM
+func runWorker(cfg *config.APIConfig, pipeline *services.RenderPipeline, storage services.Storage) {
+	queue, err := services.NewRedisRenderQueue(cfg)
+	if err != nil {
+		log.Fatal("Failed to start worker:", err)
+	}
+	defer queue.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// workers only own their TTS clips and render staging dirs
+	go services.NewJanitor(cfg, storage, nil, nil).Run(ctx)
+	log.Printf("Render worker started: %d parallel renders", cfg.RenderConcurrency)
+	queue.RunWorker(ctx, cfg.RenderConcurrency, cfg.ShutdownTimeout, pipeline.Execute)
+	log.Printf("Render worker stopped")
+}
+
+// runAPI serves HTTP; renders run in-process or, with RENDER_BACKEND=redis, on workers
+func runAPI(cfg *config.APIConfig, pipeline *services.RenderPipeline, brandKits *services.BrandKitStore, storage services.Storage, voice *services.ElevenLabsService) {
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -20,23 +77,125 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID"},
 		AllowCredentials: true,
 	}))
 
+	templates, err := services.NewTemplateRegistry(cfg)
+	if err != nil {
+		log.Fatal("Failed to load templates:", err)
+	}
+
+	execute := pipeline.Execute
+	switch cfg.RenderBackend {
+	case "local":
+	case "redis":
+		queue, err := services.NewRedisRenderQueue(cfg)
+		if err != nil {
+			log.Fatal("Failed to connect render queue:", err)
+		}
+		defer queue.Close()
+		execute = queue.Execute
+	default:
+		log.Fatalf("Unknown RENDER_BACKEND %q (expected local or redis)", cfg.RenderBackend)
+	}
+
+	// Jobs are persisted; ones the last process left unfinished are retried or marked failed
+	jobStore, err := services.OpenJobStore(cfg)
+	if err != nil {
+		log.Fatal("Failed to open job store:", err)
+	}
+	defer jobStore.Close()
+	resumed, err := jobStore.Recover(cfg.JobMaxAttempts)
+	if err != nil {
+		log.Fatal("Failed to recover jobs:", err)
+	}
+	if len(resumed) > 0 {
+		log.Printf("Resuming %d interrupted jobs", len(resumed))
+	}
+	services.CleanupOrphans(cfg, resumed)
+	// Renders run on a bounded worker pool
+	scheduler := services.NewRenderScheduler(cfg, jobStore, execute, pipeline.Discard)
+	scheduler.Restore(resumed)
+
+	// Old uploads, TTS clips and outputs are removed in the background
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	go services.NewJanitor(cfg, storage, jobStore, scheduler).Run(janitorCtx)
+
+	assets, err := services.OpenAssetLibrary(cfg, storage)
+	if err != nil {
+		log.Fatal("Failed to open asset library:", err)
+	}
+	defer assets.Close()
+
 	// Initialize handlers
-	videoHandler := handlers.NewVideoHandler(cfg)
+	lexicons := services.NewLexiconStore(cfg)
+	translator, err := services.NewTranslator(cfg)
+	if err != nil {
+		log.Fatal("Failed to set up translator:", err)
+	}
+	localizer := services.NewLocalizer(cfg, translator)
+	if cfg.N8NCallbackURL != "" && cfg.N8NSigningSecret == "" {
+		log.Fatal("N8N_CALLBACK_URL needs N8N_SIGNING_SECRET to verify callbacks")
+	}
+	compositionSchema, err := services.LoadJSONSchema(cfg.CompositionSchema)
+	if err != nil {
+		log.Fatal("Failed to load composition schema:", err)
+	}
+	generator, err := services.NewCompositionGenerator(cfg, compositionSchema)
+	if err != nil {
+		log.Fatal("Failed to set up composition generator:", err)
+	}
+	videoHandler := handlers.NewVideoHandler(cfg, scheduler, templates, storage, assets, brandKits, lexicons, localizer, generator)
+	assetHandler := handlers.NewAssetHandler(cfg, assets)
+	jobHandler := handlers.NewJobHandler(cfg, scheduler, storage)
+	brandKitHandler := handlers.NewBrandKitHandler(brandKits)
+	templateHandler := handlers.NewTemplateHandler(templates)
+	ttsHandler := handlers.NewTTSHandler(voice)
+	lexiconHandler := handlers.NewLexiconHandler(lexicons)
+	n8nCallbackHandler := handlers.NewN8NCallbackHandler(cfg, scheduler, compositionSchema)
 
 	// API routes
 	api := r.Group("/api")
 	{
 		api.POST("/generate-video-pexels", videoHandler.GenerateVideoPexels)
 		api.POST("/generate-video-reels", videoHandler.GenerateVideoReels)
+		api.POST("/images/probe", videoHandler.ProbeImages)
+		api.POST("/assets", assetHandler.UploadAssets)
+		api.GET("/assets", assetHandler.ListAssets)
+		api.GET("/assets/:id", assetHandler.GetAsset)
+		api.PUT("/assets/:id/tags", assetHandler.SetAssetTags)
+		api.DELETE("/assets/:id", assetHandler.DeleteAsset)
+		api.GET("/jobs", jobHandler.ListJobs)
+		api.GET("/jobs/:id", jobHandler.GetJob)
+		api.POST("/jobs/:id/cancel", jobHandler.CancelJob)
+		api.POST("/jobs/:id/localize", videoHandler.LocalizeJob)
 		//api.GET("/composition", videoHandler.GetComposition)
+
+		api.POST("/brand-kits", brandKitHandler.CreateBrandKit)
+		api.GET("/brand-kits", brandKitHandler.ListBrandKits)
+		api.GET("/brand-kits/:id", brandKitHandler.GetBrandKit)
+		api.GET("/brand-kits/:id/logo", brandKitHandler.GetBrandKitLogo)
+		api.DELETE("/brand-kits/:id", brandKitHandler.DeleteBrandKit)
+
+		api.GET("/templates", templateHandler.ListTemplates)
+		api.GET("/templates/:id", templateHandler.GetTemplate)
+		api.POST("/templates/:id/render", videoHandler.GenerateFromTemplate)
+
+		api.GET("/tts/usage", ttsHandler.GetUsage)
+		api.GET("/lexicon", lexiconHandler.GetLexicon)
+		api.PUT("/lexicon", lexiconHandler.PutLexicon)
+		api.DELETE("/lexicon", lexiconHandler.DeleteLexicon)
+
+		// signed with N8N_SIGNING_SECRET instead of user credentials
+		api.POST("/n8n/callback", n8nCallbackHandler.Callback)
 	}
 
-	// Serve static files from ./tmp at /static
-	r.Static("/static", "./tmp")
+	// Signed download links of the local storage backend
+	if local, ok := storage.(*services.LocalStorage); ok {
+		r.GET("/files/*key", handlers.NewFileHandler(local).GetFile)
+	}
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -44,8 +203,54 @@ func main() {
 	})
 
 	// Start server
-	log.Printf("Server starting on port %s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: r}
+	go func() {
+		log.Printf("Server starting on port %s", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	admin := serveAdmin(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	// New renders now get 503; running ones may finish until the deadline, then are killed
+	log.Printf("Shutting down: draining renders for up to %s", cfg.ShutdownTimeout)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelDrain()
+	if left := scheduler.Shutdown(drainCtx); left > 0 {
+		log.Printf("%d queued jobs will resume on the next start", left)
+	}
+
+	// Give handlers waiting on drained renders a moment to write their responses
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+	if admin != nil {
+		admin.Close()
+	}
+	log.Printf("Server stopped")
+}
+
+// serveAdmin exposes runtime and janitor counters on the internal ADMIN_ADDR listener, away
+// from the public API port; returns nil when it is disabled
+func serveAdmin(cfg *config.APIConfig) *http.Server {
+	if cfg.AdminAddr == "off" {
+		return nil
 	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	srv := &http.Server{Addr: cfg.AdminAddr, Handler: mux}
+	go func() {
+		log.Printf("Admin listener on %s", cfg.AdminAddr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Admin listener: %v", err)
+		}
+	}()
+	return srv
 }
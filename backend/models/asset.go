@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Asset is an image in a user's library that render requests can reference by ID
+type Asset struct {
+	ID string `json:"id"`
+	// UserID is the X-User-ID the asset was uploaded under; empty for anonymous uploads
+	UserID string `json:"userId,omitempty"`
+	// Name is the client's file name of the first upload
+	Name string `json:"name"`
+	// Hash is the SHA-256 of the original bytes; re-uploading the same content returns the same asset
+	Hash        string   `json:"hash"`
+	ContentType string   `json:"contentType"`
+	Size        int64    `json:"size"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	Tags        []string `json:"tags"`
+	// Key locates the original in storage; URL is a signed link filled in per response
+	Key       string     `json:"-"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// HasTag reports whether the asset carries tag
+func (a Asset) HasTag(tag string) bool {
+	for _, t := range a.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// WatermarkPosition places the brand logo on the canvas
+type WatermarkPosition string
+
+const (
+	WatermarkTopLeft     WatermarkPosition = "top-left"
+	WatermarkTopRight    WatermarkPosition = "top-right"
+	WatermarkBottomLeft  WatermarkPosition = "bottom-left"
+	WatermarkBottomRight WatermarkPosition = "bottom-right"
+)
+
+type Watermark struct {
+	Position WatermarkPosition `json:"position"`
+	// Opacity of the logo, 0..1
+	Opacity float64 `json:"opacity"`
+	// Scale is the logo width as a fraction of the canvas width
+	Scale float64 `json:"scale"`
+}
+
+type BrandFonts struct {
+	// Heading is used for intro/end card titles, Body for overlays and captions (fontconfig family names)
+	Heading string `json:"heading"`
+	Body    string `json:"body"`
+}
+
+// BrandKit bundles an agency customer's visual identity so every reel comes out on-brand
+type BrandKit struct {
+	ID string `json:"id"`
+	// UserID is the X-User-ID the kit was created under; only that user can see or use it
+	UserID         string     `json:"userId,omitempty"`
+	Name           string     `json:"name"`
+	HasLogo        bool       `json:"hasLogo"`
+	LogoFile       string     `json:"logoFile,omitempty"`
+	Watermark      Watermark  `json:"watermark"`
+	PrimaryColor   string     `json:"primaryColor"`
+	SecondaryColor string     `json:"secondaryColor"`
+	Fonts          BrandFonts `json:"fonts"`
+	// IntroText is shown as a branded title over the opening seconds
+	IntroText string `json:"introText,omitempty"`
+	// OutroText and CTA make up the end card appended after the last segment
+	OutroText       string    `json:"outroText,omitempty"`
+	CTA             string    `json:"cta,omitempty"`
+	EndCardDuration float64   `json:"endCardDuration"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// HasEndCard reports whether an end card should be appended
+func (b *BrandKit) HasEndCard() bool {
+	return b.OutroText != "" || b.CTA != ""
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type TTSSegment struct {
 	Text     string `json:"text"`
 	Start    int    `json:"start"`
@@ -10,4 +12,41 @@ type TTSSegment struct {
 type TTSInput struct {
 	TextInput     []TextSegment `json:"textInput"`
 	VoiceSettings TTSVoice      `json:"voiceSettings"`
+	// Speed overrides the default speaking speed (1.0) when narration is regenerated to fit the timeline
+	Speed float64 `json:"speed,omitempty"`
+	// Lexicon fixes the pronunciation of listed words
+	Lexicon []LexiconEntry `json:"lexicon,omitempty"`
+	// VoiceID selects the provider voice; empty uses the default voice
+	VoiceID string `json:"voiceId,omitempty"`
+}
+
+// WordTiming is the spoken interval of one narration word, in seconds from narration start
+type WordTiming struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// TTSStats reports how a render's narration was obtained. Characters counts only the text
+// actually sent to the provider, so cache hits cost nothing.
+type TTSStats struct {
+	CacheHits   int `json:"cacheHits"`
+	CacheMisses int `json:"cacheMisses"`
+	Characters  int `json:"characters"`
+}
+
+// TTSSubscription is the provider account's character quota for the current billing period
+type TTSSubscription struct {
+	Tier           string     `json:"tier,omitempty"`
+	CharacterCount int64      `json:"characterCount"`
+	CharacterLimit int64      `json:"characterLimit"`
+	NextResetAt    *time.Time `json:"nextResetAt,omitempty"`
+	FetchedAt      time.Time  `json:"fetchedAt"`
+}
+
+// TTSUsage is what one user's renders spent on narration
+type TTSUsage struct {
+	Requests   int64 `json:"requests"`
+	CacheHits  int64 `json:"cacheHits"`
+	Characters int64 `json:"characters"`
 }
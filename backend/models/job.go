@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// JobStatus is the lifecycle state of a render job
+type JobStatus string
+
+const (
+	// JobGenerating waits for its composition from an async generator before it is queued
+	JobGenerating JobStatus = "generating"
+	JobQueued     JobStatus = "queued"
+	JobRunning    JobStatus = "running"
+	JobSucceeded  JobStatus = "succeeded"
+	JobFailed     JobStatus = "failed"
+	JobCanceled   JobStatus = "canceled"
+)
+
+// Finished reports whether the job reached a terminal state
+func (s JobStatus) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCanceled
+}
+
+// JobPriority orders queued renders; higher priorities are started first
+type JobPriority string
+
+const (
+	// PriorityLow is for free-tier and preview renders
+	PriorityLow JobPriority = "low"
+	// PriorityNormal is the default
+	PriorityNormal JobPriority = "normal"
+	// PriorityHigh is for paid-tier and final renders
+	PriorityHigh JobPriority = "high"
+)
+
+// Rank maps the priority onto an ordering; unknown values rank as normal
+func (p JobPriority) Rank() int {
+	switch p {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// RenderJob is the client-visible state of a scheduled render
+type RenderJob struct {
+	ID string `json:"id"`
+	// UserID is the X-User-ID the job was submitted under; empty for anonymous jobs
+	UserID   string      `json:"userId,omitempty"`
+	Status   JobStatus   `json:"status"`
+	Priority JobPriority `json:"priority"`
+	// QueuePosition is 1-based while the job is queued
+	QueuePosition int    `json:"queuePosition,omitempty"`
+	Error         string `json:"error,omitempty"`
+	// ErrorDetails holds ffmpeg output when the encode failed
+	ErrorDetails string        `json:"errorDetails,omitempty"`
+	Result       *RenderResult `json:"result,omitempty"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	StartedAt    *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time    `json:"finishedAt,omitempty"`
+}
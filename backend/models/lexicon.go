@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// LexiconEntry fixes how narration pronounces a word or phrase (brand names, SKUs). Phoneme is
+// used when the TTS model supports phoneme tags; otherwise Alias, a respelling that is read
+// instead, e.g. "Nye-key" for "Nike".
+type LexiconEntry struct {
+	Word    string `json:"word"`
+	Alias   string `json:"alias,omitempty"`
+	Phoneme string `json:"phoneme,omitempty"`
+	// Alphabet of Phoneme: "ipa" (default) or "cmu-arpabet"
+	Alphabet string `json:"alphabet,omitempty"`
+}
+
+// Lexicon is one user's pronunciation dictionary, applied to all of their renders
+type Lexicon struct {
+	Entries   []LexiconEntry `json:"entries"`
+	UpdatedAt *time.Time     `json:"updatedAt,omitempty"`
+}
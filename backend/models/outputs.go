@@ -1,6 +1,59 @@
 package models
 
+import "time"
+
 type Outputs struct {
 	VideoPath string `json:"video_path"`
 	AudioPath string `json:"audio_path"`
 }
+
+// ArtifactKind names one file produced by a render
+type ArtifactKind string
+
+const (
+	ArtifactVideo        ArtifactKind = "video"
+	ArtifactThumbnail    ArtifactKind = "thumbnail"
+	ArtifactPreviewGIF   ArtifactKind = "preview_gif"
+	ArtifactPreviewWebP  ArtifactKind = "preview_webp"
+	ArtifactProxy        ArtifactKind = "proxy"
+	ArtifactContactSheet ArtifactKind = "contact_sheet"
+	ArtifactSubtitlesSRT ArtifactKind = "subtitles_srt"
+	ArtifactSubtitlesVTT ArtifactKind = "subtitles_vtt"
+	ArtifactSubtitlesASS ArtifactKind = "subtitles_ass"
+	// ArtifactNarration is one TTS clip per narrated text segment
+	ArtifactNarration ArtifactKind = "narration"
+)
+
+// Artifact is a file produced by a render, addressable by URL
+type Artifact struct {
+	Kind ArtifactKind `json:"kind"`
+	Path string       `json:"-"`
+	// Key locates a kept artifact in storage; URL is then a signed link that expires at ExpiresAt
+	Key       string     `json:"key,omitempty"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Expired is set once retention removed the file
+	Expired     bool   `json:"expired,omitempty"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// RenderResult groups the main video and every derived artifact of a render
+type RenderResult struct {
+	ID        string     `json:"id"`
+	Artifacts []Artifact `json:"artifacts"`
+	// Images reports the ingested inputs in upload order
+	Images []ImageInfo `json:"images,omitempty"`
+	// TTS says whether the narration came from the TTS cache
+	TTS *TTSStats `json:"tts,omitempty"`
+}
+
+// Artifact returns the first artifact of the given kind, if any
+func (r *RenderResult) Artifact(kind ArtifactKind) (Artifact, bool) {
+	for _, a := range r.Artifacts {
+		if a.Kind == kind {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// CropMode selects how an image is fitted onto the output canvas
+type CropMode string
+
+const (
+	// CropModeFit letterboxes the whole image inside the canvas (default)
+	CropModeFit CropMode = "fit"
+	// CropModeFill scales the image to cover the canvas and crops around its focal point
+	CropModeFill CropMode = "fill"
+)
+
+// NarrationFit selects how narration and visuals are brought to the same length
+type NarrationFit string
+
+const (
+	// NarrationFitTempo time-stretches the narration (atempo) within bounds, then pads or trims it (default)
+	NarrationFitTempo NarrationFit = "atempo"
+	// NarrationFitRegenerate asks the TTS provider again at an adjusted speaking speed
+	NarrationFitRegenerate NarrationFit = "regenerate"
+	// NarrationFitReflow rescales the image and text segment durations to the narration
+	NarrationFitReflow NarrationFit = "reflow"
+	// NarrationFitNone leaves narration and timeline as they are
+	NarrationFitNone NarrationFit = "none"
+)
+
+// FocalPoint is a point of interest in normalized image coordinates (0..1, origin top-left)
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// ImageInfo describes an input image as seen by the builder
+type ImageInfo struct {
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	FocalPoint FocalPoint `json:"focalPoint"`
+	// Ingestion metadata: the upload as received, before orientation/downscaling
+	Format         string `json:"format,omitempty"`
+	Orientation    int    `json:"orientation,omitempty"`
+	OriginalWidth  int    `json:"originalWidth,omitempty"`
+	OriginalHeight int    `json:"originalHeight,omitempty"`
+	HasAlpha       bool   `json:"hasAlpha,omitempty"`
+	// Converted is set when the image was re-encoded during ingestion
+	Converted bool `json:"converted,omitempty"`
+	// Analysis for the generator: the colors covering most of the image (hex, most first), mean
+	// brightness from 0 (black) to 1 (white), and when and where the photo was taken per its EXIF
+	DominantColors []string   `json:"dominantColors,omitempty"`
+	Brightness     float64    `json:"brightness,omitempty"`
+	TakenAt        *time.Time `json:"takenAt,omitempty"`
+	Location       *GeoPoint  `json:"location,omitempty"`
+}
+
+// GeoPoint is a position in decimal degrees
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// RenderOptions carries client-supplied knobs that shape a single render
+type RenderOptions struct {
+	CropMode CropMode `json:"cropMode,omitempty"`
+	// FocalPoints overrides detection per image (same order as the uploaded images); nil entries are detected
+	FocalPoints []*FocalPoint `json:"focalPoints,omitempty"`
+	// Outputs lists extra artifacts to derive from the rendered video (the video itself is always produced)
+	Outputs []ArtifactKind `json:"outputs,omitempty"`
+	// ThumbnailSegment picks the image segment (in playback order) for the cover; nil picks the best frame
+	ThumbnailSegment *int `json:"thumbnailSegment,omitempty"`
+	// BurnCaptions renders captions from a generated ASS script (karaoke highlighted) instead of plain drawtext
+	BurnCaptions bool `json:"burnCaptions,omitempty"`
+	// BrandKitID applies a stored brand kit (watermark, colors, fonts, intro title, end card)
+	BrandKitID string `json:"brandKitId,omitempty"`
+	// Background ("#RRGGBB") replaces transparency in uploaded images; empty uses the configured default
+	Background string `json:"background,omitempty"`
+	// NarrationFit picks the strategy for narration that is longer or shorter than the timeline; empty means atempo
+	NarrationFit NarrationFit `json:"narrationFit,omitempty"`
+	// Lexicon is the submitting user's pronunciation dictionary, attached when the job is created
+	Lexicon []LexiconEntry `json:"lexicon,omitempty"`
+	// Language is the composition's language when it was localized (ISO 639-1, e.g. "es")
+	Language string `json:"language,omitempty"`
+	// VoiceID overrides the narration voice, e.g. with one native to Language
+	VoiceID string `json:"voiceId,omitempty"`
+	// Variant is set on the renders of an A/B variant group
+	Variant *VariantRef `json:"variant,omitempty"`
+	// AssetIDs names the input images when they come from the asset library, in image order
+	AssetIDs []string `json:"assetIds,omitempty"`
+}
+
+// NeedsCaptions reports whether caption cues have to be built for this render
+func (o RenderOptions) NeedsCaptions() bool {
+	return o.BurnCaptions || o.Wants(ArtifactSubtitlesSRT) || o.Wants(ArtifactSubtitlesVTT) || o.Wants(ArtifactSubtitlesASS)
+}
+
+// Wants reports whether the given extra artifact was requested
+func (o RenderOptions) Wants(kind ArtifactKind) bool {
+	for _, k := range o.Outputs {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package models
+
+// CompositionTemplate is a reusable reel structure: segment pacing, transitions,
+// text slots, style and music mood. Filling it with images and slot text yields a
+// VideoCompositionResponse for the regular compiler.
+type CompositionTemplate struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	AspectRatio string `json:"aspectRatio"`
+	Resolution  []int  `json:"resolution"`
+	Fps         string `json:"fps"`
+	Theme       struct {
+		Style   string `json:"style"`
+		Mood    string `json:"mood"`
+		Grading string `json:"grading"`
+	} `json:"theme"`
+	TextStyle TextStyle          `json:"textStyle"`
+	Segments  []TemplateSegment  `json:"segments"`
+	TextSlots []TemplateTextSlot `json:"textSlots"`
+	Music     struct {
+		Enabled bool    `json:"enabled"`
+		Genre   string  `json:"genre"`
+		Mood    string  `json:"mood"`
+		Volume  float64 `json:"volume"`
+	} `json:"music"`
+}
+
+// TemplateSegment is one image slot; images are assigned in upload order and wrap around
+type TemplateSegment struct {
+	Duration   int                    `json:"duration"`
+	Transition TransitionTimelineItem `json:"transition"`
+}
+
+// TemplateTextSlot is a named text placeholder, e.g. "hook", "story[0]" or "cta"
+type TemplateTextSlot struct {
+	Slot      string `json:"slot"`
+	StartTime int    `json:"startTime"`
+	Duration  int    `json:"duration"`
+	Position  string `json:"position"`
+	MaxLength int    `json:"maxLength"`
+	Required  bool   `json:"required"`
+	// Default is used when neither the client nor the AI supplies text
+	Default string `json:"default,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// VariantDimension is a composition parameter A/B variants of one reel can differ in
+type VariantDimension string
+
+const (
+	// VaryHook writes a different opening hook (the "hook" text segment) per variant
+	VaryHook VariantDimension = "hook"
+	// VaryMusic picks a different music genre and mood, and with them a different track
+	VaryMusic VariantDimension = "music"
+	// VaryTransition applies a different transition effect to every image segment
+	VaryTransition VariantDimension = "transition"
+	// VaryGrading applies a different color grading
+	VaryGrading VariantDimension = "grading"
+)
+
+// VariantParams are the parameters that set a variant apart; only the varied ones are set
+type VariantParams struct {
+	Hook       string `json:"hook,omitempty"`
+	MusicGenre string `json:"musicGenre,omitempty"`
+	MusicMood  string `json:"musicMood,omitempty"`
+	// MusicTrack is the title of the track the genre and mood select
+	MusicTrack string `json:"musicTrack,omitempty"`
+	Transition string `json:"transition,omitempty"`
+	Grading    string `json:"grading,omitempty"`
+}
+
+// VariantRef marks a render as one variant of a group generated from a single request
+type VariantRef struct {
+	Group  string        `json:"group"`
+	Index  int           `json:"index"`
+	Params VariantParams `json:"params"`
+}
+
+// RenderVariant reports one variant of a group: its job and, once rendered, the result
+type RenderVariant struct {
+	Index  int           `json:"index"`
+	Params VariantParams `json:"params"`
+	Job    RenderJob     `json:"job"`
+}
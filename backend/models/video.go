@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // VideoSource selects which generator pipeline to use
 type VideoSource string
 
@@ -14,6 +16,23 @@ type VideoGenerationRequest struct {
 	Images     [][]byte    `form:"image"`
 	ImageNames []string    `form:"image_name"`
 	Source     VideoSource `form:"source"`
+	// ImageContext describes the images (same order) so the generator can order and describe
+	// them and pick a grading; it may be empty
+	ImageContext []ImageContext `form:"-"`
+}
+
+// ImageContext is what the local pre-analysis found out about one input image
+type ImageContext struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Orientation is portrait, landscape or square, as the image is displayed
+	Orientation    string     `json:"orientation"`
+	DominantColors []string   `json:"dominantColors,omitempty"`
+	Brightness     float64    `json:"brightness"`
+	TakenAt        *time.Time `json:"takenAt,omitempty"`
+	Location       *GeoPoint  `json:"location,omitempty"`
 }
 
 type VideoSegment struct {
@@ -70,6 +70,8 @@ type TextSegment struct {
 	Position        string  `json:"position"`
 	NarrativeSource string  `json:"narrativeSource"`
 	ImageRef        *string `json:"imageRef,omitempty"`
+	// Emphasis overrides the voice's emphasis while this segment is narrated
+	Emphasis string `json:"emphasis,omitempty"`
 }
 
 type TextStyle struct {
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// AssetLibrary keeps users' reusable input images so clients upload a product photo once and
+// reference it by ID afterwards. Originals live in Storage under assets/<id><ext>; metadata,
+// the per-user content-hash index and the per-user listing index live in <DataDir>/assets.db.
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrInvalidTags   = errors.New("invalid tags")
+
+	assetsBucket      = []byte("assets")
+	assetHashesBucket = []byte("asset_hashes")
+	userAssetsBucket  = []byte("user_assets")
+)
+
+const (
+	maxAssetTags   = 32
+	maxAssetTagLen = 64
+)
+
+type AssetLibrary struct {
+	db      *bolt.DB
+	storage Storage
+}
+
+// OpenAssetLibrary opens (or creates) <DataDir>/assets.db
+func OpenAssetLibrary(cfg *config.APIConfig, storage Storage) (*AssetLibrary, error) {
+	if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %v", err)
+	}
+	db, err := bolt.Open(filepath.Join(cfg.DataDir, "assets.db"), 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open asset library: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{assetsBucket, assetHashesBucket, userAssetsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize asset library: %v", err)
+	}
+	return &AssetLibrary{db: db, storage: storage}, nil
+}
+
+func (al *AssetLibrary) Close() error {
+	return al.db.Close()
+}
+
+// Add stores a validated image file for userID. When the user already has an asset with the
+// same content, that asset is returned (with tags merged in) and created is false.
+func (al *AssetLibrary) Add(ctx context.Context, userID, name, localPath string, info models.ImageInfo, tags []string) (*models.Asset, bool, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, false, err
+	}
+	hash, size, err := fileSHA256(localPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing, err := al.mergeDuplicate(userID, hash, tags); existing != nil || err != nil {
+		return existing, false, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(localPath))
+	asset := &models.Asset{
+		ID:          NewID(),
+		UserID:      userID,
+		Name:        filepath.Base(name),
+		Hash:        hash,
+		ContentType: mime.TypeByExtension(ext),
+		Size:        size,
+		Width:       info.OriginalWidth,
+		Height:      info.OriginalHeight,
+		Tags:        tags,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if asset.Width == 0 {
+		asset.Width, asset.Height = info.Width, info.Height
+	}
+	asset.Key = "assets/" + asset.ID + ext
+	if err := PutFile(ctx, al.storage, asset.Key, localPath, asset.ContentType); err != nil {
+		return nil, false, err
+	}
+
+	// a concurrent upload of the same content may have won the race since the check above
+	var winner *models.Asset
+	err = al.db.Update(func(tx *bolt.Tx) error {
+		if id := tx.Bucket(assetHashesBucket).Get(assetHashKey(userID, hash)); id != nil {
+			a, err := getAsset(tx, string(id))
+			winner = a
+			return err
+		}
+		return putAsset(tx, asset)
+	})
+	if winner != nil || err != nil {
+		al.storage.Delete(context.Background(), asset.Key)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to save asset: %v", err)
+		}
+		existing, err := al.mergeDuplicate(userID, hash, tags)
+		return existing, false, err
+	}
+	return asset, true, nil
+}
+
+// mergeDuplicate returns the user's asset with this hash after adding tags to it, or nil
+func (al *AssetLibrary) mergeDuplicate(userID, hash string, tags []string) (*models.Asset, error) {
+	var asset *models.Asset
+	err := al.db.Update(func(tx *bolt.Tx) error {
+		id := tx.Bucket(assetHashesBucket).Get(assetHashKey(userID, hash))
+		if id == nil {
+			return nil
+		}
+		a, err := getAsset(tx, string(id))
+		if err != nil {
+			return err
+		}
+		if merged, _ := NormalizeTags(append(a.Tags, tags...)); len(merged) != len(a.Tags) {
+			a.Tags = merged
+			if err := putAsset(tx, a); err != nil {
+				return err
+			}
+		}
+		asset = a
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up asset: %v", err)
+	}
+	return asset, nil
+}
+
+// Get returns one of userID's assets
+func (al *AssetLibrary) Get(userID, id string) (*models.Asset, error) {
+	var asset *models.Asset
+	err := al.db.View(func(tx *bolt.Tx) error {
+		a, err := getAsset(tx, id)
+		asset = a
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if asset.UserID != userID {
+		return nil, ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// List returns userID's assets, newest first; an empty tag matches every asset
+func (al *AssetLibrary) List(userID, tag string, limit int) ([]models.Asset, error) {
+	var assets []models.Asset
+	prefix := append([]byte(userID), 0)
+	err := al.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(userAssetsBucket).Cursor()
+		k, v := c.Seek(append([]byte(userID), 1))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+			a, err := getAsset(tx, string(v))
+			if errors.Is(err, ErrAssetNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if tag != "" && !a.HasTag(tag) {
+				continue
+			}
+			assets = append(assets, *a)
+			if limit > 0 && len(assets) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assets: %v", err)
+	}
+	return assets, nil
+}
+
+// SetTags replaces an asset's tags
+func (al *AssetLibrary) SetTags(userID, id string, tags []string) (*models.Asset, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	var asset *models.Asset
+	err = al.db.Update(func(tx *bolt.Tx) error {
+		a, err := getAsset(tx, id)
+		if err != nil {
+			return err
+		}
+		if a.UserID != userID {
+			return ErrAssetNotFound
+		}
+		a.Tags = tags
+		asset = a
+		return putAsset(tx, a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// Delete removes an asset and its stored original. Renders already queued keep their own copy.
+func (al *AssetLibrary) Delete(ctx context.Context, userID, id string) error {
+	var key string
+	err := al.db.Update(func(tx *bolt.Tx) error {
+		a, err := getAsset(tx, id)
+		if err != nil {
+			return err
+		}
+		if a.UserID != userID {
+			return ErrAssetNotFound
+		}
+		key = a.Key
+		if err := tx.Bucket(assetsBucket).Delete([]byte(a.ID)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(assetHashesBucket).Delete(assetHashKey(a.UserID, a.Hash)); err != nil {
+			return err
+		}
+		return tx.Bucket(userAssetsBucket).Delete(userAssetKey(a))
+	})
+	if err != nil {
+		return err
+	}
+	return al.storage.Delete(ctx, key)
+}
+
+// Fetch downloads an asset's original into dir and returns the local path
+func (al *AssetLibrary) Fetch(ctx context.Context, asset *models.Asset, dir string) (string, error) {
+	local := filepath.Join(dir, asset.ID+filepath.Ext(asset.Key))
+	if err := FetchFile(ctx, al.storage, asset.Key, local); err != nil {
+		return "", fmt.Errorf("asset %s: %v", asset.ID, err)
+	}
+	return local, nil
+}
+
+// Sign fills a fresh download URL into a copy of the asset
+func (al *AssetLibrary) Sign(asset models.Asset, ttl time.Duration) (models.Asset, error) {
+	url, err := al.storage.SignedURL(asset.Key, ttl)
+	if err != nil {
+		return asset, err
+	}
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	asset.URL, asset.ExpiresAt = url, &expires
+	return asset, nil
+}
+
+// NormalizeTags lowercases, trims, de-duplicates and sorts tags
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > maxAssetTagLen || strings.ContainsAny(t, ",\x00") {
+			return nil, fmt.Errorf("%w: %q is too long or contains a comma", ErrInvalidTags, t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxAssetTags {
+		return nil, fmt.Errorf("%w: more than %d", ErrInvalidTags, maxAssetTags)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func getAsset(tx *bolt.Tx, id string) (*models.Asset, error) {
+	data := tx.Bucket(assetsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrAssetNotFound
+	}
+	var rec struct {
+		models.Asset
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Asset.Key = rec.Key
+	return &rec.Asset, nil
+}
+
+// putAsset writes the record and its indexes; Key is stored although it is hidden from clients
+func putAsset(tx *bolt.Tx, a *models.Asset) error {
+	stored := *a
+	stored.URL, stored.ExpiresAt = "", nil
+	data, err := json.Marshal(struct {
+		models.Asset
+		Key string `json:"key"`
+	}{stored, a.Key})
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(assetsBucket).Put([]byte(a.ID), data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(assetHashesBucket).Put(assetHashKey(a.UserID, a.Hash), []byte(a.ID)); err != nil {
+		return err
+	}
+	return tx.Bucket(userAssetsBucket).Put(userAssetKey(a), []byte(a.ID))
+}
+
+func assetHashKey(userID, hash string) []byte {
+	return append(append([]byte(userID), 0), hash...)
+}
+
+// userAssetKey orders a user's assets by creation time: user \x00 unix-nanos(8, big endian) id
+func userAssetKey(a *models.Asset) []byte {
+	key := append([]byte(a.UserID), 0)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(a.CreatedAt.UnixNano()))
+	key = append(key, ts[:]...)
+	return append(key, a.ID...)
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -4,6 +4,9 @@ import (
 	"social-media-ai-video/config"
 
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
 )
 
 type BackgroundMusic struct {
@@ -19,36 +22,96 @@ func NewBackgroundMusic(cfg *config.APIConfig) *BackgroundMusic {
 	return &BackgroundMusic{cfg: cfg}
 }
 
-// ResolveAndDownload treats trackIdOrURL as a direct URL for now.
-// Future: look up track by trackId/genre/mood via a catalog/service.
+// musicDir holds the bundled tracks; the image copies it next to the binary
+const musicDir = "music"
+
+// musicTrack is a bundled track and the schema genre and mood it is filed under
+type musicTrack struct {
+	file, genre, mood string
+}
+
+// musicCatalog files every track in musicDir under one of the schema's genres and moods. Add new
+// tracks here; each genre and mood pair of variantMusic needs a track of its own.
+var musicCatalog = []musicTrack{
+	{"Aurora%20on%20the%20Boulevard%20-%20National%20Sweetheart.mp3", "upbeat", "energetic"},
+	{"Baby%20Animals%20Playing%20-%20Joel%20Cummins.mp3", "minimal", "creative"},
+	{"Banjo%20Doops%20-%20Joel%20Cummins.mp3", "upbeat", "creative"},
+	{"Buckle%20Up%20-%20Jeremy%20Korpas.mp3", "upbeat", "energetic"},
+	{"Cafecito%20por%20la%20Manana%20-%20Cumbia%20Deli.mp3", "upbeat", "creative"},
+	{"Champion%20-%20Telecasted.mp3", "uplifting", "motivational"},
+	{"Crystaline%20-%20Quincas%20Moreira.mp3", "ambient", "peaceful"},
+	{"Curse%20of%20the%20Witches%20-%20Jimena%20Contreras.mp3", "minimal", "creative"},
+	{"Delayed%20Baggage%20-%20Ryan%20Stasik.mp3", "minimal", "creative"},
+	{"Final%20Soliloquy%20-%20Asher%20Fulero.mp3", "ambient", "peaceful"},
+	{"Heartbeat%20Of%20The%20Wind%20-%20Asher%20Fulero.mp3", "ambient", "peaceful"},
+	{"Honey%2C%20I%20Dismembered%20The%20Kids%20-%20Ezra%20Lipp.mp3", "minimal", "creative"},
+	{"Hopeful%20-%20Nat%20Keefe.mp3", "uplifting", "motivational"},
+	{"Hopeful%20Freedom%20-%20Asher%20Fulero.mp3", "uplifting", "peaceful"},
+	{"Hopeless%20-%20Jimena%20Contreras.mp3", "ambient", "peaceful"},
+	{"Jetski%20-%20Telecasted.mp3", "upbeat", "energetic"},
+	{"Like%20It%20Loud%20-%20Dyalla.mp3", "upbeat", "energetic"},
+	{"Name%20The%20Time%20And%20Place%20-%20Telecasted.mp3", "corporate", "professional"},
+	{"Night%20Hunt%20-%20Jimena%20Contreras.mp3", "minimal", "creative"},
+	{"No.2%20Remembering%20Her%20-%20Esther%20Abrami.mp3", "ambient", "peaceful"},
+	{"Oh%20Please%20-%20Telecasted.mp3", "corporate", "energetic"},
+	{"On%20The%20Hunt%20-%20Andrew%20Langdon.mp3", "corporate", "motivational"},
+	{"Organic%20Guitar%20House%20-%20Dyalla.mp3", "corporate", "professional"},
+	{"Phantom%20-%20Density%20%26%20Time.mp3", "minimal", "creative"},
+	{"Restless%20Heart%20-%20Jimena%20Contreras.mp3", "uplifting", "motivational"},
+	{"Seagull%20-%20Telecasted.mp3", "corporate", "professional"},
+	{"Sinister%20-%20Anno%20Domini%20Beats.mp3", "minimal", "energetic"},
+	{"Sly%20Sky%20-%20Telecasted.mp3", "upbeat", "creative"},
+	{"Touch%20-%20Anno%20Domini%20Beats.mp3", "minimal", "professional"},
+	{"Traversing%20-%20Godmode.mp3", "uplifting", "motivational"},
+	{"Twin%20Engines%20-%20Jeremy%20Korpas.mp3", "upbeat", "motivational"},
+}
+
+// CreateBackgroundMusic picks the bundled track for the composition's genre and mood
 func (b *BackgroundMusic) CreateBackgroundMusic(mood string, genre string) (*MusicFile, error) {
 	if mood == "" || genre == "" {
 		return nil, fmt.Errorf("empty mood/genre")
 	}
 
-	filePath, fileName, err := func(mood string, genre string) (string, string, error) {
-		//set this up later, but just invoke function for now; no actual logic
-		filePath, fileName, err := SelectMusicHelper(mood, genre)
-		if err != nil {
-			return "", "", err
-		}
-		fileName = "Aurora%20on%20the%20Boulevard%20-%20National%20Sweetheart.mp3"
-		filePath = "music/Aurora%20on%20the%20Boulevard%20-%20National%20Sweetheart.mp3"
-
-		return filePath, fileName, nil
-
-	}(mood, genre)
+	filePath, fileName, err := SelectMusicHelper(mood, genre)
 	if err != nil {
-		fmt.Errorf("failed to select music: %v", err)
-		panic(err)
+		return nil, fmt.Errorf("failed to select music: %v", err)
 	}
 
 	return &MusicFile{FilePath: filePath, FileName: fileName}, nil
 }
 
-/*
-Future logic to select specific mp3; for now just pull a particular one from library
-*/
+// SelectMusicHelper returns the path and file name of the first catalog track filed under both
+// genre and mood, else the first with the genre, else the first with the mood
 func SelectMusicHelper(mood string, genre string) (string, string, error) {
-	return "", "", nil
+	track, ok := selectTrack(genre, mood)
+	if !ok {
+		return "", "", fmt.Errorf("no track for genre %q or mood %q", genre, mood)
+	}
+	return filepath.Join(musicDir, track.file), track.file, nil
+}
+
+func selectTrack(genre, mood string) (musicTrack, bool) {
+	best, bestScore := musicTrack{}, 0
+	for _, t := range musicCatalog {
+		score := 0
+		if t.genre == genre {
+			score += 2
+		}
+		if t.mood == mood {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// trackTitle is a track's "Title - Artist" without the URL escaping of its file name
+func trackTitle(file string) string {
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	if title, err := url.PathUnescape(name); err == nil {
+		return title
+	}
+	return name
 }
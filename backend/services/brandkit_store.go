@@ -0,0 +1,223 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// BrandKitStore persists brand kits as <DataDir>/brand_kits/<id>/kit.json with the logo alongside.
+// Small JSON files are enough here: kits are few, rarely written and read once per render.
+
+var ErrBrandKitNotFound = errors.New("brand kit not found")
+
+var hexColorRe = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+type BrandKitStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+func NewBrandKitStore(cfg *config.APIConfig) *BrandKitStore {
+	return &BrandKitStore{dir: filepath.Join(cfg.DataDir, "brand_kits")}
+}
+
+// Create validates and stores a new kit owned by userID; logo may be nil. logoExt is the logo
+// file extension (".png", ...).
+func (s *BrandKitStore) Create(userID string, kit models.BrandKit, logo io.Reader, logoExt string) (*models.BrandKit, error) {
+	if err := normalizeBrandKit(&kit); err != nil {
+		return nil, err
+	}
+	kit.ID = NewID()
+	kit.UserID = userID
+	kit.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kitDir := filepath.Join(s.dir, kit.ID)
+	if err := os.MkdirAll(kitDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create brand kit dir: %v", err)
+	}
+	if logo != nil {
+		kit.LogoFile = "logo" + logoExt
+		out, err := os.Create(filepath.Join(kitDir, kit.LogoFile))
+		if err != nil {
+			os.RemoveAll(kitDir)
+			return nil, fmt.Errorf("failed to create logo file: %v", err)
+		}
+		_, err = io.Copy(out, logo)
+		out.Close()
+		if err != nil {
+			os.RemoveAll(kitDir)
+			return nil, fmt.Errorf("failed to write logo file: %v", err)
+		}
+		kit.HasLogo = true
+	}
+	if err := s.write(&kit); err != nil {
+		os.RemoveAll(kitDir)
+		return nil, err
+	}
+	return &kit, nil
+}
+
+// Get returns one of userID's kits; other users' kits are not found
+func (s *BrandKitStore) Get(userID, id string) (*models.BrandKit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readOwned(userID, id)
+}
+
+// load returns a kit whatever its owner, for renders whose kit was checked when the job was
+// submitted
+func (s *BrandKitStore) load(id string) (*models.BrandKit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.read(id)
+}
+
+// LogoPath returns the on-disk logo of a kit, or "" when it has none
+func (s *BrandKitStore) LogoPath(kit *models.BrandKit) string {
+	if !kit.HasLogo || kit.LogoFile == "" {
+		return ""
+	}
+	return filepath.Join(s.dir, kit.ID, kit.LogoFile)
+}
+
+// List returns userID's kits, oldest first
+func (s *BrandKitStore) List(userID string) ([]models.BrandKit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.BrandKit{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list brand kits: %v", err)
+	}
+	kits := []models.BrandKit{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		kit, err := s.read(e.Name())
+		if err != nil || kit.UserID != userID {
+			continue
+		}
+		kits = append(kits, *kit)
+	}
+	sort.Slice(kits, func(i, j int) bool { return kits[i].CreatedAt.Before(kits[j].CreatedAt) })
+	return kits, nil
+}
+
+// Delete removes one of userID's kits and its logo
+func (s *BrandKitStore) Delete(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.readOwned(userID, id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+func (s *BrandKitStore) readOwned(userID, id string) (*models.BrandKit, error) {
+	kit, err := s.read(id)
+	if err != nil {
+		return nil, err
+	}
+	if kit.UserID != userID {
+		return nil, ErrBrandKitNotFound
+	}
+	return kit, nil
+}
+
+func (s *BrandKitStore) read(id string) (*models.BrandKit, error) {
+	if !isSafeID(id) {
+		return nil, ErrBrandKitNotFound
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir, id, "kit.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBrandKitNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read brand kit: %v", err)
+	}
+	var kit models.BrandKit
+	if err := json.Unmarshal(b, &kit); err != nil {
+		return nil, fmt.Errorf("corrupt brand kit %s: %v", id, err)
+	}
+	return &kit, nil
+}
+
+func (s *BrandKitStore) write(kit *models.BrandKit) error {
+	b, err := json.MarshalIndent(kit, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal brand kit: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, kit.ID, "kit.json"), b, 0o644); err != nil {
+		return fmt.Errorf("failed to write brand kit: %v", err)
+	}
+	return nil
+}
+
+// normalizeBrandKit validates colors/positions and fills defaults
+func normalizeBrandKit(kit *models.BrandKit) error {
+	if kit.Name == "" {
+		return fmt.Errorf("brand kit name is required")
+	}
+	if kit.PrimaryColor == "" {
+		kit.PrimaryColor = "#FFFFFF"
+	}
+	if kit.SecondaryColor == "" {
+		kit.SecondaryColor = "#000000"
+	}
+	for _, c := range []string{kit.PrimaryColor, kit.SecondaryColor} {
+		if !hexColorRe.MatchString(c) {
+			return fmt.Errorf("invalid color %q (expected #RRGGBB)", c)
+		}
+	}
+	switch kit.Watermark.Position {
+	case "":
+		kit.Watermark.Position = models.WatermarkBottomRight
+	case models.WatermarkTopLeft, models.WatermarkTopRight, models.WatermarkBottomLeft, models.WatermarkBottomRight:
+	default:
+		return fmt.Errorf("invalid watermark position %q", kit.Watermark.Position)
+	}
+	if kit.Watermark.Opacity <= 0 || kit.Watermark.Opacity > 1 {
+		kit.Watermark.Opacity = 0.8
+	}
+	if kit.Watermark.Scale <= 0 || kit.Watermark.Scale > 1 {
+		kit.Watermark.Scale = 0.18
+	}
+	if kit.EndCardDuration <= 0 {
+		kit.EndCardDuration = 3
+	}
+	if kit.EndCardDuration > 10 {
+		return fmt.Errorf("end card duration must be at most 10 seconds")
+	}
+	return nil
+}
+
+// isSafeID guards path joins against traversal; IDs are NewID hex strings
+func isSafeID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
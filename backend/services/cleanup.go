@@ -0,0 +1,77 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"social-media-ai-video/config"
+)
+
+// Startup bookkeeping: anything an interrupted process left behind (upload workspaces,
+// narration audio, half-written renders) is removed before the scheduler starts. These dirs
+// may be shared with other API instances or render workers on the same host, so only entries
+// too old to belong to any live request or render are treated as leftovers.
+
+// incompleteMarker sits in a kept render dir until the render succeeds
+const incompleteMarker = ".incomplete"
+
+// CleanupOrphans removes leftovers of a previous process: upload workspaces not owned by a
+// resumed job, narration audio and render dirs still marked incomplete. Workspaces younger than
+// a request can live (waiting for a composition, then rendering) and narration and render dirs
+// younger than the job timeout may belong to another process and stay.
+func CleanupOrphans(cfg *config.APIConfig, resumed []JobRecord) {
+	olderThan := func(path string, age time.Duration) bool {
+		info, err := os.Stat(path)
+		return err == nil && info.ModTime().Before(time.Now().Add(-age))
+	}
+	workspaceAge := cfg.N8NCallbackTimeout + cfg.N8NTimeout + cfg.JobTimeout
+	keep := map[string]bool{}
+	for _, j := range resumed {
+		keep[filepath.Clean(j.Task.WorkspaceDir)] = true
+	}
+	removed := 0
+
+	if entries, err := os.ReadDir(cfg.UploadDir); err == nil {
+		for _, e := range entries {
+			dir := filepath.Join(cfg.UploadDir, e.Name())
+			if e.IsDir() && strings.HasPrefix(e.Name(), "ws_") && !keep[filepath.Clean(dir)] && olderThan(dir, workspaceAge) {
+				if os.RemoveAll(dir) == nil {
+					removed++
+				}
+			}
+		}
+	}
+
+	if entries, err := os.ReadDir(ttsTempDir()); err == nil {
+		for _, e := range entries {
+			path := filepath.Join(ttsTempDir(), e.Name())
+			if olderThan(path, cfg.JobTimeout) && os.RemoveAll(path) == nil {
+				removed++
+			}
+		}
+	}
+
+	if entries, err := os.ReadDir(cfg.RenderOutputDir); err == nil {
+		for _, e := range entries {
+			dir := filepath.Join(cfg.RenderOutputDir, e.Name())
+			marker := filepath.Join(dir, incompleteMarker)
+			if olderThan(marker, cfg.JobTimeout) {
+				if os.RemoveAll(dir) == nil {
+					removed++
+				}
+			}
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("startup cleanup: removed %d orphaned temp artifacts", removed)
+	}
+}
+
+// ttsTempDir is where narration audio is written during compilation
+func ttsTempDir() string {
+	return filepath.Join(os.TempDir(), "tts_audio")
+}
@@ -1,53 +1,132 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"social-media-ai-video/config"
-	"social-media-ai-video/models"
-
-	//"time"
-	"bytes"
 	"io"
 	"mime/multipart"
 	"net/http"
+
+	"social-media-ai-video/config"
+	"social-media-ai-video/models"
 )
 
-type ContentGenerator struct {
+// CompositionGenerator writes a video composition (schema/video_composition.json) for a prompt and images
+type CompositionGenerator interface {
+	// Generate returns the raw composition JSON, checked against the schema; ParseComposition reads it
+	Generate(ctx context.Context, videoRequest models.VideoGenerationRequest) ([]byte, error)
+}
+
+// NewCompositionGenerator returns the generator selected by cfg.Generator. Every generator
+// checks its output against schema and fails with ErrSchemaMismatch when it does not match.
+func NewCompositionGenerator(cfg *config.APIConfig, schema *JSONSchema) (CompositionGenerator, error) {
+	switch cfg.Generator {
+	case "n8n":
+		return NewN8NGenerator(cfg, schema), nil
+	case "openai":
+		return NewOpenAIGenerator(cfg, schema), nil
+	case "rules":
+		return NewRuleGenerator(schema), nil
+	}
+	return nil, fmt.Errorf("unknown GENERATOR %q (expected n8n, openai or rules)", cfg.Generator)
+}
+
+// GenerateComposition runs the generator and parses its composition
+func GenerateComposition(ctx context.Context, g CompositionGenerator, videoRequest models.VideoGenerationRequest) (*models.VideoCompositionResponse, error) {
+	respBytes, err := g.Generate(ctx, videoRequest)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseComposition(respBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode upstream response: %v", err)
+	}
+	return parsed, nil
+}
+
+// AsyncCompositionGenerator can also deliver the composition later: the generator acknowledges
+// the request and posts the composition for jobID to the callback webhook
+type AsyncCompositionGenerator interface {
+	CompositionGenerator
+	GenerateAsync(ctx context.Context, videoRequest models.VideoGenerationRequest, jobID string) error
+}
+
+// N8NGenerator hands the request to the n8n workflow of its source. Requests carry the API key
+// and are signed with N8NSigningSecret when set.
+type N8NGenerator struct {
 	config *config.APIConfig
+	schema *JSONSchema
+}
+
+func NewN8NGenerator(cfg *config.APIConfig, schema *JSONSchema) *N8NGenerator {
+	return &N8NGenerator{config: cfg, schema: schema}
 }
 
-func NewContentGenerator(cfg *config.APIConfig) *ContentGenerator {
-	return &ContentGenerator{config: cfg}
+// Generate streams prompt + images to the selected source webhook as multipart/form-data and
+// returns the raw response body. The call is bounded by ctx and the configured N8N timeout.
+func (ng *N8NGenerator) Generate(ctx context.Context, videoRequest models.VideoGenerationRequest) ([]byte, error) {
+	respBytes, err := ng.post(ctx, videoRequest, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ng.schema.ValidateComposition(respBytes); err != nil {
+		return nil, fmt.Errorf("n8n generator: %w", err)
+	}
+	return respBytes, nil
 }
 
-// GenerateShortVideo posts the prompt to N8N, extracts the returned video id,
-// fetches the short video from the configured base URL, saves it under ./tmp,
-// and returns the saved filename (basename).
-// GenerateVideoMultipart streams prompt + images to the selected source webhook as multipart/form-data.
-// It posts to the appropriate N8N URL based on the given VideoSource and returns the parsed response.
-func (cg *ContentGenerator) GenerateVideoSchemaMultipart(videoRequest models.VideoGenerationRequest) (*models.VideoCompositionResponse, error) {
+// GenerateAsync sends the request along with job_id and callback_url; the workflow answers right
+// away and posts {"jobId", "composition"} (or {"jobId", "error"}) to the callback URL when done
+func (ng *N8NGenerator) GenerateAsync(ctx context.Context, videoRequest models.VideoGenerationRequest, jobID string) error {
+	if ng.config.N8NCallbackURL == "" {
+		return fmt.Errorf("N8N callback URL not configured")
+	}
+	_, err := ng.post(ctx, videoRequest, map[string]string{"job_id": jobID, "callback_url": ng.config.N8NCallbackURL})
+	return err
+}
+
+// post sends the multipart request with any extra fields and returns the response body
+func (ng *N8NGenerator) post(ctx context.Context, videoRequest models.VideoGenerationRequest, fields map[string]string) ([]byte, error) {
 	var targetURL string
 	switch videoRequest.Source {
 	case models.VideoSourceReels:
-		targetURL = cg.config.N8NREELSURL
+		targetURL = ng.config.N8NREELSURL
 	case models.VideoSourcePexels:
-		targetURL = cg.config.N8NPLEXELSURL
+		targetURL = ng.config.N8NPLEXELSURL
 	default:
 		return nil, fmt.Errorf("unknown video source: %s", string(videoRequest.Source))
 	}
+	if targetURL == "" {
+		return nil, fmt.Errorf("N8N URL for source %s not configured", videoRequest.Source)
+	}
 
 	var body bytes.Buffer
 	mw := multipart.NewWriter(&body)
 	if err := mw.WriteField("prompt", videoRequest.Prompt); err != nil {
 		return nil, fmt.Errorf("failed to write prompt field: %v", err)
 	}
+	for _, name := range []string{"job_id", "callback_url"} {
+		if v, ok := fields[name]; ok {
+			if err := mw.WriteField(name, v); err != nil {
+				return nil, fmt.Errorf("failed to write %s field: %v", name, err)
+			}
+		}
+	}
+	// the pre-analysis of all images as one JSON array, in image order
+	if len(videoRequest.ImageContext) > 0 {
+		imageContext, err := json.Marshal(videoRequest.ImageContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal image context: %v", err)
+		}
+		if err := mw.WriteField("image_context", string(imageContext)); err != nil {
+			return nil, fmt.Errorf("failed to write image_context field: %v", err)
+		}
+	}
 	// Append each image as a repeated 'image' part and include matching 'image_name' fields
 	for idx, img := range videoRequest.Images {
-		name := fmt.Sprintf("image_%d.jpg", idx+1)
-		if idx < len(videoRequest.ImageNames) && videoRequest.ImageNames[idx] != "" {
-			name = videoRequest.ImageNames[idx]
-		}
+		name := imageName(videoRequest, idx)
 		if err := mw.WriteField("image_name", name); err != nil {
 			return nil, fmt.Errorf("failed to write image_name field: %v", err)
 		}
@@ -63,11 +142,14 @@ func (cg *ContentGenerator) GenerateVideoSchemaMultipart(videoRequest models.Vid
 		return nil, fmt.Errorf("failed to close multipart writer: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", targetURL, &body)
+	ctx, cancel := context.WithTimeout(ctx, ng.config.N8NTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(body.Bytes()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", mw.FormDataContentType())
+	signN8NRequest(req, ng.config.N8NAPIKey, ng.config.N8NSigningSecret, body.Bytes())
 
 	//this right here seems to be assuming that the return data
 	//is also multipart/form; could be source of error, need
@@ -77,14 +159,20 @@ func (cg *ContentGenerator) GenerateVideoSchemaMultipart(videoRequest models.Vid
 		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
 	defer resp.Body.Close()
-	respBytes, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 300 {
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upstream response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return nil, fmt.Errorf("upstream error: %s - %s", resp.Status, string(respBytes))
 	}
+	return respBytes, nil
+}
 
-	var parsed models.VideoCompositionResponse
-	if err := json.Unmarshal(respBytes, &parsed); err != nil {
-		return nil, fmt.Errorf("failed to decode upstream response: %v", err)
+// imageName is the upload name of image idx, or a generated one
+func imageName(videoRequest models.VideoGenerationRequest, idx int) string {
+	if idx < len(videoRequest.ImageNames) && videoRequest.ImageNames[idx] != "" {
+		return videoRequest.ImageNames[idx]
 	}
-	return &parsed, nil
+	return fmt.Sprintf("image_%d.jpg", idx+1)
 }
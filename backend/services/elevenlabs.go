@@ -1,21 +1,35 @@
 package services
 
 import (
-	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"social-media-ai-video/config"
 	"social-media-ai-video/models"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 type ElevenLabsService struct {
-	config *config.APIConfig
+	config  *config.APIConfig
+	cache   *TTSCache
+	client  *http.Client
+	limiter *rate.Limiter
+	// slots caps concurrent API calls
+	slots chan struct{}
+
+	mu         sync.Mutex
+	sub        models.TTSSubscription
+	subErr     error
+	subFetched time.Time
+	usage      map[string]models.TTSUsage
 }
 
 type TTSRequest struct {
@@ -25,101 +39,200 @@ type TTSRequest struct {
 }
 
 func NewElevenLabsService(cfg *config.APIConfig) *ElevenLabsService {
-	return &ElevenLabsService{config: cfg}
-}
-
-// GenerateSpeechToTmp generates TTS audio and writes it under tmpDir.
-// Returns the absolute output path and the filename.
-// generates a set of audio files, used for concatenated in ffmpeg
-func (els *ElevenLabsService) GenerateSpeechToTmp(input models.TTSInput, tmpDir string) (filenames []string, fileoutputmap map[string]string, err error) {
-	// Buffer for text-to-speech parts
-	var parts []string
-	//exact outpath paths into TmpDir
-	//exact filenames; prefixed with elevenlabs_
-	var flnames []string
-	var filetomap map[string]string = make(map[string]string)
-
-	for _, seg := range input.TextInput {
-		if strings.TrimSpace(seg.Text) != "" {
-			parts = append(parts, seg.Text)
-		}
+	return &ElevenLabsService{
+		config:  cfg,
+		cache:   NewTTSCache(cfg),
+		client:  &http.Client{Timeout: cfg.TTSTimeout},
+		limiter: newTTSLimiter(cfg.TTSRatePerMinute, cfg.TTSMaxConcurrent),
+		slots:   make(chan struct{}, max(cfg.TTSMaxConcurrent, 1)),
+		usage:   map[string]models.TTSUsage{},
 	}
+}
 
-	text := strings.Join(parts, " ")
-
-	payload := TTSRequest{
-		Text:    text,
-		ModelID: "eleven_multilingual_v2",
-		VoiceSettings: map[string]interface{}{
-			"stability":        input.VoiceSettings.Stability,
-			"similarity_boost": 0.5,
-			"speed":            1.0,
-		},
-		//|| input.VoiceSettings.Speed, add this later perhaps
+// GenerateSpeechToTmp narrates input into an MP3 under tmpDir. It returns the clip file names
+// in play order (concatenated by ffmpeg), a map from each name to its full path, and stats on
+// whether the audio came from the TTS cache, which serves identical text and voice settings.
+func (els *ElevenLabsService) GenerateSpeechToTmp(ctx context.Context, input models.TTSInput, tmpDir string) (filenames []string, fileoutputmap map[string]string, stats models.TTSStats, err error) {
+	// markup, lexicon and emphasis are applied here; see speech_text.go
+	payload, _ := els.speechRequest(input)
+	outputPath, _, err := els.synthesize(ctx, payload, ttsVoiceID(input), false, tmpDir, &stats)
+	if err != nil {
+		return []string{}, map[string]string{}, stats, err
 	}
+	filename := filepath.Base(outputPath)
+	return []string{filename}, map[string]string{filename: outputPath}, stats, nil
+}
 
+// synthesize runs one TTS request through the cache, quota check and API, saving the audio
+// under tmpDir. timed uses the with-timestamps endpoint and returns the spoken words' timings.
+func (els *ElevenLabsService) synthesize(ctx context.Context, payload TTSRequest, voiceID string, timed bool, tmpDir string, stats *models.TTSStats) (string, []models.WordTiming, error) {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return []string{}, map[string]string{}, fmt.Errorf("failed to marshal TTS request: %v", err)
+		return "", nil, fmt.Errorf("failed to marshal TTS request: %v", err)
+	}
+	if tmpDir == "" {
+		return "", nil, fmt.Errorf("tmpDir is empty")
+	}
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", nil, fmt.Errorf("failed to create temp dir: %v", err)
 	}
 
-	// For now, hardcode the voice ID
-	voiceId := "tvWD4i07Hg5L4uEvbxYV"
+	cacheKey := TTSCacheKey(voiceID, payload)
+	if outputPath, words, ok := els.cache.Get(cacheKey, tmpDir, timed); ok {
+		els.account(ctx, 0, true)
+		stats.CacheHits++
+		return outputPath, words, nil
+	}
+	stats.CacheMisses++
 
-	url := fmt.Sprintf("%s/text-to-speech/%s", els.config.ElevenLabsBaseURL, voiceId)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	chars := len([]rune(payload.Text))
+	if err := els.checkQuota(ctx, chars); err != nil {
+		return "", nil, err
+	}
+	path, accept := "/text-to-speech/"+voiceID, "audio/mpeg"
+	if timed {
+		path, accept = path+"/with-timestamps", "application/json"
+	}
+	body, err := els.call(ctx, http.MethodPost, path, accept, jsonData)
 	if err != nil {
-		return []string{}, map[string]string{}, fmt.Errorf("failed to create TTS request: %v", err)
+		els.quotaExhausted(err)
+		return "", nil, err
 	}
+	els.account(ctx, chars, false)
+	stats.Characters += chars
 
-	req.Header.Set("Accept", "audio/mpeg")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("xi-api-key", els.config.ElevenLabsAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return []string{}, map[string]string{}, fmt.Errorf("failed to make TTS request: %v", err)
+	audio, words := body, []models.WordTiming(nil)
+	if timed {
+		if audio, words, err = decodeTimedSpeech(body); err != nil {
+			return "", nil, err
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return []string{}, map[string]string{}, fmt.Errorf("TTS API returned status %d: %s", resp.StatusCode, string(body))
+	outputPath := filepath.Join(tmpDir, fmt.Sprintf("audio_%d.mp3", time.Now().UnixNano()))
+	if err := os.WriteFile(outputPath, audio, 0o644); err != nil {
+		return "", nil, fmt.Errorf("failed to save audio file: %v", err)
 	}
+	els.cache.Put(cacheKey, outputPath, words)
+	return outputPath, words, nil
+}
 
-	/*
-		GUARDS
+// defaultTTSVoice narrates unless a localized render picked a voice for its language
+const defaultTTSVoice = "tvWD4i07Hg5L4uEvbxYV"
 
-	*/
-	if tmpDir == "" {
-		return []string{}, map[string]string{}, fmt.Errorf("tmpDir is empty")
+func ttsVoiceID(input models.TTSInput) string {
+	if input.VoiceID != "" {
+		return input.VoiceID
 	}
-	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
-		return []string{}, map[string]string{}, fmt.Errorf("failed to create temp dir: %v", err)
+	return defaultTTSVoice
+}
+
+// speechRequest builds the request for input's narrated segments, returning how the spoken words
+// map back to the shown ones
+func (els *ElevenLabsService) speechRequest(input models.TTSInput) (TTSRequest, []wordGroup) {
+	model := els.config.ElevenLabsModelID
+	if model == "" {
+		model = defaultTTSModel
 	}
+	text, groups := speechText(input.TextInput, input.Lexicon, phonemeModels[model])
+	return newTTSRequest(text, model, input.VoiceSettings, input.Speed), groups
+}
 
-	/*
-		GUARDS
+// newTTSRequest builds the request body; speed <= 0 keeps the default 1.0. The voice's emphasis
+// adjusts stability and style; style is only sent when set so plain requests keep their cache keys.
+func newTTSRequest(text, model string, voice models.TTSVoice, speed float64) TTSRequest {
+	if speed <= 0 {
+		speed = 1.0
+	}
+	stability, style := emphasisSettings(voice.Emphasis, voice.Stability)
+	settings := map[string]interface{}{
+		"stability":        stability,
+		"similarity_boost": 0.5,
+		"speed":            speed,
+	}
+	if style > 0 {
+		settings["style"] = style
+	}
+	return TTSRequest{
+		Text:          text,
+		ModelID:       model,
+		VoiceSettings: settings,
+	}
+}
 
-	*/
+// ttsWithTimestampsResponse mirrors the /with-timestamps endpoint; alignment is per input character
+type ttsWithTimestampsResponse struct {
+	AudioBase64 string `json:"audio_base64"`
+	Alignment   *struct {
+		Characters []string  `json:"characters"`
+		StartTimes []float64 `json:"character_start_times_seconds"`
+		EndTimes   []float64 `json:"character_end_times_seconds"`
+	} `json:"alignment"`
+}
 
-	filename := fmt.Sprintf("audio_%d.mp3", time.Now().UnixNano())
-	outputPath := filepath.Join(tmpDir, filename)
-	file, err := os.Create(outputPath)
+// GenerateSpeechWithTimestamps behaves like GenerateSpeechToTmp but uses the with-timestamps
+// endpoint so the narration comes back with per-word timings (used for caption cues).
+func (els *ElevenLabsService) GenerateSpeechWithTimestamps(ctx context.Context, input models.TTSInput, tmpDir string) ([]string, map[string]string, []models.WordTiming, models.TTSStats, error) {
+	var stats models.TTSStats
+	payload, groups := els.speechRequest(input)
+	// the cache keeps the spoken words; they are mapped to the shown words on the way out
+	outputPath, words, err := els.synthesize(ctx, payload, ttsVoiceID(input), true, tmpDir, &stats)
 	if err != nil {
-		return []string{}, map[string]string{}, fmt.Errorf("failed to create audio file: %v", err)
+		return nil, nil, nil, stats, err
 	}
-	defer file.Close()
+	filename := filepath.Base(outputPath)
+	return []string{filename}, map[string]string{filename: outputPath}, displayWordTimings(words, groups), stats, nil
+}
 
-	_, err = io.Copy(file, resp.Body)
+// decodeTimedSpeech splits a with-timestamps response into audio and spoken-word timings. The
+// timings are non-nil even without alignment, so the cache remembers this was a timed request.
+func decodeTimedSpeech(body []byte) ([]byte, []models.WordTiming, error) {
+	var parsed ttsWithTimestampsResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode TTS response: %v", err)
+	}
+	audio, err := base64.StdEncoding.DecodeString(parsed.AudioBase64)
 	if err != nil {
-		return []string{}, map[string]string{}, fmt.Errorf("failed to save audio file: %v", err)
+		return nil, nil, fmt.Errorf("failed to decode TTS audio: %v", err)
 	}
+	words := []models.WordTiming{}
+	if a := parsed.Alignment; a != nil && len(a.StartTimes) == len(a.Characters) && len(a.EndTimes) == len(a.Characters) {
+		words = append(words, wordsFromAlignment(a.Characters, a.StartTimes, a.EndTimes)...)
+	}
+	return audio, words, nil
+}
 
-	filetomap[filename] = outputPath
-	flnames = append(flnames, filename)
-
-	//set up mapping structure; want to split voice files up eventually... perhaps?
-	return flnames, filetomap, nil
+// wordsFromAlignment groups character timings into whitespace-separated words, skipping the
+// characters of break and phoneme tags
+func wordsFromAlignment(chars []string, starts, ends []float64) []models.WordTiming {
+	var words []models.WordTiming
+	var cur strings.Builder
+	var start, end float64
+	inTag := false
+	flush := func() {
+		if cur.Len() > 0 {
+			words = append(words, models.WordTiming{Word: cur.String(), Start: start, End: end})
+			cur.Reset()
+		}
+	}
+	for i, ch := range chars {
+		switch {
+		case ch == "<":
+			inTag = true
+			continue
+		case inTag:
+			inTag = ch != ">"
+			continue
+		}
+		if strings.TrimSpace(ch) == "" {
+			flush()
+			continue
+		}
+		if cur.Len() == 0 {
+			start = starts[i]
+		}
+		cur.WriteString(ch)
+		end = ends[i]
+	}
+	flush()
+	return words
 }
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	models "social-media-ai-video/models"
+)
+
+// ElevenLabs HTTP plumbing shared by every TTS call: one pooled client behind a client-side rate
+// limiter and concurrency cap, retries with backoff for rate limits and server errors, typed
+// errors, and character accounting against the subscription quota. Counters are published
+// through expvar under "tts".
+
+var (
+	ErrTTSAuth      = errors.New("tts authentication failed")
+	ErrTTSQuota     = errors.New("tts character quota exceeded")
+	ErrTTSTransient = errors.New("tts provider temporarily unavailable")
+	ErrTTSRejected  = errors.New("tts request rejected")
+
+	ttsErrorKinds = []error{ErrTTSAuth, ErrTTSQuota, ErrTTSTransient, ErrTTSRejected}
+)
+
+var ttsMetrics = expvar.NewMap("tts")
+
+const (
+	maxTTSBackoff = 30 * time.Second
+	// subscriptionMaxAge is how long a fetched quota is trusted; local accounting covers the gap
+	subscriptionMaxAge = 5 * time.Minute
+)
+
+// TTSError is a failed ElevenLabs call; errors.Is matches its Kind (ErrTTSAuth, ErrTTSQuota,
+// ErrTTSTransient or ErrTTSRejected). Only transient errors are retried.
+type TTSError struct {
+	Kind       error
+	StatusCode int
+	Message    string
+	// RetryAfter is the provider's Retry-After hint, if it sent one
+	RetryAfter time.Duration
+}
+
+func (e *TTSError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%v: TTS API returned status %d: %s", e.Kind, e.StatusCode, e.Message)
+}
+
+func (e *TTSError) Unwrap() error { return e.Kind }
+
+type ttsUserKey struct{}
+
+// WithTTSUser attributes the TTS characters spent under ctx to userID
+func WithTTSUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, ttsUserKey{}, userID)
+}
+
+func ttsUser(ctx context.Context) string {
+	userID, _ := ctx.Value(ttsUserKey{}).(string)
+	return userID
+}
+
+func newTTSLimiter(perMinute, burst int) *rate.Limiter {
+	if perMinute <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(float64(perMinute)/60), max(burst, 1))
+}
+
+// call sends one API request, retrying transient failures with backoff, and returns the response body
+func (els *ElevenLabsService) call(ctx context.Context, method, path, accept string, body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := els.attempt(ctx, method, path, accept, body)
+		if err == nil {
+			return data, nil
+		}
+		var ttsErr *TTSError
+		if !errors.As(err, &ttsErr) {
+			return nil, err
+		}
+		if !errors.Is(err, ErrTTSTransient) || attempt >= els.config.TTSMaxRetries {
+			countTTSError(ttsErr)
+			return nil, err
+		}
+		delay := ttsBackoff(els.config.TTSRetryBaseDelay, attempt, ttsErr.RetryAfter)
+		log.Printf("tts: %v; retrying in %s", err, delay.Round(time.Millisecond))
+		ttsMetrics.Add("retries", 1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (els *ElevenLabsService) attempt(ctx context.Context, method, path, accept string, body []byte) ([]byte, error) {
+	if err := els.limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// the next token would only arrive after the deadline
+		return nil, fmt.Errorf("tts rate limit: %w", context.DeadlineExceeded)
+	}
+	select {
+	case els.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-els.slots }()
+
+	actx, cancel := context.WithTimeout(ctx, els.config.TTSTimeout)
+	defer cancel()
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(actx, method, els.config.ElevenLabsBaseURL+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TTS request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("xi-api-key", els.config.ElevenLabsAPIKey)
+
+	ttsMetrics.Add("requests", 1)
+	resp, err := els.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// connection failures and per-attempt timeouts are worth another try
+		return nil, &TTSError{Kind: ErrTTSTransient, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &TTSError{Kind: ErrTTSTransient, Message: fmt.Sprintf("failed to read TTS response: %v", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, classifyTTSError(resp, data)
+	}
+	return data, nil
+}
+
+// classifyTTSError maps an error response to its kind. ElevenLabs reports an exhausted quota as
+// 401 with detail.status "quota_exceeded", so the body is checked before the status code.
+func classifyTTSError(resp *http.Response, body []byte) *TTSError {
+	e := &TTSError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	var parsed struct {
+		Detail struct {
+			Status string `json:"status"`
+		} `json:"detail"`
+	}
+	// detail is a list on validation errors; those stay unparsed and are rejected below
+	json.Unmarshal(body, &parsed)
+	switch {
+	case parsed.Detail.Status == "quota_exceeded" || resp.StatusCode == http.StatusPaymentRequired:
+		e.Kind = ErrTTSQuota
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrTTSAuth
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		e.Kind = ErrTTSTransient
+	default:
+		e.Kind = ErrTTSRejected
+	}
+	return e
+}
+
+// parseRetryAfter reads delay-seconds or an HTTP date; 0 when absent or malformed
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// ttsBackoff is exponential with jitter (half to full step), stretched to honor Retry-After
+func ttsBackoff(base time.Duration, attempt int, retryAfter time.Duration) time.Duration {
+	step := maxTTSBackoff
+	if attempt < 16 && base<<attempt < maxTTSBackoff {
+		step = base << attempt
+	}
+	delay := step/2 + time.Duration(rand.Int63n(int64(step/2)+1))
+	return max(delay, retryAfter)
+}
+
+func countTTSError(err *TTSError) {
+	switch err.Kind {
+	case ErrTTSAuth:
+		ttsMetrics.Add("errors_auth", 1)
+	case ErrTTSQuota:
+		ttsMetrics.Add("errors_quota", 1)
+	case ErrTTSTransient:
+		ttsMetrics.Add("errors_transient", 1)
+	default:
+		ttsMetrics.Add("errors_rejected", 1)
+	}
+}
+
+// Subscription returns the account's character quota. It is fetched from the API at most every
+// subscriptionMaxAge; in between, characters spent by this process are added locally.
+func (els *ElevenLabsService) Subscription(ctx context.Context) (models.TTSSubscription, error) {
+	els.mu.Lock()
+	if time.Since(els.subFetched) < subscriptionMaxAge {
+		sub, err := els.sub, els.subErr
+		els.mu.Unlock()
+		return sub, err
+	}
+	els.mu.Unlock()
+
+	sub, err := els.fetchSubscription(ctx)
+	if ctx.Err() != nil {
+		return sub, err
+	}
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	els.sub, els.subErr, els.subFetched = sub, err, time.Now()
+	return sub, err
+}
+
+func (els *ElevenLabsService) fetchSubscription(ctx context.Context) (models.TTSSubscription, error) {
+	data, err := els.call(ctx, http.MethodGet, "/user/subscription", "application/json", nil)
+	if err != nil {
+		return models.TTSSubscription{}, err
+	}
+	var parsed struct {
+		Tier                        string `json:"tier"`
+		CharacterCount              int64  `json:"character_count"`
+		CharacterLimit              int64  `json:"character_limit"`
+		NextCharacterCountResetUnix int64  `json:"next_character_count_reset_unix"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return models.TTSSubscription{}, fmt.Errorf("failed to decode subscription: %v", err)
+	}
+	sub := models.TTSSubscription{
+		Tier:           parsed.Tier,
+		CharacterCount: parsed.CharacterCount,
+		CharacterLimit: parsed.CharacterLimit,
+		FetchedAt:      time.Now().UTC().Truncate(time.Second),
+	}
+	if parsed.NextCharacterCountResetUnix > 0 {
+		reset := time.Unix(parsed.NextCharacterCountResetUnix, 0).UTC()
+		sub.NextResetAt = &reset
+	}
+	return sub, nil
+}
+
+// checkQuota fails fast when the known quota cannot cover chars. An unknown quota (the key may
+// lack the user_read permission) lets the request through; the provider enforces it anyway.
+func (els *ElevenLabsService) checkQuota(ctx context.Context, chars int) error {
+	sub, err := els.Subscription(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return nil
+	}
+	if sub.CharacterLimit > 0 && sub.CharacterCount+int64(chars) > sub.CharacterLimit {
+		countTTSError(&TTSError{Kind: ErrTTSQuota})
+		return &TTSError{Kind: ErrTTSQuota, Message: fmt.Sprintf("%d characters needed, %d of %d left", chars, max(sub.CharacterLimit-sub.CharacterCount, 0), sub.CharacterLimit)}
+	}
+	return nil
+}
+
+// account records a finished request: billed characters (0 for cache hits) against the quota and the user
+func (els *ElevenLabsService) account(ctx context.Context, chars int, cacheHit bool) {
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	userID := ttsUser(ctx)
+	usage := els.usage[userID]
+	usage.Requests++
+	usage.Characters += int64(chars)
+	if cacheHit {
+		usage.CacheHits++
+		ttsMetrics.Add("cache_hits", 1)
+	} else {
+		ttsMetrics.Add("cache_misses", 1)
+	}
+	els.usage[userID] = usage
+	els.sub.CharacterCount += int64(chars)
+	ttsMetrics.Add("characters", int64(chars))
+}
+
+// quotaExhausted makes the next Subscription call refetch after the provider refused for quota
+func (els *ElevenLabsService) quotaExhausted(err error) {
+	if errors.Is(err, ErrTTSQuota) {
+		els.mu.Lock()
+		els.subFetched = time.Time{}
+		els.mu.Unlock()
+	}
+}
+
+// Usage returns what userID spent through this process since it started
+func (els *ElevenLabsService) Usage(userID string) models.TTSUsage {
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	return els.usage[userID]
+}
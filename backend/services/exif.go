@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Minimal EXIF reader: walks the TIFF structure inside a JPEG APP1 segment.
+// Only the tags the pipeline needs are decoded; everything else is skipped.
+
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+	gpsTagLatitudeRef       = 0x0001
+	gpsTagLatitude          = 0x0002
+	gpsTagLongitudeRef      = 0x0003
+	gpsTagLongitude         = 0x0004
+)
+
+// exifTimeLayout is the camera's local time; EXIF carries no zone unless OffsetTime is set
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+type exifData struct {
+	Orientation int
+	// TakenAt is when the photo was taken (DateTimeOriginal, else DateTime); zero when unknown
+	TakenAt time.Time
+	// HasGPS is set when the photo carries a position, in decimal degrees
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+}
+
+var errNoExif = errors.New("no exif data")
+
+// readJPEGExif returns the EXIF data of a JPEG, or errNoExif
+func readJPEGExif(b []byte) (*exifData, error) {
+	tiff := jpegExifSegment(b)
+	if tiff == nil {
+		return nil, errNoExif
+	}
+	return parseTIFF(tiff)
+}
+
+// jpegExifSegment finds the APP1 "Exif\0\0" payload (a TIFF blob) before the image data
+func jpegExifSegment(b []byte) []byte {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil
+	}
+	i := 2
+	for i+4 <= len(b) {
+		if b[i] != 0xFF {
+			return nil
+		}
+		marker := b[i+1]
+		// standalone markers without a length
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			i += 2
+			continue
+		}
+		// start of scan / end of image: no metadata beyond this point
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(b[i+2 : i+4]))
+		if size < 2 || i+2+size > len(b) {
+			return nil
+		}
+		payload := b[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return payload[6:]
+		}
+		i += 2 + size
+	}
+	return nil
+}
+
+type tiffReader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(b []byte) (*exifData, error) {
+	if len(b) < 8 {
+		return nil, errNoExif
+	}
+	tr := &tiffReader{b: b}
+	switch string(b[:2]) {
+	case "II":
+		tr.order = binary.LittleEndian
+	case "MM":
+		tr.order = binary.BigEndian
+	default:
+		return nil, errNoExif
+	}
+	out := &exifData{}
+	ifd0 := int(tr.order.Uint32(b[4:8]))
+	var exifIFD, gpsIFD int
+	var modified time.Time
+	tr.walkIFD(ifd0, func(tag, typ uint16, count uint32, valueOff int) {
+		switch tag {
+		case exifTagOrientation:
+			out.Orientation = int(tr.short(valueOff))
+		case exifTagDateTime:
+			modified = parseExifTime(tr.ascii(count, valueOff))
+		case exifTagExifIFD:
+			exifIFD = int(tr.long(valueOff))
+		case exifTagGPSIFD:
+			gpsIFD = int(tr.long(valueOff))
+		}
+	})
+	tr.walkIFD(exifIFD, func(tag, typ uint16, count uint32, valueOff int) {
+		if tag == exifTagDateTimeOriginal {
+			out.TakenAt = parseExifTime(tr.ascii(count, valueOff))
+		}
+	})
+	if out.TakenAt.IsZero() {
+		out.TakenAt = modified
+	}
+
+	var latRef, lonRef string
+	var lat, lon []float64
+	tr.walkIFD(gpsIFD, func(tag, typ uint16, count uint32, valueOff int) {
+		switch tag {
+		case gpsTagLatitudeRef:
+			latRef = tr.ascii(count, valueOff)
+		case gpsTagLatitude:
+			lat = tr.rationals(count, valueOff)
+		case gpsTagLongitudeRef:
+			lonRef = tr.ascii(count, valueOff)
+		case gpsTagLongitude:
+			lon = tr.rationals(count, valueOff)
+		}
+	})
+	if len(lat) == 3 && len(lon) == 3 {
+		out.Latitude, out.Longitude = degrees(lat, latRef == "S"), degrees(lon, lonRef == "W")
+		// 0,0 is what some cameras write without a fix
+		out.HasGPS = out.Latitude != 0 || out.Longitude != 0
+	}
+	return out, nil
+}
+
+func parseExifTime(s string) time.Time {
+	t, err := time.Parse(exifTimeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// degrees converts degrees, minutes and seconds into signed decimal degrees
+func degrees(dms []float64, negative bool) float64 {
+	d := dms[0] + dms[1]/60 + dms[2]/3600
+	if negative {
+		return -d
+	}
+	return d
+}
+
+// walkIFD calls fn for each entry; valueOff points at the 4-byte value/offset field
+func (tr *tiffReader) walkIFD(off int, fn func(tag, typ uint16, count uint32, valueOff int)) {
+	if off <= 0 || off+2 > len(tr.b) {
+		return
+	}
+	n := int(tr.order.Uint16(tr.b[off : off+2]))
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(tr.b) {
+			return
+		}
+		fn(tr.order.Uint16(tr.b[e:e+2]), tr.order.Uint16(tr.b[e+2:e+4]), tr.order.Uint32(tr.b[e+4:e+8]), e+8)
+	}
+}
+
+func (tr *tiffReader) short(off int) uint16 {
+	if off+2 > len(tr.b) {
+		return 0
+	}
+	return tr.order.Uint16(tr.b[off : off+2])
+}
+
+func (tr *tiffReader) long(off int) uint32 {
+	if off < 0 || off+4 > len(tr.b) {
+		return 0
+	}
+	return tr.order.Uint32(tr.b[off : off+4])
+}
+
+// ascii reads a NUL-terminated string; values over 4 bytes live at the offset in the value field
+func (tr *tiffReader) ascii(count uint32, valueOff int) string {
+	off := valueOff
+	if count > 4 {
+		off = int(tr.long(valueOff))
+	}
+	end := off + int(count)
+	if count == 0 || off < 0 || end > len(tr.b) || end < off {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(tr.b[off:end]), "\x00"))
+}
+
+// rationals reads count unsigned fractions, which always live at the offset in the value field
+func (tr *tiffReader) rationals(count uint32, valueOff int) []float64 {
+	off := int(tr.long(valueOff))
+	if count == 0 || count > 16 || off <= 0 || off+8*int(count) > len(tr.b) {
+		return nil
+	}
+	out := make([]float64, count)
+	for i := range out {
+		num, den := tr.long(off+8*i), tr.long(off+8*i+4)
+		if den == 0 {
+			return nil
+		}
+		out[i] = float64(num) / float64(den)
+	}
+	return out
+}
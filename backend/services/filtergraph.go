@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// validateFiltergraph parses a -filter_complex graph the way ffmpeg's graph parser does and
+// reports what it would reject. Text from compositions and brand kits ends up in drawtext
+// options, so an escaping slip (a ',' or ';' in the text) shows up here as a broken filter
+// instead of as an ffmpeg failure after TTS has been paid for.
+func validateFiltergraph(graph string) error {
+	pos := 0
+	for {
+		pos = skipFilterSpace(graph, pos)
+		if pos == len(graph) {
+			// a trailing ';' ends the graph
+			return nil
+		}
+		var name string
+		var err error
+		if pos, err = parseFilterLabels(graph, pos); err != nil {
+			return err
+		}
+		start := pos
+		name, pos, err = readFilterToken(graph, pos, "=,;[")
+		if err != nil {
+			return err
+		}
+		if !filterNameRe.MatchString(name) {
+			return fmt.Errorf("invalid filter name %q at offset %d", name, start)
+		}
+		if pos < len(graph) && graph[pos] == '=' {
+			if _, pos, err = readFilterToken(graph, pos+1, "[],;"); err != nil {
+				return err
+			}
+		}
+		if pos, err = parseFilterLabels(graph, pos); err != nil {
+			return err
+		}
+		pos = skipFilterSpace(graph, pos)
+		if pos == len(graph) {
+			return nil
+		}
+		if c := graph[pos]; c != ',' && c != ';' {
+			return fmt.Errorf("unexpected %q after filter %s at offset %d", c, name, pos)
+		}
+		pos++
+	}
+}
+
+var filterNameRe = regexp.MustCompile(`^[A-Za-z0-9_]+(@[A-Za-z0-9_]+)?$`)
+
+// parseFilterLabels skips the [label]s at pos
+func parseFilterLabels(graph string, pos int) (int, error) {
+	for {
+		pos = skipFilterSpace(graph, pos)
+		if pos == len(graph) || graph[pos] != '[' {
+			return pos, nil
+		}
+		end := strings.IndexByte(graph[pos:], ']')
+		if end <= 1 {
+			return pos, fmt.Errorf("bad label at offset %d", pos)
+		}
+		pos += end + 1
+	}
+}
+
+// readFilterToken reads up to the first unquoted, unescaped byte of term, like av_get_token:
+// a backslash takes the next byte literally and single quotes take everything up to the
+// closing quote literally
+func readFilterToken(graph string, pos int, term string) (string, int, error) {
+	pos = skipFilterSpace(graph, pos)
+	var b strings.Builder
+	for pos < len(graph) && !strings.ContainsRune(term, rune(graph[pos])) {
+		switch graph[pos] {
+		case '\\':
+			if pos+1 < len(graph) {
+				pos++
+			}
+		case '\'':
+			end := strings.IndexByte(graph[pos+1:], '\'')
+			if end < 0 {
+				return "", pos, fmt.Errorf("unterminated quote at offset %d", pos)
+			}
+			b.WriteString(graph[pos+1 : pos+1+end])
+			pos += end + 2
+			continue
+		}
+		b.WriteByte(graph[pos])
+		pos++
+	}
+	return strings.TrimRight(b.String(), " \t\r\n"), pos, nil
+}
+
+func skipFilterSpace(graph string, pos int) int {
+	for pos < len(graph) && strings.ContainsRune(" \t\r\n", rune(graph[pos])) {
+		pos++
+	}
+	return pos
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	models "social-media-ai-video/models"
+)
+
+// Image pre-analysis runs during ingestion on the normalized pixels: a coarse color histogram
+// gives the dominant colors and the mean luma the brightness. Together with the EXIF date and
+// position they are handed to the generator as ImageContext.
+
+const (
+	// pixels sampled along the longer side
+	analysisSamples = 96
+	// colors below this share of the image are not dominant
+	minDominantShare  = 0.08
+	maxDominantColors = 3
+)
+
+// analyzeColors returns up to three dominant colors (hex, most first) and the mean brightness (0..1)
+func analyzeColors(img image.Image) ([]string, float64) {
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, 0
+	}
+	step := max(max(b.Dx(), b.Dy())/analysisSamples, 1)
+
+	// 3 bits per channel; each bucket keeps its sum so the reported color is the members' mean
+	type bucket struct {
+		n       int
+		r, g, b float64
+	}
+	buckets := map[int]*bucket{}
+	total, luma := 0, 0.0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r16, g16, b16, _ := img.At(x, y).RGBA()
+			r, g, bl := float64(r16>>8), float64(g16>>8), float64(b16>>8)
+			key := int(r16>>13)<<6 | int(g16>>13)<<3 | int(b16>>13)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.n++
+			bk.r, bk.g, bk.b = bk.r+r, bk.g+g, bk.b+bl
+			luma += 0.299*r + 0.587*g + 0.114*bl
+			total++
+		}
+	}
+
+	ranked := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		ranked = append(ranked, bk)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].n != ranked[j].n {
+			return ranked[i].n > ranked[j].n
+		}
+		// deterministic order for equal counts
+		return ranked[i].r+ranked[i].g*256+ranked[i].b*65536 < ranked[j].r+ranked[j].g*256+ranked[j].b*65536
+	})
+	var colors []string
+	for _, bk := range ranked {
+		if len(colors) == maxDominantColors || float64(bk.n)/float64(total) < minDominantShare {
+			break
+		}
+		n := float64(bk.n)
+		colors = append(colors, fmt.Sprintf("#%02X%02X%02X", int(math.Round(bk.r/n)), int(math.Round(bk.g/n)), int(math.Round(bk.b/n))))
+	}
+	return colors, math.Round(luma/float64(total)/255*100) / 100
+}
+
+// ImageContexts describes the ingested images for the generator; names and infos share their order
+func ImageContexts(names []string, infos []models.ImageInfo) []models.ImageContext {
+	out := make([]models.ImageContext, len(infos))
+	for i, info := range infos {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		orientation := "square"
+		switch {
+		case info.Width > info.Height:
+			orientation = "landscape"
+		case info.Width < info.Height:
+			orientation = "portrait"
+		}
+		out[i] = models.ImageContext{
+			Index:          i,
+			Name:           name,
+			Width:          info.Width,
+			Height:         info.Height,
+			Orientation:    orientation,
+			DominantColors: info.DominantColors,
+			Brightness:     info.Brightness,
+			TakenAt:        info.TakenAt,
+			Location:       info.Location,
+		}
+	}
+	return out
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// Image ingestion runs on every upload before it reaches the generator or Build:
+// HEIC is converted (via libheif's heif-convert), EXIF orientation is baked into the pixels,
+// transparency is flattened onto a background color and oversized images are
+// downscaled so they still cover the largest output canvas. Untouched JPEG/PNG
+// files are passed through as-is to avoid a lossy re-encode. Along the way the
+// image is analyzed for the generator (colors, brightness, EXIF date and position).
+
+const ingestJPEGQuality = 90
+
+type ImageIngestor struct {
+	heifConvertPath string
+	timeout         time.Duration
+	maxCanvas       int
+	background      color.RGBA
+}
+
+func NewImageIngestor(cfg *config.APIConfig) *ImageIngestor {
+	bg, err := ParseHexColor(cfg.IngestBackground)
+	if err != nil {
+		bg = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	return &ImageIngestor{heifConvertPath: heifConvertPath, timeout: cfg.FFmpegTimeout, maxCanvas: cfg.IngestMaxCanvas, background: bg}
+}
+
+// Normalize prepares one uploaded image inside ws and returns the path to use plus its metadata.
+// background ("#RRGGBB") overrides the configured flatten color when non-empty.
+func (ii *ImageIngestor) Normalize(ctx context.Context, ws *Workspace, path string, background string) (string, models.ImageInfo, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", models.ImageInfo{}, fmt.Errorf("failed to read image: %v", err)
+	}
+	info := models.ImageInfo{Orientation: 1}
+
+	switch sniffImageType(raw) {
+	case "image/heic":
+		info.Format = "heic"
+		if !heicSupported() {
+			return "", info, fmt.Errorf("%w: %s (HEIC decoding is not available)", ErrUnsupportedMedia, filepath.Base(path))
+		}
+		converted, err := ii.convertHEIC(ctx, ws, path)
+		if err != nil {
+			return "", info, err
+		}
+		// heif-convert applies the HEIF rotation and mirroring (irot/imir) itself
+		if raw, err = os.ReadFile(converted); err != nil {
+			return "", info, fmt.Errorf("failed to read converted image: %v", err)
+		}
+		info.Converted = true
+	case "image/jpeg":
+		info.Format = "jpeg"
+		if ex, err := readJPEGExif(raw); err == nil {
+			if ex.Orientation >= 1 && ex.Orientation <= 8 {
+				info.Orientation = ex.Orientation
+			}
+			if !ex.TakenAt.IsZero() {
+				info.TakenAt = &ex.TakenAt
+			}
+			if ex.HasGPS {
+				info.Location = &models.GeoPoint{Latitude: ex.Latitude, Longitude: ex.Longitude}
+			}
+		}
+	case "image/png":
+		info.Format = "png"
+	case "image/gif":
+		info.Format = "gif"
+	case "image/webp":
+		info.Format = "webp"
+	default:
+		return "", info, fmt.Errorf("%w: %s", ErrUnsupportedMedia, filepath.Base(path))
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", info, fmt.Errorf("failed to decode image %s: %v", filepath.Base(path), err)
+	}
+	b := img.Bounds()
+	info.OriginalWidth, info.OriginalHeight = b.Dx(), b.Dy()
+
+	changed := info.Converted
+	if info.Orientation != 1 {
+		img = applyOrientation(img, info.Orientation)
+		changed = true
+	}
+	if !isOpaque(img) {
+		info.HasAlpha = true
+		bg := ii.background
+		if background != "" {
+			if bg, err = ParseHexColor(background); err != nil {
+				return "", info, err
+			}
+		}
+		img = flatten(img, bg)
+		changed = true
+	}
+	if resized, ok := ii.downscale(img); ok {
+		img = resized
+		changed = true
+	}
+	// ffmpeg's image decoders are happiest with plain JPEG/PNG
+	if info.Format == "gif" || info.Format == "webp" {
+		changed = true
+	}
+
+	b = img.Bounds()
+	info.Width, info.Height = b.Dx(), b.Dy()
+	info.DominantColors, info.Brightness = analyzeColors(img)
+	if !changed {
+		return path, info, nil
+	}
+
+	info.Converted = true
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "_norm.jpg"
+	f, err := os.Create(out)
+	if err != nil {
+		return "", info, fmt.Errorf("failed to create normalized image: %v", err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: ingestJPEGQuality}); err != nil {
+		return "", info, fmt.Errorf("failed to encode normalized image: %v", err)
+	}
+	return out, info, nil
+}
+
+// convertHEIC decodes the primary HEIC image, grid tiles included, into a PNG inside the workspace
+func (ii *ImageIngestor) convertHEIC(ctx context.Context, ws *Workspace, path string) (string, error) {
+	if ii.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ii.timeout)
+		defer cancel()
+	}
+	out := ws.Path(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "_conv.png")
+	cmd := exec.CommandContext(ctx, ii.heifConvertPath, path, out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to convert %s: %v: %s", filepath.Base(path), err, string(output))
+	}
+	return out, nil
+}
+
+// downscale shrinks images larger than needed to cover a maxCanvas x maxCanvas box,
+// which still covers every supported output resolution
+func (ii *ImageIngestor) downscale(img image.Image) (image.Image, bool) {
+	b := img.Bounds()
+	if ii.maxCanvas <= 0 || (b.Dx() <= ii.maxCanvas || b.Dy() <= ii.maxCanvas) {
+		return img, false
+	}
+	scale := math.Max(float64(ii.maxCanvas)/float64(b.Dx()), float64(ii.maxCanvas)/float64(b.Dy()))
+	w := int(math.Round(float64(b.Dx()) * scale))
+	h := int(math.Round(float64(b.Dy()) * scale))
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst, true
+}
+
+// applyOrientation bakes an EXIF orientation (2..8) into the pixels
+func applyOrientation(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 CW
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 CCW
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	// conservative: assume alpha for unknown image types
+	return false
+}
+
+// flatten composites img over a solid background
+func flatten(img image.Image, bg color.RGBA) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// ParseHexColor parses "#RRGGBB"
+func ParseHexColor(s string) (color.RGBA, error) {
+	if !hexColorRe.MatchString(s) {
+		return color.RGBA{}, fmt.Errorf("invalid color %q (expected #RRGGBB)", s)
+	}
+	v, _ := strconv.ParseUint(s[1:], 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"expvar"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// Janitor removes what renders leave behind once it is past retention: upload workspaces, TTS
+// clips, abandoned render staging dirs and the stored files of finished jobs (outputs, previews,
+// inputs). When a watched disk climbs above the high-water mark it also evicts the oldest
+// evictable files until usage is back under the low-water mark. Counters are published through
+// expvar under "janitor".
+
+const (
+	sweepUploads  = "uploads"
+	sweepTTS      = "tts"
+	sweepStaging  = "staging"
+	sweepOutputs  = "outputs"
+	sweepPreviews = "previews"
+)
+
+var janitorMetrics = expvar.NewMap("janitor")
+
+type Janitor struct {
+	cfg     *config.APIConfig
+	storage Storage
+	// store and scheduler are nil on render workers, which then leave uploads and stored files alone
+	store     *JobStore
+	scheduler *RenderScheduler
+}
+
+// sweepItem is one removable file or directory, or one stored file of a finished job
+type sweepItem struct {
+	category string
+	path     string
+	modTime  time.Time
+	size     int64
+	// job files: artifact index into job.Job.Result.Artifacts, or -1 for the task's input images
+	job      *JobRecord
+	artifact int
+}
+
+func NewJanitor(cfg *config.APIConfig, storage Storage, store *JobStore, scheduler *RenderScheduler) *Janitor {
+	return &Janitor{cfg: cfg, storage: storage, store: store, scheduler: scheduler}
+}
+
+// Run sweeps every JanitorInterval until ctx is done
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.JanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep runs one retention pass followed, if needed, by a disk-pressure pass
+func (j *Janitor) Sweep(ctx context.Context) {
+	started := time.Now()
+	items, jobs := j.collect(started)
+
+	var expired []sweepItem
+	var evictable []sweepItem
+	for _, it := range items {
+		if keep := j.retention(it.category); keep > 0 && started.Sub(it.modTime) > keep {
+			expired = append(expired, it)
+		} else {
+			evictable = append(evictable, it)
+		}
+	}
+	changed := map[*JobRecord]bool{}
+	for _, it := range expired {
+		j.remove(ctx, it, changed)
+	}
+
+	if j.overHighWater() {
+		sort.Slice(evictable, func(a, b int) bool { return evictable[a].modTime.Before(evictable[b].modTime) })
+		evicted := 0
+		_, localStorage := j.storage.(*LocalStorage)
+		for _, it := range evictable {
+			if !j.overLowWater() || ctx.Err() != nil {
+				break
+			}
+			if it.job != nil && !localStorage {
+				// remote objects do not take up local disk
+				continue
+			}
+			j.remove(ctx, it, changed)
+			evicted++
+		}
+		janitorMetrics.Add("pressure_evictions", int64(evicted))
+		log.Printf("janitor: disk above %d%%, evicted %d items", j.cfg.DiskHighWater, evicted)
+	}
+
+	for _, rec := range jobs {
+		if !changed[rec] {
+			continue
+		}
+		if err := j.store.Put(*rec); err != nil {
+			log.Printf("janitor: job %s: %v", rec.Job.ID, err)
+			continue
+		}
+		if j.scheduler != nil {
+			j.scheduler.Forget(rec.Job.ID)
+		}
+	}
+
+	janitorMetrics.Add("runs", 1)
+	last := new(expvar.Int)
+	last.Set(started.Unix())
+	janitorMetrics.Set("last_run_unix", last)
+	usage := new(expvar.Int)
+	for _, dir := range j.watchedDirs() {
+		if used, err := diskUsedPercent(dir); err == nil && int64(used) > usage.Value() {
+			usage.Set(int64(used))
+		}
+	}
+	janitorMetrics.Set("disk_used_percent", usage)
+}
+
+// collect lists everything the janitor may remove. Files a running render could still be using
+// (younger than the job timeout, or owned by an unfinished job) are never listed.
+func (j *Janitor) collect(now time.Time) ([]sweepItem, []*JobRecord) {
+	var items []sweepItem
+	busy := now.Add(-j.cfg.JobTimeout)
+
+	if j.scheduler != nil {
+		active := j.scheduler.ActiveWorkspaces()
+		for _, it := range listEntries(j.cfg.UploadDir, sweepUploads) {
+			if strings.HasPrefix(filepath.Base(it.path), "ws_") && !active[filepath.Clean(it.path)] && it.modTime.Before(busy) {
+				items = append(items, it)
+			}
+		}
+	}
+	for _, it := range listEntries(ttsTempDir(), sweepTTS) {
+		if it.modTime.Before(busy) {
+			items = append(items, it)
+		}
+	}
+	for _, it := range listEntries(j.cfg.RenderOutputDir, sweepStaging) {
+		if !it.modTime.Before(busy) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(it.path, incompleteMarker)); err != nil {
+			// renders kept before the storage backend existed
+			it.category = sweepOutputs
+		}
+		items = append(items, it)
+	}
+
+	if j.store == nil {
+		return items, nil
+	}
+	recs, err := j.store.FinishedBefore(now)
+	if err != nil {
+		log.Printf("janitor: %v", err)
+		return items, nil
+	}
+	jobs := make([]*JobRecord, len(recs))
+	for i := range recs {
+		rec := &recs[i]
+		jobs[i] = rec
+		if len(rec.Task.ImageKeys) > 0 {
+			items = append(items, sweepItem{category: sweepUploads, modTime: *rec.Job.FinishedAt, job: rec, artifact: -1})
+		}
+		if rec.Job.Result == nil {
+			continue
+		}
+		for ai, a := range rec.Job.Result.Artifacts {
+			if a.Key != "" {
+				items = append(items, sweepItem{category: artifactCategory(a.Kind), modTime: *rec.Job.FinishedAt, size: a.Size, job: rec, artifact: ai})
+			}
+		}
+	}
+	return items, jobs
+}
+
+func (j *Janitor) retention(category string) time.Duration {
+	switch category {
+	case sweepUploads:
+		return j.cfg.RetentionUploads
+	case sweepTTS:
+		return max(j.cfg.RetentionTTS, j.cfg.JobTimeout)
+	case sweepStaging:
+		// collect only lists staging dirs no render can still be writing
+		return j.cfg.JobTimeout
+	case sweepOutputs:
+		return j.cfg.RetentionOutputs
+	case sweepPreviews:
+		return j.cfg.RetentionPreviews
+	}
+	return 0
+}
+
+// remove deletes one item and counts what it reclaimed; job records are marked in changed
+func (j *Janitor) remove(ctx context.Context, it sweepItem, changed map[*JobRecord]bool) {
+	size, files := it.size, int64(1)
+	switch {
+	case it.job != nil && it.artifact < 0:
+		for _, key := range it.job.Task.ImageKeys {
+			if err := j.storage.Delete(ctx, key); err != nil {
+				log.Printf("janitor: %v", err)
+				return
+			}
+		}
+		files = int64(len(it.job.Task.ImageKeys))
+		it.job.Task.ImageKeys = nil
+		changed[it.job] = true
+	case it.job != nil:
+		a := &it.job.Job.Result.Artifacts[it.artifact]
+		if a.Key == "" {
+			return
+		}
+		if err := j.storage.Delete(ctx, a.Key); err != nil {
+			log.Printf("janitor: %v", err)
+			return
+		}
+		a.Key, a.URL, a.Expired = "", "", true
+		changed[it.job] = true
+	default:
+		size, files = pathSize(it.path)
+		if err := os.RemoveAll(it.path); err != nil {
+			log.Printf("janitor: %v", err)
+			return
+		}
+	}
+	janitorMetrics.Add("bytes_reclaimed_"+it.category, size)
+	janitorMetrics.Add("files_removed_"+it.category, files)
+}
+
+// watchedDirs are the local dirs whose filesystems the high-water mark applies to
+func (j *Janitor) watchedDirs() []string {
+	dirs := []string{j.cfg.UploadDir, ttsTempDir(), j.cfg.RenderOutputDir}
+	if local, ok := j.storage.(*LocalStorage); ok {
+		dirs = append(dirs, local.root)
+	}
+	return dirs
+}
+
+func (j *Janitor) overHighWater() bool {
+	return j.cfg.DiskHighWater > 0 && j.usageAbove(j.cfg.DiskHighWater)
+}
+
+func (j *Janitor) overLowWater() bool {
+	return j.usageAbove(j.cfg.DiskLowWater)
+}
+
+func (j *Janitor) usageAbove(percent int) bool {
+	for _, dir := range j.watchedDirs() {
+		if used, err := diskUsedPercent(dir); err == nil && used > percent {
+			return true
+		}
+	}
+	return false
+}
+
+func artifactCategory(kind models.ArtifactKind) string {
+	switch kind {
+	case models.ArtifactThumbnail, models.ArtifactPreviewGIF, models.ArtifactPreviewWebP,
+		models.ArtifactProxy, models.ArtifactContactSheet:
+		return sweepPreviews
+	}
+	return sweepOutputs
+}
+
+// listEntries returns the direct children of dir
+func listEntries(dir, category string) []sweepItem {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var items []sweepItem
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		items = append(items, sweepItem{category: category, path: filepath.Join(dir, e.Name()), modTime: info.ModTime()})
+	}
+	return items
+}
+
+// pathSize returns the bytes and number of files under path
+func pathSize(path string) (int64, int64) {
+	var size, files int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package services
+
+import "errors"
+
+// diskUsedPercent is not implemented here; the janitor then only applies retention
+func diskUsedPercent(path string) (int, error) {
+	return 0, errors.ErrUnsupported
+}
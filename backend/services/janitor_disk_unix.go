@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package services
+
+import "syscall"
+
+// diskUsedPercent reports how full the filesystem holding path is, the way df computes it
+func diskUsedPercent(path string) (int, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	used := st.Blocks - st.Bfree
+	if used+st.Bavail == 0 {
+		return 0, nil
+	}
+	return int((used*100 + used + st.Bavail - 1) / (used + st.Bavail)), nil
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// JobStore persists render jobs in a BoltDB file under DataDir: the client-visible job,
+// the task (composition, inputs, options) needed to run it again, and how often it was
+// started. The scheduler writes every state change through it; on startup Recover decides
+// which interrupted jobs are retried and which are marked failed.
+
+var (
+	jobsBucket     = []byte("jobs")
+	userJobsBucket = []byte("user_jobs")
+)
+
+// JobRecord is one persisted job
+type JobRecord struct {
+	Job      models.RenderJob `json:"job"`
+	Task     RenderTask       `json:"task"`
+	Attempts int              `json:"attempts"`
+}
+
+// resumable reports whether the job can run again without the request that created it:
+// streamed renders only ever existed for the waiting client
+func (r JobRecord) resumable() bool {
+	return r.Task.Keep
+}
+
+type JobStore struct {
+	db *bolt.DB
+}
+
+// OpenJobStore opens (or creates) <DataDir>/jobs.db
+func OpenJobStore(cfg *config.APIConfig) (*JobStore, error) {
+	if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %v", err)
+	}
+	db, err := bolt.Open(filepath.Join(cfg.DataDir, "jobs.db"), 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{jobsBucket, userJobsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize job store: %v", err)
+	}
+	return &JobStore{db: db}, nil
+}
+
+func (js *JobStore) Close() error {
+	return js.db.Close()
+}
+
+// Put inserts or replaces a job record
+func (js *JobStore) Put(rec JobRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %v", err)
+	}
+	return js.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(jobsBucket).Put([]byte(rec.Job.ID), data); err != nil {
+			return err
+		}
+		if rec.Job.UserID != "" {
+			return tx.Bucket(userJobsBucket).Put(userJobKey(rec.Job), []byte(rec.Job.ID))
+		}
+		return nil
+	})
+}
+
+// Get returns a job record or ErrJobNotFound
+func (js *JobStore) Get(id string) (JobRecord, error) {
+	var rec JobRecord
+	err := js.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrJobNotFound
+		}
+		return json.Unmarshal(data, &rec)
+	})
+	return rec, err
+}
+
+// ListByUser returns a user's jobs, newest first. An empty status matches every job.
+func (js *JobStore) ListByUser(userID string, status models.JobStatus, limit int) ([]models.RenderJob, error) {
+	var jobs []models.RenderJob
+	prefix := append([]byte(userID), 0)
+	err := js.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(userJobsBucket)
+		all := tx.Bucket(jobsBucket)
+		c := index.Cursor()
+		// walk the user's keys backwards from just past the prefix range
+		k, v := c.Seek(append([]byte(userID), 1))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+			data := all.Get(v)
+			if data == nil {
+				continue
+			}
+			var rec JobRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			if status != "" && rec.Job.Status != status {
+				continue
+			}
+			jobs = append(jobs, rec.Job)
+			if limit > 0 && len(jobs) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// Recover runs at startup, before any worker. Jobs left queued or running by the previous
+// process are returned for re-queueing when they are resumable, their inputs still exist and
+// they have attempts left; the rest are marked failed. Jobs waiting for their composition are
+// returned as they are and keep waiting.
+func (js *JobStore) Recover(maxAttempts int) ([]JobRecord, error) {
+	var resumed []JobRecord
+	err := js.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		var updates []JobRecord
+		err := b.ForEach(func(k, v []byte) error {
+			var rec JobRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if rec.Job.Status.Finished() {
+				return nil
+			}
+			reason := ""
+			switch {
+			case !rec.resumable():
+				reason = "interrupted by restart"
+			case maxAttempts > 0 && rec.Attempts >= maxAttempts:
+				reason = fmt.Sprintf("interrupted by restart after %d attempts", rec.Attempts)
+			default:
+				if _, err := os.Stat(rec.Task.WorkspaceDir); err != nil {
+					reason = "interrupted by restart; inputs are gone"
+				}
+			}
+			if reason == "" {
+				// no request is waiting any more, so the job now owns its workspace
+				rec.Task.Detached = true
+				// jobs still waiting for their composition keep waiting
+				if rec.Job.Status != models.JobGenerating {
+					rec.Job.Status = models.JobQueued
+				}
+				rec.Job.StartedAt = nil
+				resumed = append(resumed, rec)
+			} else {
+				now := time.Now()
+				rec.Job.Status = models.JobFailed
+				rec.Job.Error = reason
+				rec.Job.FinishedAt = &now
+				// its workspace is left to CleanupOrphans
+			}
+			updates = append(updates, rec)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, rec := range updates {
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(rec.Job.ID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover jobs: %v", err)
+	}
+	return resumed, nil
+}
+
+// FinishedBefore returns finished jobs older than cutoff that still hold stored files
+// (artifacts or inputs); the janitor expires those
+func (js *JobStore) FinishedBefore(cutoff time.Time) ([]JobRecord, error) {
+	var recs []JobRecord
+	err := js.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var rec JobRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if !rec.Job.Status.Finished() || rec.Job.FinishedAt == nil || !rec.Job.FinishedAt.Before(cutoff) {
+				return nil
+			}
+			if len(rec.Task.ImageKeys) > 0 || rec.holdsArtifacts() {
+				recs = append(recs, rec)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan jobs: %v", err)
+	}
+	return recs, nil
+}
+
+func (r JobRecord) holdsArtifacts() bool {
+	if r.Job.Result == nil {
+		return false
+	}
+	for _, a := range r.Job.Result.Artifacts {
+		if a.Key != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// userJobKey orders a user's jobs by creation time: user \x00 unix-nanos(8, big endian) id
+func userJobKey(job models.RenderJob) []byte {
+	key := append([]byte(job.UserID), 0)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(job.CreatedAt.UnixNano()))
+	key = append(key, ts[:]...)
+	return append(key, job.ID...)
+}
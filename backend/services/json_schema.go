@@ -0,0 +1,190 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchema checks documents against the subset of JSON Schema (draft-07) the composition
+// schema uses: type, enum, required, properties, additionalProperties, items, oneOf and the
+// numeric, length and item-count bounds. Other keywords are ignored.
+type JSONSchema struct {
+	doc map[string]interface{}
+}
+
+// ErrSchemaMismatch marks a composition that breaks the composition schema
+var ErrSchemaMismatch = errors.New("composition does not match schema")
+
+// maxSchemaErrors caps how many violations one error lists
+const maxSchemaErrors = 5
+
+func LoadJSONSchema(path string) (*JSONSchema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %v", path, err)
+	}
+	return &JSONSchema{doc: doc}, nil
+}
+
+// Validate returns an error listing where blob breaks the schema
+func (s *JSONSchema) Validate(blob []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(blob, &v); err != nil {
+		return fmt.Errorf("%w: invalid json: %v", ErrSchemaMismatch, err)
+	}
+	var errs []string
+	validateSchemaNode(s.doc, v, "$", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) > maxSchemaErrors {
+		errs = append(errs[:maxSchemaErrors], fmt.Sprintf("and %d more", len(errs)-maxSchemaErrors))
+	}
+	return fmt.Errorf("%w: %s", ErrSchemaMismatch, strings.Join(errs, "; "))
+}
+
+// ValidateComposition checks a generator's raw composition, inside the optional n8n "output"
+// wrapper, before it is parsed
+func (s *JSONSchema) ValidateComposition(blob []byte) error {
+	return s.Validate(unwrapComposition(blob))
+}
+
+func validateSchemaNode(schema map[string]interface{}, v interface{}, path string, errs *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesSchemaType(t, v) {
+		fail("expected %v", t)
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", v, enum)
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, alt := range oneOf {
+			if sub, ok := alt.(map[string]interface{}); ok {
+				var altErrs []string
+				validateSchemaNode(sub, v, path, &altErrs)
+				if len(altErrs) == 0 {
+					matched++
+				}
+			}
+		}
+		if matched != 1 {
+			fail("matches %d of the oneOf alternatives (expected exactly 1)", matched)
+		}
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if m, ok := schema["minimum"].(float64); ok && val < m {
+			fail("%v is below the minimum %v", val, m)
+		}
+		if m, ok := schema["maximum"].(float64); ok && val > m {
+			fail("%v is above the maximum %v", val, m)
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(val))
+		if m, ok := schema["minLength"].(float64); ok && n < m {
+			fail("shorter than %v characters", m)
+		}
+		if m, ok := schema["maxLength"].(float64); ok && n > m {
+			fail("longer than %v characters", m)
+		}
+	case []interface{}:
+		n := float64(len(val))
+		if m, ok := schema["minItems"].(float64); ok && n < m {
+			fail("fewer than %v items", m)
+		}
+		if m, ok := schema["maxItems"].(float64); ok && n > m {
+			fail("more than %v items", m)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				validateSchemaNode(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]interface{}:
+		required, _ := schema["required"].([]interface{})
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := val[name]; !present {
+					fail("missing %q", name)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]interface{})
+			if !ok {
+				if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+					fail("unexpected property %q", k)
+				}
+				continue
+			}
+			validateSchemaNode(sub, val[k], path+"."+k, errs)
+		}
+	}
+}
+
+// matchesSchemaType checks v against a type name or list of names
+func matchesSchemaType(t interface{}, v interface{}) bool {
+	if names, ok := t.([]interface{}); ok {
+		for _, n := range names {
+			if matchesSchemaType(n, v) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return v == nil
+	}
+	return true
+}
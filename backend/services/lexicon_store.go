@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// LexiconStore persists one pronunciation lexicon per user as <DataDir>/lexicons/<hash>.json,
+// the hash being of the X-User-ID (anonymous callers share one). Like brand kits these are
+// small, rarely written and read once per render.
+
+var ErrInvalidLexicon = errors.New("invalid lexicon")
+
+const (
+	maxLexiconEntries = 500
+	maxLexiconWordLen = 64
+)
+
+type LexiconStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+func NewLexiconStore(cfg *config.APIConfig) *LexiconStore {
+	return &LexiconStore{dir: filepath.Join(cfg.DataDir, "lexicons")}
+}
+
+// Get returns userID's lexicon; users without one get an empty lexicon
+func (s *LexiconStore) Get(userID string) (*models.Lexicon, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, err := os.ReadFile(s.path(userID))
+	if errors.Is(err, os.ErrNotExist) {
+		return &models.Lexicon{Entries: []models.LexiconEntry{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lexicon: %v", err)
+	}
+	var lex models.Lexicon
+	if err := json.Unmarshal(b, &lex); err != nil {
+		return nil, fmt.Errorf("corrupt lexicon: %v", err)
+	}
+	return &lex, nil
+}
+
+// Put validates and replaces userID's lexicon
+func (s *LexiconStore) Put(userID string, entries []models.LexiconEntry) (*models.Lexicon, error) {
+	entries, err := NormalizeLexicon(entries)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	lex := &models.Lexicon{Entries: entries, UpdatedAt: &now}
+	b, err := json.MarshalIndent(lex, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lexicon: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lexicon dir: %v", err)
+	}
+	if err := writeFileAtomic(s.path(userID), b); err != nil {
+		return nil, err
+	}
+	return lex, nil
+}
+
+// Delete removes userID's lexicon; deleting a missing lexicon succeeds
+func (s *LexiconStore) Delete(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(userID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete lexicon: %v", err)
+	}
+	return nil
+}
+
+func (s *LexiconStore) path(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// NormalizeLexicon trims entries, checks that each says how to pronounce its word, drops
+// duplicate words (the last one wins) and sorts by word
+func NormalizeLexicon(entries []models.LexiconEntry) ([]models.LexiconEntry, error) {
+	if len(entries) > maxLexiconEntries {
+		return nil, fmt.Errorf("%w: more than %d entries", ErrInvalidLexicon, maxLexiconEntries)
+	}
+	byWord := map[string]models.LexiconEntry{}
+	for _, e := range entries {
+		e.Word = strings.Join(strings.Fields(e.Word), " ")
+		e.Alias = strings.Join(strings.Fields(e.Alias), " ")
+		e.Phoneme = strings.TrimSpace(e.Phoneme)
+		e.Alphabet = strings.ToLower(strings.TrimSpace(e.Alphabet))
+		switch {
+		case e.Word == "" || len(e.Word) > maxLexiconWordLen:
+			return nil, fmt.Errorf("%w: word %q is empty or too long", ErrInvalidLexicon, e.Word)
+		case e.Alias == "" && e.Phoneme == "":
+			return nil, fmt.Errorf("%w: %q needs an alias or a phoneme", ErrInvalidLexicon, e.Word)
+		case strings.ContainsAny(e.Word+e.Alias+e.Phoneme, "<>\"*[]"):
+			return nil, fmt.Errorf("%w: %q contains markup characters", ErrInvalidLexicon, e.Word)
+		}
+		if e.Phoneme != "" {
+			switch e.Alphabet {
+			case "":
+				e.Alphabet = "ipa"
+			case "ipa", "cmu-arpabet":
+			default:
+				return nil, fmt.Errorf("%w: unknown alphabet %q (expected ipa or cmu-arpabet)", ErrInvalidLexicon, e.Alphabet)
+			}
+		} else {
+			e.Alphabet = ""
+		}
+		byWord[strings.ToLower(e.Word)] = e
+	}
+	out := make([]models.LexiconEntry, 0, len(byWord))
+	for _, e := range byWord {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Word) < strings.ToLower(out[j].Word) })
+	return out, nil
+}
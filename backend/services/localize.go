@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// Localization turns a stored composition into the same video in other languages: text segments
+// are translated by a pluggable Translator, the narration voice is switched to one configured for
+// the language, and the timeline is stretched or squeezed for the new text length (Spanish, for
+// one, runs about a fifth longer than English). Narration markup is not carried over.
+
+var (
+	ErrInvalidLanguage      = errors.New("invalid language")
+	ErrUntranslatable       = errors.New("text cannot be translated")
+	ErrLocalizationDisabled = errors.New("localization is not configured")
+)
+
+var languageRe = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+const (
+	// timelines are not stretched or squeezed beyond these factors for text length
+	minLocalizeScale = 0.75
+	maxLocalizeScale = 1.5
+	translateTimeout = time.Minute
+)
+
+// Translator translates texts from source to target language (ISO 639-1 codes), keeping their order
+type Translator interface {
+	Translate(ctx context.Context, texts []string, source, target string) ([]string, error)
+}
+
+// NewTranslator returns the translator selected by cfg.Translator; nil when localization is off
+func NewTranslator(cfg *config.APIConfig) (Translator, error) {
+	switch cfg.Translator {
+	case "":
+		return nil, nil
+	case "dictionary":
+		path := cfg.TranslationDictionary
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.DataDir, path)
+		}
+		return LoadDictionaryTranslator(path)
+	case "libretranslate":
+		return NewLibreTranslator(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown TRANSLATOR %q (expected dictionary or libretranslate)", cfg.Translator)
+}
+
+// NormalizeLanguage lowercases a language code and checks its shape ("es", "pt-br")
+func NormalizeLanguage(lang string) (string, error) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if !languageRe.MatchString(lang) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLanguage, lang)
+	}
+	return lang, nil
+}
+
+// DictionaryTranslator translates from a fixed table: whole texts first, then word by word.
+// A text with a word the table does not know fails with ErrUntranslatable rather than being
+// rendered half in the source language. It needs no network, which suits short, repetitive
+// copy such as calls to action.
+type DictionaryTranslator struct {
+	// entries maps target language → lowercased source text or word → translation
+	entries map[string]map[string]string
+}
+
+func NewDictionaryTranslator(entries map[string]map[string]string) *DictionaryTranslator {
+	dt := &DictionaryTranslator{entries: map[string]map[string]string{}}
+	for lang, table := range entries {
+		lang = strings.ToLower(lang)
+		if dt.entries[lang] == nil {
+			dt.entries[lang] = map[string]string{}
+		}
+		for from, to := range table {
+			dt.entries[lang][dictionaryKey(from)] = to
+		}
+	}
+	return dt
+}
+
+// LoadDictionaryTranslator reads a {"<lang>": {"<text>": "<translation>"}} file
+func LoadDictionaryTranslator(path string) (*DictionaryTranslator, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translation dictionary: %v", err)
+	}
+	var entries map[string]map[string]string
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("invalid translation dictionary %s: %v", path, err)
+	}
+	return NewDictionaryTranslator(entries), nil
+}
+
+func (dt *DictionaryTranslator) Translate(ctx context.Context, texts []string, source, target string) ([]string, error) {
+	if source == target {
+		return texts, nil
+	}
+	table, ok := dt.entries[target]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s dictionary", ErrUntranslatable, target)
+	}
+	out := make([]string, len(texts))
+	for i, text := range texts {
+		if t, ok := table[dictionaryKey(text)]; ok {
+			out[i] = t
+			continue
+		}
+		words := strings.Fields(text)
+		for k, w := range words {
+			core := wordCore(w)
+			t, ok := table[strings.ToLower(core)]
+			if !ok {
+				// numbers, punctuation and emoji read the same in every language
+				if strings.IndexFunc(core, unicode.IsLetter) >= 0 {
+					return nil, fmt.Errorf("%w: no %s translation for %q", ErrUntranslatable, target, core)
+				}
+				continue
+			}
+			if r, _ := utf8.DecodeRuneInString(core); unicode.IsUpper(r) {
+				t = capitalize(t)
+			}
+			words[k] = strings.Replace(w, core, t, 1)
+		}
+		out[i] = strings.Join(words, " ")
+	}
+	return out, nil
+}
+
+func dictionaryKey(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// LibreTranslator calls a LibreTranslate-compatible /translate endpoint
+type LibreTranslator struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewLibreTranslator(cfg *config.APIConfig) *LibreTranslator {
+	return &LibreTranslator{
+		baseURL: strings.TrimRight(cfg.TranslateURL, "/"),
+		apiKey:  cfg.TranslateAPIKey,
+		client:  &http.Client{Timeout: translateTimeout},
+	}
+}
+
+func (lt *LibreTranslator) Translate(ctx context.Context, texts []string, source, target string) ([]string, error) {
+	if len(texts) == 0 || source == target {
+		return texts, nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"q":       texts,
+		"source":  source,
+		"target":  target,
+		"format":  "text",
+		"api_key": lt.apiKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal translate request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lt.baseURL+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create translate request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := lt.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translate response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("translate API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var parsed struct {
+		TranslatedText []string `json:"translatedText"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode translate response: %v", err)
+	}
+	if len(parsed.TranslatedText) != len(texts) {
+		return nil, fmt.Errorf("translate API returned %d texts for %d", len(parsed.TranslatedText), len(texts))
+	}
+	return parsed.TranslatedText, nil
+}
+
+// Localizer derives per-language render tasks from a stored one
+type Localizer struct {
+	translator Translator
+	voices     map[string]string
+}
+
+func NewLocalizer(cfg *config.APIConfig, translator Translator) *Localizer {
+	return &Localizer{translator: translator, voices: cfg.TTSVoices}
+}
+
+// Voice returns the narration voice configured for lang ("pt-br" falls back to "pt"); empty means the default voice
+func (l *Localizer) Voice(lang string) string {
+	if v, ok := l.voices[lang]; ok {
+		return v
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	return l.voices[base]
+}
+
+// Localize translates a composition blob from source into target and re-times it for the new text
+func (l *Localizer) Localize(ctx context.Context, blob []byte, source, target string) ([]byte, error) {
+	parsed, err := ParseComposition(blob)
+	if err != nil {
+		return nil, err
+	}
+	vc := *parsed
+	segs := vc.Timeline.TextTimeline.TextSegments
+	before := make([]string, len(segs))
+	for i, seg := range segs {
+		before[i] = StripSpeechMarkup(seg.Text)
+	}
+	if l.translator == nil {
+		return nil, ErrLocalizationDisabled
+	}
+	after, err := l.translator.Translate(ctx, before, source, target)
+	if err != nil {
+		return nil, fmt.Errorf("translate %s→%s: %w", source, target, err)
+	}
+	if len(after) != len(before) {
+		return nil, fmt.Errorf("translate %s→%s: got %d texts for %d", source, target, len(after), len(before))
+	}
+	for i := range segs {
+		segs[i].Text = strings.TrimSpace(after[i])
+	}
+	retimeForLength(&vc, before, after)
+
+	out, err := json.Marshal(vc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal localized composition: %v", err)
+	}
+	return out, nil
+}
+
+// Task builds the render task for target from a finished job's task: the composition is
+// localized, the inputs are copied into ws and stored, and the narration voice is switched.
+// The task is detached and kept, like any other batch job.
+func (l *Localizer) Task(ctx context.Context, st Storage, src RenderTask, source, target string, ws *Workspace) (RenderTask, error) {
+	composition, err := l.Localize(ctx, src.Composition, source, target)
+	if err != nil {
+		return RenderTask{}, err
+	}
+	paths, err := CopyInputs(ctx, st, src, ws)
+	if err != nil {
+		return RenderTask{}, err
+	}
+	keys, err := StoreInputs(ctx, st, ws.Dir, paths)
+	if err != nil {
+		return RenderTask{}, err
+	}
+	opts := src.Options
+	opts.Language = target
+	opts.VoiceID = l.Voice(target)
+	return RenderTask{
+		Composition:  composition,
+		ImagePaths:   paths,
+		ImageKeys:    keys,
+		ImageInfos:   src.ImageInfos,
+		Options:      opts,
+		WorkspaceDir: ws.Dir,
+		Keep:         true,
+		Detached:     true,
+	}, nil
+}
+
+// CopyInputs copies src's images into ws, from its workspace when still on disk, else from storage
+func CopyInputs(ctx context.Context, st Storage, src RenderTask, ws *Workspace) ([]string, error) {
+	paths := make([]string, len(src.ImagePaths))
+	for i, p := range src.ImagePaths {
+		paths[i] = ws.Path(p)
+		if err := linkOrCopy(p, paths[i]); err == nil {
+			continue
+		}
+		if i >= len(src.ImageKeys) {
+			return nil, fmt.Errorf("input image %d is no longer available", i)
+		}
+		if err := FetchFile(ctx, st, src.ImageKeys[i], paths[i]); err != nil {
+			return nil, fmt.Errorf("failed to fetch input image: %v", err)
+		}
+	}
+	return paths, nil
+}
+
+// retimeForLength stretches the timeline by how much longer the texts got overall, then shares
+// the text track among segments by their new length so a long translation gets longer on screen
+func retimeForLength(vc *models.VideoCompositionResponse, before, after []string) {
+	oldChars, newChars := 0, 0
+	for i := range before {
+		oldChars += utf8.RuneCountInString(before[i])
+		newChars += utf8.RuneCountInString(after[i])
+	}
+	if oldChars == 0 || newChars == 0 {
+		return
+	}
+	scale := clampFloat(float64(newChars)/float64(oldChars), minLocalizeScale, maxLocalizeScale)
+	if total := timelineDuration(vc.Timeline); math.Abs(scale-1) >= 0.05 && total > 0 {
+		reflowTimeline(vc, total*scale)
+	}
+
+	segs := vc.Timeline.TextTimeline.TextSegments
+	if len(segs) < 2 {
+		return
+	}
+	order := make([]int, len(segs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return segs[order[a]].StartTime < segs[order[b]].StartTime })
+	start := segs[order[0]].StartTime
+	end := 0
+	weights := make([]float64, len(segs))
+	for k, i := range order {
+		end = max(end, segs[i].StartTime+segs[i].Duration)
+		// each segment keeps its share, adjusted by how much its own text grew
+		growth := 1.0
+		if n := utf8.RuneCountInString(before[i]); n > 0 {
+			growth = float64(utf8.RuneCountInString(after[i])) / float64(n)
+		}
+		weights[k] = float64(max(segs[i].Duration, 1)) * growth
+	}
+	at := start
+	for k, d := range apportion(weights, end-start) {
+		i := order[k]
+		segs[i].StartTime, segs[i].Duration = at, d
+		at += d
+	}
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	models "social-media-ai-video/models"
+)
+
+// Narration comes back from the TTS provider at whatever length it happens to be. Before the
+// builder mixes it in, the compiler measures it and brings it and the visuals to the same
+// length using the strategy in RenderOptions.NarrationFit. Whatever the strategy, the builder
+// finally pads or trims the narration to the video length so it neither runs past the last
+// frame nor cuts the music short.
+
+const (
+	// atempo beyond these bounds sounds noticeably sped up or dragged
+	minNarrationTempo = 0.8
+	maxNarrationTempo = 1.25
+	// speaking speeds the TTS provider accepts
+	minTTSSpeed = 0.7
+	maxTTSSpeed = 1.2
+)
+
+// narrationTrack is the generated narration as Compile tracks it
+type narrationTrack struct {
+	names []string
+	paths map[string]string
+	words []models.WordTiming
+	stats models.TTSStats
+}
+
+// files returns the full paths of the clips, in order
+func (t narrationTrack) files() []string {
+	var files []string
+	for _, fn := range t.names {
+		files = append(files, t.paths[fn])
+	}
+	return files
+}
+
+// narrationFit is what the builder applies to the narration stream; the zero value leaves it untouched
+type narrationFit struct {
+	// Tempo is the atempo factor (1 or 0 for none)
+	Tempo float64
+	// Length is the video length in seconds the narration is padded or trimmed to (0 for none)
+	Length float64
+}
+
+// filter returns the audio filters (with a trailing comma) that apply the fit
+func (f narrationFit) filter() string {
+	out := ""
+	if f.Tempo > 0 && f.Tempo != 1 {
+		out += fmt.Sprintf("atempo=%.4f,", f.Tempo)
+	}
+	if f.Length > 0 {
+		out += fmt.Sprintf("apad,atrim=end=%.3f,", f.Length)
+	}
+	return out
+}
+
+// synthesize generates narration for input, with word timings when captions need them. Each run
+// of segments sharing an emphasis becomes its own clip; the builder concatenates them.
+func (cc *CompositionCompiler) synthesize(ctx context.Context, input models.TTSInput, timed bool, dir string) (narrationTrack, error) {
+	t := narrationTrack{paths: map[string]string{}}
+	runs := narrationRuns(input)
+	if len(runs) == 0 {
+		runs = []models.TTSInput{input}
+	}
+	// later clips start where the earlier ones end; timings that cannot be placed are dropped
+	// and captions fall back to segment timing
+	aligned := timed
+	offset := 0.0
+	for i, run := range runs {
+		var names []string
+		var paths map[string]string
+		var words []models.WordTiming
+		var stats models.TTSStats
+		var err error
+		if timed {
+			// captions follow the spoken words when the provider returns alignment
+			names, paths, words, stats, err = cc.voiceService.GenerateSpeechWithTimestamps(ctx, run, dir)
+		} else {
+			names, paths, stats, err = cc.voiceService.GenerateSpeechToTmp(ctx, run, dir)
+		}
+		t.stats = addTTSStats(t.stats, stats)
+		if err != nil {
+			removeFiles(t.files())
+			return narrationTrack{}, err
+		}
+		t.names = append(t.names, names...)
+		for fn, p := range paths {
+			t.paths[fn] = p
+		}
+		if len(runs) == 1 {
+			t.words = words
+			continue
+		}
+		if !aligned || words == nil {
+			t.words, aligned = nil, false
+			continue
+		}
+		for _, w := range words {
+			t.words = append(t.words, models.WordTiming{Word: w.Word, Start: w.Start + offset, End: w.End + offset})
+		}
+		if i < len(runs)-1 {
+			d, err := cc.narrationDuration(ctx, paths, names)
+			if err != nil {
+				log.Printf("narration word timings dropped: %v", err)
+				t.words, aligned = nil, false
+				continue
+			}
+			offset += d
+		}
+	}
+	return t, nil
+}
+
+// narrationDuration is the combined length of the named clips
+func (cc *CompositionCompiler) narrationDuration(ctx context.Context, paths map[string]string, names []string) (float64, error) {
+	total := 0.0
+	for _, fn := range names {
+		d, err := cc.probeDuration(ctx, paths[fn])
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// fitNarration applies the requested strategy. reflow rewrites vc's timeline and regenerate
+// replaces track (removing the clips it supersedes); word timings are rescaled to the tempo.
+// Narration that cannot be measured is left alone rather than failing the render.
+func (cc *CompositionCompiler) fitNarration(ctx context.Context, vc *models.VideoCompositionResponse, input models.TTSInput, opts models.RenderOptions, brand *models.BrandKit, track *narrationTrack, ttsDir string) (narrationFit, error) {
+	mode := opts.NarrationFit
+	if mode == "" {
+		mode = models.NarrationFitTempo
+	}
+	content := timelineDuration(vc.Timeline)
+	if mode == models.NarrationFitNone || len(track.names) == 0 || content <= 0 {
+		return narrationFit{}, nil
+	}
+	spoken, err := cc.narrationDuration(ctx, track.paths, track.names)
+	if err != nil {
+		if ctx.Err() != nil {
+			return narrationFit{}, ctx.Err()
+		}
+		log.Printf("narration fit skipped: %v", err)
+		return narrationFit{}, nil
+	}
+
+	switch mode {
+	case models.NarrationFitRegenerate:
+		speed := clampFloat(spoken/content, minTTSSpeed, maxTTSSpeed)
+		if math.Abs(speed-1) < 0.02 {
+			break
+		}
+		input.Speed = speed
+		regen, err := cc.synthesize(ctx, input, opts.NeedsCaptions(), ttsDir)
+		if err == nil {
+			var d float64
+			if d, err = cc.narrationDuration(ctx, regen.paths, regen.names); err != nil {
+				removeFiles(regen.files())
+			} else {
+				spoken = d
+				regen.stats = addTTSStats(track.stats, regen.stats)
+				removeFiles(track.files())
+				*track = regen
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return narrationFit{}, ctx.Err()
+			}
+			// the first take is still usable; the tempo below gets it as close as it can
+			log.Printf("narration regenerate at speed %.2f failed, keeping the original: %v", speed, err)
+		}
+	case models.NarrationFitReflow:
+		reflowTimeline(vc, spoken)
+		content = timelineDuration(vc.Timeline)
+	}
+
+	fit := narrationFit{Tempo: clampFloat(spoken/content, minNarrationTempo, maxNarrationTempo), Length: content}
+	if math.Abs(fit.Tempo-1) < 0.01 {
+		fit.Tempo = 1
+	}
+	for i := range track.words {
+		track.words[i].Start /= fit.Tempo
+		track.words[i].End /= fit.Tempo
+	}
+	if brand != nil && brand.HasEndCard() {
+		// keep the music bed running under the end card
+		fit.Length += brand.EndCardDuration
+	}
+	return fit, nil
+}
+
+// probeDuration returns a media file's duration in seconds
+func (cc *CompositionCompiler) probeDuration(ctx context.Context, path string) (float64, error) {
+	out, err := exec.CommandContext(ctx, cc.ffprobePath, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: %v", path, err)
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("ffprobe %s: unexpected duration %q", path, strings.TrimSpace(string(out)))
+	}
+	return d, nil
+}
+
+// timelineDuration is the length of the concatenated image segments in seconds
+func timelineDuration(tl models.Timeline) float64 {
+	total := 0
+	for _, seg := range tl.ImageTimeline.ImageSegments {
+		total += seg.Duration
+	}
+	return float64(total)
+}
+
+// reflowTimeline rescales whole-second image segment durations so they add up to target
+// (rounded, at least one second each), then moves text segments proportionally
+func reflowTimeline(vc *models.VideoCompositionResponse, target float64) {
+	segs := vc.Timeline.ImageTimeline.ImageSegments
+	old := timelineDuration(vc.Timeline)
+	if len(segs) == 0 || old <= 0 {
+		return
+	}
+	total := max(int(math.Round(target)), len(segs))
+	scale := float64(total) / old
+
+	weights := make([]float64, len(segs))
+	for i, seg := range segs {
+		weights[i] = float64(seg.Duration)
+	}
+	for i, d := range apportion(weights, total) {
+		segs[i].Duration = d
+	}
+
+	// segments play back to back in start order
+	byStart := make([]int, len(segs))
+	for i := range byStart {
+		byStart[i] = i
+	}
+	sort.SliceStable(byStart, func(a, b int) bool { return segs[byStart[a]].StartTime < segs[byStart[b]].StartTime })
+	start := 0
+	for _, i := range byStart {
+		segs[i].StartTime = start
+		start += segs[i].Duration
+	}
+
+	texts := vc.Timeline.TextTimeline.TextSegments
+	for i, t := range texts {
+		s := int(math.Round(float64(t.StartTime) * scale))
+		e := int(math.Round(float64(t.StartTime+t.Duration) * scale))
+		texts[i].StartTime, texts[i].Duration = s, max(e-s, 1)
+	}
+	vc.Timeline.TotalDuration = total
+	vc.Metadata.TotalDuration = total
+}
+
+// apportion splits total whole seconds in proportion to weights, each part at least one second;
+// largest remainders keep the sum exact
+func apportion(weights []float64, total int) []int {
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	parts := make([]int, len(weights))
+	if len(weights) == 0 || sum <= 0 {
+		return parts
+	}
+	order := make([]int, len(weights))
+	remainders := make([]float64, len(weights))
+	assigned := 0
+	for i, w := range weights {
+		exact := w / sum * float64(total)
+		parts[i] = max(int(math.Floor(exact)), 1)
+		remainders[i] = exact - float64(parts[i])
+		assigned += parts[i]
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for k := 0; assigned != total && k < 2*len(parts); k++ {
+		i := order[k%len(parts)]
+		if assigned < total {
+			parts[i]++
+			assigned++
+		} else if parts[i] > 1 {
+			parts[i]--
+			assigned--
+		}
+	}
+	return parts
+}
+
+func addTTSStats(a, b models.TTSStats) models.TTSStats {
+	return models.TTSStats{CacheHits: a.CacheHits + b.CacheHits, CacheMisses: a.CacheMisses + b.CacheMisses, Characters: a.Characters + b.Characters}
+}
+
+func clampFloat(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
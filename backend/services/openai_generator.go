@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"social-media-ai-video/config"
+	"social-media-ai-video/models"
+)
+
+// openAISystemPrompt frames the task; the schema itself goes in response_format
+const openAISystemPrompt = `You direct short vertical social media videos (reels) made from the user's images.
+Write one video composition for the prompt: a theme, an image timeline that uses the given images by
+imageIndex (0-based, in the order they are attached), and narrated text segments that open with a hook,
+tell the story and end with a call to action. Image and text segments must each cover the whole
+totalDuration without gaps. Keep every text segment short enough to be read aloud in its duration.
+When an image analysis is given, use it: order images by when they were taken if that tells a
+story, describe what their colors and places suggest, and pick a grading that suits their colors
+and brightness.`
+
+// OpenAIGenerator asks an OpenAI-compatible chat completions endpoint for the composition,
+// guiding the answer with the composition JSON schema (structured output) and validating the
+// result against it. Images are attached inline, so the model must accept image input.
+type OpenAIGenerator struct {
+	baseURL string
+	apiKey  string
+	model   string
+	schema  map[string]interface{}
+	// validator checks the answer; structured output only guides it (see Generate)
+	validator *JSONSchema
+	client    *http.Client
+}
+
+func NewOpenAIGenerator(cfg *config.APIConfig, loaded *JSONSchema) *OpenAIGenerator {
+	schema := map[string]interface{}{}
+	for k, v := range loaded.doc {
+		// meta keywords the endpoint does not take
+		if k != "$schema" && k != "$id" {
+			schema[k] = v
+		}
+	}
+	return &OpenAIGenerator{
+		baseURL:   strings.TrimRight(cfg.OpenAIBaseURL, "/"),
+		apiKey:    cfg.OpenAIAPIKey,
+		model:     cfg.OpenAIModel,
+		schema:    schema,
+		validator: loaded,
+		client:    &http.Client{Timeout: cfg.N8NTimeout},
+	}
+}
+
+func (og *OpenAIGenerator) Generate(ctx context.Context, videoRequest models.VideoGenerationRequest) ([]byte, error) {
+	names := make([]string, len(videoRequest.Images))
+	for i := range names {
+		names[i] = fmt.Sprintf("%d: %s", i, imageName(videoRequest, i))
+	}
+	text := fmt.Sprintf("Prompt: %s\n\nImages (%d):\n%s", videoRequest.Prompt, len(names), strings.Join(names, "\n"))
+	if len(videoRequest.ImageContext) > 0 {
+		analysis, err := json.Marshal(videoRequest.ImageContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal image context: %v", err)
+		}
+		text += "\n\nImage analysis (JSON):\n" + string(analysis)
+	}
+	content := []map[string]interface{}{{"type": "text", "text": text}}
+	for _, img := range videoRequest.Images {
+		content = append(content, map[string]interface{}{
+			"type": "image_url",
+			"image_url": map[string]string{
+				"url": "data:" + http.DetectContentType(img) + ";base64," + base64.StdEncoding.EncodeToString(img),
+			},
+		})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model": og.model,
+		"messages": []map[string]interface{}{
+			{"role": "system", "content": openAISystemPrompt},
+			{"role": "user", "content": content},
+		},
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "video_composition",
+				"schema": og.schema,
+				// strict mode rejects keywords the schema relies on (oneOf, numeric bounds), so
+				// the schema only guides the answer; it is validated below
+				"strict": false,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal completion request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, og.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if og.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+og.apiKey)
+	}
+	resp, err := og.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("completion request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read completion response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("completion API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var parsed struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+			Message      struct {
+				Content string `json:"content"`
+				Refusal string `json:"refusal"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode completion response: %v", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("completion API returned no choices")
+	}
+	choice := parsed.Choices[0]
+	switch {
+	case choice.Message.Refusal != "":
+		return nil, fmt.Errorf("model refused: %s", choice.Message.Refusal)
+	case choice.FinishReason == "length":
+		return nil, fmt.Errorf("composition was cut off at the model's token limit")
+	case strings.TrimSpace(choice.Message.Content) == "":
+		return nil, fmt.Errorf("completion API returned an empty composition")
+	}
+	composition := []byte(choice.Message.Content)
+	if err := og.validator.ValidateComposition(composition); err != nil {
+		return nil, fmt.Errorf("openai generator: %w", err)
+	}
+	return composition, nil
+}
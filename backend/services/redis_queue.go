@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// RedisRenderQueue splits rendering out of the API process. On the API side Execute is the
+// scheduler's RenderExecutor: it pushes the task onto a Redis list and blocks until a worker
+// posts the outcome, so priorities, backpressure and the job store stay in the API. Workers
+// (APP_MODE=worker) pop tasks, run the local RenderPipeline and push the outcome back.
+//
+// A worker moves each task into its own processing list (BLMOVE, Redis 6.2+) rather than popping it, and
+// keeps a heartbeat key alive while it runs. When the heartbeat of a worker lapses (it crashed
+// or was killed) any other worker moves that worker's tasks back onto the queue. Before running
+// a task a worker takes a short-lived lease on the job ID; a task whose job is leased by another
+// worker (e.g. resubmitted by an API restart while still rendering) is dropped, and one whose job
+// already finished gets the recorded outcome delivered again instead of a second render.
+// Kept renders fetch their inputs from and publish their outputs to Storage, so with the s3
+// backend workers need no shared disk; streamed renders hand the video over by path and need
+// UPLOAD_DIR shared, as do brand kits under DATA_DIR.
+
+const (
+	redisQueueKey            = "render:queue"
+	redisResultKeyPrefix     = "render:result:"
+	redisCancelKeyPrefix     = "render:cancel:"
+	redisWorkersKey          = "render:workers"
+	redisProcessingKeyPrefix = "render:processing:"
+	redisHeartbeatKeyPrefix  = "render:worker:"
+	redisLeaseKeyPrefix      = "render:lease:"
+	redisDoneKeyPrefix       = "render:done:"
+	// a worker whose heartbeat is older than this is considered dead and its tasks are requeued
+	redisHeartbeatTTL = 30 * time.Second
+	// job leases lapse before the heartbeat does, so a requeued task is never taken for a duplicate
+	redisLeaseTTL = 15 * time.Second
+	// how long finished outcomes and cancel flags live if nobody picks them up
+	redisResultTTL = time.Hour
+	// blocking pops wake up this often to notice cancellation and shutdown
+	redisPollInterval = 2 * time.Second
+	// extra time a worker gets past the job timeout before the API gives up on it
+	redisWorkerGrace = time.Minute
+)
+
+// queuedRender is the message on the render queue
+type queuedRender struct {
+	ID   string     `json:"id"`
+	Task RenderTask `json:"task"`
+}
+
+// renderOutcome is what a worker reports back; Paths parallels Result.Artifacts
+// since artifact paths are not part of their public JSON
+type renderOutcome struct {
+	Result       *models.RenderResult `json:"result,omitempty"`
+	Paths        []string             `json:"paths,omitempty"`
+	Error        string               `json:"error,omitempty"`
+	CompileError bool                 `json:"compileError,omitempty"`
+	TTSError     string               `json:"ttsError,omitempty"`
+	FFmpegOutput string               `json:"ffmpegOutput,omitempty"`
+}
+
+type RedisRenderQueue struct {
+	client        *redis.Client
+	resultTimeout time.Duration
+}
+
+// NewRedisRenderQueue connects to cfg.RedisURL
+func NewRedisRenderQueue(cfg *config.APIConfig) (*RedisRenderQueue, error) {
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %v", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+	return &RedisRenderQueue{client: client, resultTimeout: cfg.JobTimeout + redisWorkerGrace}, nil
+}
+
+func (q *RedisRenderQueue) Close() error {
+	return q.client.Close()
+}
+
+// Execute hands the task to a worker and waits for its outcome. Cancelling ctx withdraws the
+// task if no worker has taken it yet, otherwise asks the worker to stop.
+func (q *RedisRenderQueue) Execute(ctx context.Context, id string, task RenderTask) (*models.RenderResult, error) {
+	msg, err := json.Marshal(queuedRender{ID: id, Task: task})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode render task: %v", err)
+	}
+	if err := q.client.LPush(ctx, redisQueueKey, msg).Err(); err != nil {
+		return nil, fmt.Errorf("failed to enqueue render: %v", err)
+	}
+
+	deadline := time.Now().Add(q.resultTimeout)
+	for time.Now().Before(deadline) {
+		vals, err := q.client.BLPop(ctx, redisPollInterval, redisResultKeyPrefix+id).Result()
+		switch {
+		case err == nil:
+			return decodeOutcome(vals[1])
+		case ctx.Err() != nil:
+			q.withdraw(id, msg)
+			return nil, ctx.Err()
+		case !errors.Is(err, redis.Nil):
+			return nil, fmt.Errorf("failed to read render result: %v", err)
+		}
+	}
+	q.withdraw(id, msg)
+	return nil, fmt.Errorf("no render worker finished job %s within %s", id, q.resultTimeout)
+}
+
+// withdraw removes a still-queued task or flags a running one for cancellation
+func (q *RedisRenderQueue) withdraw(id string, msg []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if removed, err := q.client.LRem(ctx, redisQueueKey, 1, msg).Result(); err == nil && removed > 0 {
+		return
+	}
+	if err := q.client.Set(ctx, redisCancelKeyPrefix+id, 1, redisResultTTL).Err(); err != nil {
+		log.Printf("job %s: failed to signal cancel: %v", id, err)
+	}
+}
+
+// RunWorker pulls tasks with concurrency parallel loops until stop is done, then lets running
+// renders finish for up to drain. Renders still running after that are killed and put back on
+// the queue for another worker.
+func (q *RedisRenderQueue) RunWorker(stop context.Context, concurrency int, drain time.Duration, execute RenderExecutor) {
+	hard, kill := context.WithCancel(context.Background())
+	defer kill()
+
+	w := &redisWorker{queue: q, id: NewID()}
+	alive, die := context.WithCancel(context.Background())
+	if err := w.register(alive); err != nil {
+		log.Printf("render queue: failed to register worker: %v", err)
+	}
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		w.heartbeat(alive)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.workLoop(stop, hard, execute)
+		}()
+	}
+
+	<-stop.Done()
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(drain):
+		kill()
+		<-finished
+	}
+	die()
+	<-heartbeatDone
+	w.unregister()
+}
+
+// redisWorker is one worker process: its processing list holds the tasks it has taken
+type redisWorker struct {
+	queue *RedisRenderQueue
+	id    string
+}
+
+func (w *redisWorker) processingKey() string { return redisProcessingKeyPrefix + w.id }
+
+func (w *redisWorker) register(ctx context.Context) error {
+	pipe := w.queue.client.TxPipeline()
+	pipe.SAdd(ctx, redisWorkersKey, w.id)
+	pipe.Set(ctx, redisHeartbeatKeyPrefix+w.id, 1, redisHeartbeatTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// unregister removes a worker that stopped; tasks it could not hand back go back on the queue
+func (w *redisWorker) unregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w.requeueAll(ctx, w.id)
+}
+
+// heartbeat keeps the worker's heartbeat alive and requeues the tasks of dead workers until ctx is done
+func (w *redisWorker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(redisHeartbeatTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.queue.client.Set(ctx, redisHeartbeatKeyPrefix+w.id, 1, redisHeartbeatTTL).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("render queue: heartbeat: %v", err)
+		}
+		w.reapDead(ctx)
+	}
+}
+
+// reapDead puts the tasks of workers whose heartbeat lapsed back on the queue
+func (w *redisWorker) reapDead(ctx context.Context) {
+	ids, err := w.queue.client.SMembers(ctx, redisWorkersKey).Result()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if n, err := w.queue.client.Exists(ctx, redisHeartbeatKeyPrefix+id).Result(); err != nil || n > 0 {
+			continue
+		}
+		if moved := w.requeueAll(ctx, id); moved > 0 {
+			log.Printf("render queue: worker %s stopped responding, requeued %d tasks", id, moved)
+		}
+	}
+}
+
+// requeueAll moves every task in worker id's processing list to the pop end of the queue and
+// forgets the worker. Returns the number of tasks moved.
+func (w *redisWorker) requeueAll(ctx context.Context, id string) int {
+	moved := 0
+	for {
+		err := w.queue.client.LMove(ctx, redisProcessingKeyPrefix+id, redisQueueKey, "RIGHT", "RIGHT").Err()
+		if errors.Is(err, redis.Nil) {
+			break
+		}
+		if err != nil {
+			log.Printf("render queue: failed to requeue tasks of worker %s: %v", id, err)
+			return moved
+		}
+		moved++
+	}
+	pipe := w.queue.client.TxPipeline()
+	pipe.SRem(ctx, redisWorkersKey, id)
+	pipe.Del(ctx, redisHeartbeatKeyPrefix+id)
+	pipe.Exec(ctx)
+	return moved
+}
+
+func (w *redisWorker) workLoop(stop, hard context.Context, execute RenderExecutor) {
+	for stop.Err() == nil {
+		raw, err := w.queue.client.BLMove(stop, redisQueueKey, w.processingKey(), "RIGHT", "LEFT", redisPollInterval).Result()
+		if stop.Err() != nil || errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Printf("render queue: %v", err)
+			select {
+			case <-stop.Done():
+			case <-time.After(redisPollInterval):
+			}
+			continue
+		}
+		var msg queuedRender
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			log.Printf("render queue: dropping malformed task: %v", err)
+			w.ack(raw, "")
+			continue
+		}
+		if !w.lease(msg.ID) {
+			log.Printf("job %s: already rendered or rendering elsewhere, dropping duplicate task", msg.ID)
+			w.ack(raw, "")
+			continue
+		}
+		w.runOne(hard, raw, msg, execute)
+	}
+}
+
+// lease claims job id for this worker. It fails when another worker holds a live lease, or when
+// the job already finished, in which case its outcome is posted again for whoever waits on it.
+func (w *redisWorker) lease(id string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := w.queue.client
+	if outcome, err := c.Get(ctx, redisDoneKeyPrefix+id).Result(); err == nil {
+		if n, err := c.LLen(ctx, redisResultKeyPrefix+id).Result(); err == nil && n == 0 {
+			pipe := c.TxPipeline()
+			pipe.RPush(ctx, redisResultKeyPrefix+id, outcome)
+			pipe.Expire(ctx, redisResultKeyPrefix+id, redisResultTTL)
+			pipe.Exec(ctx)
+		}
+		return false
+	}
+	ok, err := c.SetNX(ctx, redisLeaseKeyPrefix+id, w.id, redisLeaseTTL).Result()
+	if err != nil {
+		// rendering twice beats losing the job over a redis hiccup
+		log.Printf("job %s: failed to take lease: %v", id, err)
+		return true
+	}
+	return ok
+}
+
+// ack removes a handled task from the processing list and releases its lease
+func (w *redisWorker) ack(raw, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipe := w.queue.client.TxPipeline()
+	pipe.LRem(ctx, w.processingKey(), 1, raw)
+	if id != "" {
+		pipe.Del(ctx, redisLeaseKeyPrefix+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("render queue: failed to acknowledge task: %v", err)
+	}
+}
+
+func (w *redisWorker) runOne(hard context.Context, raw string, msg queuedRender, execute RenderExecutor) {
+	q := w.queue
+	jobCtx, cancel := context.WithCancel(hard)
+	defer cancel()
+
+	// watch for a cancel request from the API and keep the job's lease alive
+	var canceled atomic.Bool
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		renew := time.NewTicker(redisLeaseTTL / 3)
+		defer renew.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-renew.C:
+				if err := q.client.Expire(jobCtx, redisLeaseKeyPrefix+msg.ID, redisLeaseTTL).Err(); err != nil && jobCtx.Err() == nil {
+					log.Printf("job %s: failed to renew lease: %v", msg.ID, err)
+				}
+			case <-ticker.C:
+				if n, err := q.client.Exists(jobCtx, redisCancelKeyPrefix+msg.ID).Result(); err == nil && n > 0 {
+					canceled.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	log.Printf("job %s: rendering", msg.ID)
+	result, err := execute(jobCtx, msg.ID, msg.Task)
+	cancel()
+
+	ctx, done := context.WithTimeout(context.Background(), 10*time.Second)
+	defer done()
+	if hard.Err() != nil && !canceled.Load() {
+		// killed by this worker's shutdown: hand it to the next worker (the pop end of the list)
+		pipe := q.client.TxPipeline()
+		pipe.LRem(ctx, w.processingKey(), 1, raw)
+		pipe.RPush(ctx, redisQueueKey, raw)
+		pipe.Del(ctx, redisLeaseKeyPrefix+msg.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("job %s: failed to requeue: %v", msg.ID, err)
+		}
+		return
+	}
+
+	outcome, encErr := json.Marshal(newOutcome(result, err))
+	if encErr != nil {
+		log.Printf("job %s: failed to encode outcome: %v", msg.ID, encErr)
+		w.ack(raw, msg.ID)
+		return
+	}
+	key := redisResultKeyPrefix + msg.ID
+	pipe := q.client.TxPipeline()
+	pipe.RPush(ctx, key, outcome)
+	pipe.Expire(ctx, key, redisResultTTL)
+	pipe.Set(ctx, redisDoneKeyPrefix+msg.ID, outcome, redisResultTTL)
+	pipe.Del(ctx, redisCancelKeyPrefix+msg.ID)
+	pipe.LRem(ctx, w.processingKey(), 1, raw)
+	pipe.Del(ctx, redisLeaseKeyPrefix+msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("job %s: failed to report outcome: %v", msg.ID, err)
+	}
+	log.Printf("job %s: done (error: %v)", msg.ID, err)
+}
+
+func newOutcome(result *models.RenderResult, err error) renderOutcome {
+	if err != nil {
+		out := renderOutcome{Error: err.Error()}
+		var compileErr *CompileError
+		out.CompileError = errors.As(err, &compileErr)
+		var ffErr *FFmpegError
+		if errors.As(err, &ffErr) {
+			out.FFmpegOutput = ffErr.Output
+		}
+		var ttsErr *TTSError
+		if errors.As(err, &ttsErr) {
+			out.TTSError = ttsErr.Kind.Error()
+		}
+		return out
+	}
+	out := renderOutcome{Result: result}
+	for _, a := range result.Artifacts {
+		out.Paths = append(out.Paths, a.Path)
+	}
+	return out
+}
+
+// decodeOutcome turns a worker's report back into the result or typed error Execute would return locally
+func decodeOutcome(raw string) (*models.RenderResult, error) {
+	var out renderOutcome
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, fmt.Errorf("failed to decode render result: %v", err)
+	}
+	switch {
+	case out.FFmpegOutput != "":
+		return nil, &remoteError{msg: out.Error, cause: &FFmpegError{Err: errors.New(out.Error), Output: out.FFmpegOutput}}
+	case out.CompileError:
+		return nil, &remoteError{msg: out.Error, cause: &CompileError{Err: errors.New(out.Error)}}
+	case out.TTSError != "":
+		kind := ErrTTSTransient
+		for _, k := range ttsErrorKinds {
+			if k.Error() == out.TTSError {
+				kind = k
+			}
+		}
+		return nil, &remoteError{msg: out.Error, cause: &TTSError{Kind: kind, Message: out.Error}}
+	case out.Error != "":
+		return nil, errors.New(out.Error)
+	case out.Result == nil:
+		return nil, fmt.Errorf("render worker returned no result")
+	}
+	for i := range out.Result.Artifacts {
+		if i < len(out.Paths) {
+			out.Result.Artifacts[i].Path = out.Paths[i]
+		}
+	}
+	return out.Result, nil
+}
+
+// remoteError keeps a worker's error message verbatim while still unwrapping to its type
+type remoteError struct {
+	msg   string
+	cause error
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+func (e *remoteError) Unwrap() error { return e.cause }
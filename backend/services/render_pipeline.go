@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// RenderTask is everything a worker needs to produce one render. It is plain data
+// (no handles into the HTTP request) so it can be queued and run later.
+type RenderTask struct {
+	Composition []byte   `json:"composition"`
+	ImagePaths  []string `json:"imagePaths"`
+	// ImageKeys locate the same images in storage, for workers that do not share the workspace
+	ImageKeys  []string             `json:"imageKeys,omitempty"`
+	ImageInfos []models.ImageInfo   `json:"imageInfos,omitempty"`
+	Options    models.RenderOptions `json:"options"`
+	// WorkspaceDir holds the inputs; with Detached the scheduler removes it once the job finishes
+	WorkspaceDir string `json:"workspaceDir"`
+	// UserID is who submitted the job; narration characters are accounted to them
+	UserID string `json:"userId,omitempty"`
+	// Keep stages the render in RenderOutputDir/<job id> and moves it to storage instead of
+	// rendering into the workspace
+	Keep bool `json:"keep"`
+	// Detached means no request is waiting on the job, so it owns its workspace
+	Detached bool `json:"detached"`
+}
+
+// HasInputs reports whether task's images can still be read, from its workspace or storage
+func (t RenderTask) HasInputs() bool {
+	if len(t.ImagePaths) == 0 {
+		return false
+	}
+	if len(t.ImageKeys) == len(t.ImagePaths) {
+		return true
+	}
+	for _, p := range t.ImagePaths {
+		if _, err := os.Stat(p); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CompileError marks failures caused by the composition itself rather than the encoder
+type CompileError struct {
+	Err error
+}
+
+func (e *CompileError) Error() string { return e.Err.Error() }
+
+func (e *CompileError) Unwrap() error { return e.Err }
+
+// RenderPipeline compiles a task and runs ffmpeg; it is what scheduler workers execute
+type RenderPipeline struct {
+	compiler   *CompositionCompiler
+	renderer   *Renderer
+	storage    Storage
+	outputDir  string
+	jobTimeout time.Duration
+}
+
+func NewRenderPipeline(cfg *config.APIConfig, compiler *CompositionCompiler, renderer *Renderer, storage Storage) *RenderPipeline {
+	return &RenderPipeline{compiler: compiler, renderer: renderer, storage: storage, outputDir: cfg.RenderOutputDir, jobTimeout: cfg.JobTimeout}
+}
+
+// Execute renders task under the given id. Kept renders are staged under RenderOutputDir/<id>
+// and then moved to storage at renders/<id>/...; their artifacts carry storage keys, not URLs.
+// Cancelling ctx stops TTS and kills ffmpeg; partial outputs and temp files are removed.
+func (rp *RenderPipeline) Execute(ctx context.Context, id string, task RenderTask) (*models.RenderResult, error) {
+	if rp.jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rp.jobTimeout)
+		defer cancel()
+	}
+
+	ctx = WithTTSUser(ctx, task.UserID)
+
+	fetched, err := rp.fetchInputs(ctx, &task)
+	if err != nil {
+		return nil, err
+	}
+	if fetched {
+		defer os.RemoveAll(task.WorkspaceDir)
+	}
+
+	outputPath := filepath.Join(task.WorkspaceDir, "output.mp4")
+	renderDir := ""
+	if task.Keep {
+		renderDir = filepath.Join(rp.outputDir, id)
+		if err := os.MkdirAll(renderDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create render dir: %v", err)
+		}
+		// the marker lets startup cleanup spot renders interrupted by a crash
+		if err := os.WriteFile(filepath.Join(renderDir, incompleteMarker), nil, 0o644); err != nil {
+			os.RemoveAll(renderDir)
+			return nil, fmt.Errorf("failed to mark render dir: %v", err)
+		}
+		outputPath = filepath.Join(renderDir, "video.mp4")
+	}
+	fail := func(err error) (*models.RenderResult, error) {
+		if renderDir != "" {
+			os.RemoveAll(renderDir)
+		}
+		return nil, err
+	}
+
+	// Compile with AI schema blob and local image paths
+	compiled, err := rp.compiler.Compile(ctx, task.Composition, task.ImagePaths, outputPath, task.Options)
+	if err != nil {
+		// provider failures (auth, quota, outages) are not the composition's fault
+		var ttsErr *TTSError
+		if ctx.Err() != nil || errors.As(err, &ttsErr) {
+			return fail(err)
+		}
+		return fail(&CompileError{Err: err})
+	}
+	defer removeFiles(compiled.TempFiles)
+
+	result, err := rp.renderer.Render(ctx, compiled, task.Options)
+	if err != nil {
+		return fail(err)
+	}
+	result.ID = id
+	result.Images = task.ImageInfos
+	result.TTS = compiled.TTS
+	if task.Keep {
+		if err := rp.publish(ctx, id, result); err != nil {
+			return fail(err)
+		}
+		os.RemoveAll(renderDir)
+	}
+	return result, nil
+}
+
+// Discard removes a finished render's outputs: stored artifacts, local files and its staging dir
+func (rp *RenderPipeline) Discard(id string, result *models.RenderResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, a := range result.Artifacts {
+		if a.Key != "" {
+			if err := rp.storage.Delete(ctx, a.Key); err != nil {
+				log.Printf("job %s: failed to discard %s: %v", id, a.Key, err)
+			}
+		} else if a.Path != "" {
+			os.Remove(a.Path)
+		}
+	}
+	os.RemoveAll(filepath.Join(rp.outputDir, id))
+}
+
+// publish uploads a kept render's artifacts; Path keeps pointing at the staged file until the caller removes it
+func (rp *RenderPipeline) publish(ctx context.Context, id string, result *models.RenderResult) error {
+	for i, a := range result.Artifacts {
+		key := renderKey(id, filepath.Base(a.Path))
+		if err := PutFile(ctx, rp.storage, key, a.Path, a.ContentType); err != nil {
+			// drop what already made it so a failed job leaves nothing behind
+			for _, done := range result.Artifacts[:i] {
+				rp.storage.Delete(context.Background(), done.Key)
+			}
+			return fmt.Errorf("failed to store %s: %v", a.Kind, err)
+		}
+		result.Artifacts[i].Key = key
+		result.Artifacts[i].URL = ""
+	}
+	return nil
+}
+
+// fetchInputs downloads the task's images when its workspace is not on this machine (a render
+// worker without the API's UPLOAD_DIR). It reports whether it created the workspace.
+func (rp *RenderPipeline) fetchInputs(ctx context.Context, task *RenderTask) (bool, error) {
+	if len(task.ImageKeys) == 0 || len(task.ImageKeys) != len(task.ImagePaths) {
+		return false, nil
+	}
+	if _, err := os.Stat(task.WorkspaceDir); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(task.WorkspaceDir, 0o755); err != nil {
+		return false, fmt.Errorf("failed to create workspace: %v", err)
+	}
+	for i, key := range task.ImageKeys {
+		if err := FetchFile(ctx, rp.storage, key, task.ImagePaths[i]); err != nil {
+			os.RemoveAll(task.WorkspaceDir)
+			return false, fmt.Errorf("failed to fetch input image: %v", err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// Renderer runs the compiled ffmpeg command and derives secondary artifacts
+// (thumbnail, previews, proxy, contact sheet) from the finished video.
+// Each artifact is its own ffmpeg invocation against the rendered MP4 so a
+// failing extra never corrupts the main output.
+
+const (
+	previewSeconds     = 6    // length of GIF/WebP previews
+	previewWidth       = 360  // width of GIF/WebP previews and contact sheet tiles
+	proxyHeight        = 640  // height of the low-res proxy MP4
+	thumbnailScanLimit = 300  // frames considered by the thumbnail filter when picking the best frame
+	logOutputLimit     = 2048 // bytes of ffmpeg output kept in the log on failure
+)
+
+type Renderer struct {
+	ffmpegPath string
+	timeout    time.Duration
+}
+
+func NewRenderer(cfg *config.APIConfig) *Renderer {
+	return &Renderer{ffmpegPath: "ffmpeg", timeout: cfg.FFmpegTimeout}
+}
+
+// FFmpegError carries ffmpeg's combined output for diagnostics
+type FFmpegError struct {
+	Err    error
+	Output string
+}
+
+func (e *FFmpegError) Error() string { return fmt.Sprintf("ffmpeg failed: %v", e.Err) }
+
+// Run executes ffmpeg with the given args. The process is killed when ctx is done or the
+// per-invocation timeout passes.
+func (r *Renderer) Run(ctx context.Context, args []string) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, r.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("ffmpeg stopped: %w", ctxErr)
+		}
+		log.Printf("ffmpeg failed: %v: %s", err, outputTail(output))
+		return &FFmpegError{Err: err, Output: string(output)}
+	}
+	return nil
+}
+
+// outputTail keeps the end of ffmpeg's output, where the actual error is reported
+func outputTail(output []byte) string {
+	if len(output) <= logOutputLimit {
+		return string(output)
+	}
+	return "..." + string(output[len(output)-logOutputLimit:])
+}
+
+// Render runs the main encode, then every extra artifact requested in opts.
+// Artifacts are written next to the main output; URLs are left for the caller to fill.
+func (r *Renderer) Render(ctx context.Context, cr *CompiledRender, opts models.RenderOptions) (*models.RenderResult, error) {
+	if err := r.Run(ctx, cr.Args); err != nil {
+		return nil, err
+	}
+
+	// Ensure output file exists and is non-empty before serving
+	video, err := newArtifact(models.ArtifactVideo, cr.OutputPath, "video/mp4")
+	if err != nil {
+		return nil, fmt.Errorf("output file missing or empty: %v", err)
+	}
+	result := &models.RenderResult{Artifacts: []models.Artifact{video}}
+
+	outDir := filepath.Dir(cr.OutputPath)
+	for _, kind := range opts.Outputs {
+		if kind == models.ArtifactVideo {
+			continue
+		}
+		if kind == models.ArtifactNarration {
+			for _, p := range cr.NarrationFiles {
+				a, err := newArtifact(kind, p, "audio/mpeg")
+				if err != nil {
+					return nil, fmt.Errorf("narration clip missing or empty: %v", err)
+				}
+				result.Artifacts = append(result.Artifacts, a)
+			}
+			continue
+		}
+		// caption sidecars are written by the compiler before encoding
+		if a, ok := cr.sidecar(kind); ok {
+			result.Artifacts = append(result.Artifacts, a)
+			continue
+		}
+		path, contentType, args, err := artifactCommand(kind, cr, opts, outDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.Run(ctx, args); err != nil {
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		a, err := newArtifact(kind, path, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%s output missing or empty: %v", kind, err)
+		}
+		result.Artifacts = append(result.Artifacts, a)
+	}
+	return result, nil
+}
+
+// ParseArtifactKinds validates a client-supplied list of extra outputs
+func ParseArtifactKinds(values []string) ([]models.ArtifactKind, error) {
+	var kinds []models.ArtifactKind
+	seen := map[models.ArtifactKind]bool{}
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			kind := models.ArtifactKind(strings.TrimSpace(part))
+			if kind == "" || seen[kind] {
+				continue
+			}
+			switch kind {
+			case models.ArtifactThumbnail, models.ArtifactPreviewGIF, models.ArtifactPreviewWebP,
+				models.ArtifactProxy, models.ArtifactContactSheet,
+				models.ArtifactSubtitlesSRT, models.ArtifactSubtitlesVTT, models.ArtifactSubtitlesASS,
+				models.ArtifactNarration:
+			default:
+				return nil, fmt.Errorf("unknown output %q", kind)
+			}
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds, nil
+}
+
+func newArtifact(kind models.ArtifactKind, path, contentType string) (models.Artifact, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return models.Artifact{}, err
+	}
+	if fi.Size() == 0 {
+		return models.Artifact{}, fmt.Errorf("%s is empty", path)
+	}
+	return models.Artifact{Kind: kind, Path: path, ContentType: contentType, Size: fi.Size()}, nil
+}
+
+// artifactCommand returns the output path, content type and ffmpeg args for one extra artifact
+func artifactCommand(kind models.ArtifactKind, cr *CompiledRender, opts models.RenderOptions, outDir string) (string, string, []string, error) {
+	in := cr.OutputPath
+	switch kind {
+	case models.ArtifactThumbnail:
+		out := filepath.Join(outDir, "thumbnail.jpg")
+		mids := segmentMidpoints(cr.Composition.Timeline)
+		if opts.ThumbnailSegment != nil {
+			i := *opts.ThumbnailSegment
+			if i < 0 || i >= len(mids) {
+				return "", "", nil, fmt.Errorf("thumbnail segment %d out of range (0..%d)", i, len(mids)-1)
+			}
+			mid := mids[i]
+			return out, "image/jpeg", []string{"-y", "-ss", fmt.Sprintf("%.3f", mid), "-i", in, "-frames:v", "1", "-q:v", "2", out}, nil
+		}
+		// thumbnail filter picks the most representative frame of each batch
+		return out, "image/jpeg", []string{"-y", "-i", in, "-vf", fmt.Sprintf("thumbnail=n=%d", thumbnailScanLimit), "-frames:v", "1", "-q:v", "2", out}, nil
+
+	case models.ArtifactPreviewGIF:
+		out := filepath.Join(outDir, "preview.gif")
+		filter := fmt.Sprintf("fps=12,scale=%d:-1:flags=lanczos,split[a][b];[a]palettegen=stats_mode=diff[p];[b][p]paletteuse=dither=bayer", previewWidth)
+		return out, "image/gif", []string{"-y", "-t", fmt.Sprint(previewSeconds), "-i", in, "-filter_complex", filter, "-loop", "0", out}, nil
+
+	case models.ArtifactPreviewWebP:
+		out := filepath.Join(outDir, "preview.webp")
+		return out, "image/webp", []string{"-y", "-t", fmt.Sprint(previewSeconds), "-i", in,
+			"-vf", fmt.Sprintf("fps=15,scale=%d:-1:flags=lanczos", previewWidth),
+			"-c:v", "libwebp", "-q:v", "60", "-loop", "0", "-an", out}, nil
+
+	case models.ArtifactProxy:
+		out := filepath.Join(outDir, "proxy.mp4")
+		return out, "video/mp4", []string{"-y", "-i", in,
+			"-vf", fmt.Sprintf("scale=-2:%d", proxyHeight),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "30", "-pix_fmt", "yuv420p",
+			"-c:a", "aac", "-b:a", "64k", "-movflags", "+faststart", out}, nil
+
+	case models.ArtifactContactSheet:
+		out := filepath.Join(outDir, "contact_sheet.jpg")
+		mids := segmentMidpoints(cr.Composition.Timeline)
+		if len(mids) == 0 {
+			return "", "", nil, fmt.Errorf("contact sheet needs at least one image segment")
+		}
+		// one frame from the middle of every segment, tiled into a near-square grid
+		var picks []string
+		for _, mid := range mids {
+			picks = append(picks, fmt.Sprintf("eq(n,%d)", int(math.Round(mid*float64(cr.Metadata.FPS)))))
+		}
+		cols := int(math.Ceil(math.Sqrt(float64(len(mids)))))
+		rows := int(math.Ceil(float64(len(mids)) / float64(cols)))
+		filter := fmt.Sprintf("select='%s',scale=%d:-1,tile=%dx%d:padding=8:margin=8",
+			strings.Join(picks, "+"), previewWidth, cols, rows)
+		return out, "image/jpeg", []string{"-y", "-i", in, "-vf", filter, "-fps_mode", "vfr", "-frames:v", "1", "-q:v", "3", out}, nil
+	}
+	return "", "", nil, fmt.Errorf("unknown output %q", kind)
+}
+
+// segmentMidpoints returns the midpoint (seconds) of each image segment in playback order.
+// The builder concatenates segments back to back, so offsets are cumulative durations
+// rather than the AI-supplied start times.
+func segmentMidpoints(tl models.Timeline) []float64 {
+	segs := make([]models.ImageSegment, len(tl.ImageTimeline.ImageSegments))
+	copy(segs, tl.ImageTimeline.ImageSegments)
+	sort.Slice(segs, func(i, j int) bool { return segs[i].StartTime < segs[j].StartTime })
+
+	mids := make([]float64, 0, len(segs))
+	offset := 0.0
+	for _, s := range segs {
+		mids = append(mids, offset+float64(s.Duration)/2)
+		offset += float64(s.Duration)
+	}
+	return mids
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"social-media-ai-video/models"
+)
+
+// RuleGenerator writes compositions without any model or network call, for demos, CI and
+// generator outages. Keywords in the prompt pick a look (theme, transitions, font, voice) and
+// the music; the images share the timeline evenly, in the order they were taken when the image
+// context dates them all; the prompt's sentences become the hook, story and call to action,
+// each shown for as long as its share of the words. Without a matching look the grading follows
+// the images' colors. The same request always yields the same composition, and every
+// composition is checked against the schema.
+type RuleGenerator struct {
+	schema *JSONSchema
+}
+
+func NewRuleGenerator(schema *JSONSchema) *RuleGenerator {
+	return &RuleGenerator{schema: schema}
+}
+
+const (
+	// seconds per image, within the schema's 8 to 15 second videos
+	ruleSecondsPerImage = 3
+	ruleMinDuration     = 8
+	ruleMaxDuration     = 15
+	// shortest time a text segment is on screen
+	ruleMinTextSeconds = 2
+	// schema limit on text segment length
+	maxSegmentText = 100
+)
+
+var sentenceEndRe = regexp.MustCompile(`[.!?]+(\s+|$)`)
+
+// ruleLook is what a family of prompts looks and sounds like
+type ruleLook struct {
+	keywords             []string
+	style, mood, grading string
+	// transition of every image; hookTransition, when set, of the first
+	transition, hookTransition string
+	easing                     string
+	textStyle                  models.TextStyle
+	musicGenre, musicMood      string
+	emphasis                   string
+	// cta closes the video when the prompt has no call to action of its own
+	cta string
+}
+
+// ruleLooks are tried in order; the one with most keyword hits wins. Keywords match word prefixes.
+var ruleLooks = []ruleLook{
+	{
+		keywords: []string{"sale", "launch", "new", "drop", "hype", "energ", "fast", "workout", "fitness", "gym", "party", "sport", "exciting", "limited"},
+		style:    "energetic", mood: "exciting", grading: "vibrant",
+		transition: "cut", hookTransition: "zoom", easing: "linear",
+		textStyle:  models.TextStyle{FontFamily: "Montserrat", TextStyle: "bold"},
+		musicGenre: "upbeat", musicMood: "energetic", emphasis: "excited", cta: "Shop now",
+	},
+	{
+		keywords: []string{"luxur", "elegan", "premium", "exclusive", "estate", "villa", "propert", "jewel", "boutique", "penthouse"},
+		style:    "luxury", mood: "sophisticated", grading: "warm",
+		transition: "zoom", easing: "ease-in-out",
+		textStyle:  models.TextStyle{FontFamily: "Playfair Display", TextStyle: "regular"},
+		musicGenre: "ambient", musicMood: "peaceful", emphasis: "soft", cta: "Book a viewing",
+	},
+	{
+		keywords: []string{"calm", "relax", "peace", "spa", "nature", "travel", "beach", "wellness", "yoga", "slow", "mindful", "retreat"},
+		style:    "calm", mood: "peaceful", grading: "soft",
+		transition: "fade", easing: "ease-in-out",
+		textStyle:  models.TextStyle{FontFamily: "Inter", TextStyle: "light"},
+		musicGenre: "ambient", musicMood: "peaceful", emphasis: "soft", cta: "Plan your escape",
+	},
+	{
+		keywords: []string{"business", "corporate", "team", "service", "professional", "consult", "software", "b2b", "client", "enterprise", "solution"},
+		style:    "professional", mood: "trustworthy", grading: "cool",
+		transition: "fade", easing: "ease-in-out",
+		textStyle:  models.TextStyle{FontFamily: "Inter", TextStyle: "bold"},
+		musicGenre: "corporate", musicMood: "professional", emphasis: "normal", cta: "Get in touch",
+	},
+}
+
+var defaultRuleLook = ruleLook{
+	style: "modern", mood: "friendly", grading: "warm",
+	transition: "fade", easing: "ease-in-out",
+	textStyle:  models.TextStyle{FontFamily: "Montserrat", TextStyle: "bold"},
+	musicGenre: "upbeat", musicMood: "energetic", emphasis: "normal", cta: "Learn more",
+}
+
+// ruleMusic overrides the look's music when the prompt is about one of these
+var ruleMusic = []struct {
+	keywords    []string
+	genre, mood string
+}{
+	{[]string{"inspir", "dream", "goal", "achiev", "motivat", "journey", "success", "grow"}, "uplifting", "motivational"},
+	{[]string{"art", "design", "creativ", "craft", "handmade", "studio", "photograph"}, "minimal", "creative"},
+	{[]string{"calm", "relax", "peace", "spa", "meditat", "sleep"}, "ambient", "peaceful"},
+	{[]string{"business", "corporate", "finance", "professional", "office"}, "corporate", "professional"},
+	{[]string{"party", "dance", "workout", "hype", "celebrat"}, "upbeat", "energetic"},
+}
+
+// ctaVerbs start a sentence that is a call to action
+var ctaVerbs = map[string]bool{
+	"visit": true, "shop": true, "buy": true, "order": true, "book": true, "call": true, "follow": true,
+	"join": true, "try": true, "get": true, "sign": true, "subscribe": true, "learn": true, "discover": true,
+	"download": true, "dm": true, "message": true, "tap": true, "click": true, "save": true, "come": true,
+	"grab": true, "reserve": true, "contact": true,
+}
+
+func (rg *RuleGenerator) Generate(ctx context.Context, videoRequest models.VideoGenerationRequest) ([]byte, error) {
+	if len(videoRequest.Images) == 0 {
+		return nil, fmt.Errorf("at least one image is required")
+	}
+	words := promptWords(videoRequest.Prompt)
+	look, matched := pickRuleLook(words)
+	if !matched {
+		look.grading = gradingForImages(videoRequest.ImageContext, look.grading)
+	}
+	total := min(max(len(videoRequest.Images)*ruleSecondsPerImage, ruleMinDuration), ruleMaxDuration)
+	// one second per image at the least
+	images := min(len(videoRequest.Images), total)
+
+	var vc models.VideoCompositionResponse
+	vc.Metadata = models.Metadata{Resolution: []int{1080, 1920}, TotalDuration: total, AspectRatio: "9:16", Fps: "30"}
+	vc.Theme.Style, vc.Theme.Mood, vc.Theme.Grading = look.style, look.mood, look.grading
+	vc.Timeline.TotalDuration = total
+
+	order := chronologicalOrder(videoRequest.ImageContext, len(videoRequest.Images))
+	at := 0
+	for i, d := range apportion(evenWeights(images), total) {
+		effect := look.transition
+		if i == 0 && look.hookTransition != "" {
+			effect = look.hookTransition
+		}
+		vc.Timeline.ImageTimeline.ImageSegments = append(vc.Timeline.ImageTimeline.ImageSegments, models.ImageSegment{
+			Ordering:   i,
+			ImageIndex: order[i],
+			StartTime:  at,
+			Duration:   d,
+			Transition: models.TransitionTimelineItem{Effect: effect, Easing: look.easing},
+		})
+		at += d
+	}
+
+	vc.Timeline.TextTimeline.TextStyle = look.textStyle
+	segs := narrativeSegments(promptSentences(videoRequest.Prompt), look.cta, total/ruleMinTextSeconds)
+	weights := make([]float64, len(segs))
+	for i, seg := range segs {
+		weights[i] = float64(max(len(strings.Fields(seg.Text)), 2))
+	}
+	// apportion gives each at least a second; the rest of the minimum is added on top
+	pad := ruleMinTextSeconds - 1
+	at = 0
+	for i, d := range apportion(weights, total-pad*len(segs)) {
+		segs[i].StartTime, segs[i].Duration = at, d+pad
+		at += d + pad
+	}
+	vc.Timeline.TextTimeline.TextSegments = segs
+
+	vc.Audio.Narration.Voice = models.TTSVoice{VoiceID: defaultTTSVoice, Emphasis: look.emphasis, Speed: 1, Pitch: 1, Stability: 0.75}
+	vc.Audio.Music.Enabled, vc.Audio.Music.Volume = true, 0.3
+	vc.Audio.Music.Genre, vc.Audio.Music.Mood = pickRuleMusic(words, look)
+
+	out, err := json.Marshal(schemaShaped(vc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal composition: %v", err)
+	}
+	if err := rg.schema.Validate(out); err != nil {
+		return nil, fmt.Errorf("rule-based generator: %w", err)
+	}
+	return out, nil
+}
+
+// ruleComposition is a composition the way the schema has it. The model also carries text
+// segment ids and music fades, which the schema does not allow, so the generator does not
+// marshal it directly; the outer Timeline and Audio shadow the embedded ones.
+type ruleComposition struct {
+	models.VideoCompositionResponse
+	Timeline ruleTimeline `json:"timeline"`
+	Audio    ruleAudio    `json:"audio"`
+}
+
+type ruleTimeline struct {
+	TotalDuration int                  `json:"totalDuration"`
+	ImageTimeline models.ImageTimeline `json:"ImageTimeline"`
+	TextTimeline  struct {
+		TextStyle    models.TextStyle  `json:"TextStyle"`
+		TextSegments []ruleTextSegment `json:"TextSegments"`
+	} `json:"TextTimeline"`
+}
+
+type ruleTextSegment struct {
+	Text            string `json:"text"`
+	StartTime       int    `json:"startTime"`
+	Duration        int    `json:"duration"`
+	Position        string `json:"position"`
+	NarrativeSource string `json:"narrativeSource"`
+	Emphasis        string `json:"emphasis,omitempty"`
+}
+
+type ruleAudio struct {
+	Narration struct {
+		Voice models.TTSVoice `json:"voice"`
+	} `json:"narration"`
+	Music struct {
+		Enabled bool    `json:"enabled"`
+		Genre   string  `json:"genre"`
+		Mood    string  `json:"mood"`
+		Volume  float64 `json:"volume"`
+	} `json:"music"`
+}
+
+// schemaShaped copies vc into the schema's shape
+func schemaShaped(vc models.VideoCompositionResponse) ruleComposition {
+	out := ruleComposition{VideoCompositionResponse: vc}
+	out.Timeline.TotalDuration = vc.Timeline.TotalDuration
+	out.Timeline.ImageTimeline = vc.Timeline.ImageTimeline
+	out.Timeline.TextTimeline.TextStyle = vc.Timeline.TextTimeline.TextStyle
+	for _, seg := range vc.Timeline.TextTimeline.TextSegments {
+		out.Timeline.TextTimeline.TextSegments = append(out.Timeline.TextTimeline.TextSegments, ruleTextSegment{
+			Text:            seg.Text,
+			StartTime:       seg.StartTime,
+			Duration:        seg.Duration,
+			Position:        seg.Position,
+			NarrativeSource: seg.NarrativeSource,
+			Emphasis:        seg.Emphasis,
+		})
+	}
+	out.Audio.Narration = vc.Audio.Narration
+	music := vc.Audio.Music
+	out.Audio.Music.Enabled, out.Audio.Music.Genre, out.Audio.Music.Mood, out.Audio.Music.Volume = music.Enabled, music.Genre, music.Mood, music.Volume
+	return out
+}
+
+// narrativeSegments splits sentences into a hook, story beats and a call to action, the prompt's
+// own when its last sentence is one, else cta; at most limit segments
+func narrativeSegments(sentences []string, cta string, limit int) []models.TextSegment {
+	hook := "Check this out"
+	if len(sentences) > 0 {
+		hook, sentences = sentences[0], sentences[1:]
+	}
+	if n := len(sentences); n > 0 && isCallToAction(sentences[n-1]) {
+		cta, sentences = sentences[n-1], sentences[:n-1]
+	}
+	if len(sentences) > limit-2 {
+		sentences = sentences[:max(limit-2, 0)]
+	}
+
+	segs := []models.TextSegment{{Text: hook, Position: "center", NarrativeSource: "hook"}}
+	for i, s := range sentences {
+		segs = append(segs, models.TextSegment{Text: s, Position: "center", NarrativeSource: fmt.Sprintf("story[%d]", i)})
+	}
+	return append(segs, models.TextSegment{Text: cta, Position: "center", NarrativeSource: "cta", Emphasis: "strong"})
+}
+
+func isCallToAction(sentence string) bool {
+	words := promptWords(sentence)
+	return len(words) > 0 && ctaVerbs[words[0]]
+}
+
+// pickRuleLook returns the look with the most keyword hits, the default (and false) without any
+func pickRuleLook(words []string) (ruleLook, bool) {
+	best, bestHits := defaultRuleLook, 0
+	for _, look := range ruleLooks {
+		if hits := keywordHits(words, look.keywords); hits > bestHits {
+			best, bestHits = look, hits
+		}
+	}
+	return best, bestHits > 0
+}
+
+// chronologicalOrder lists the n image indexes by when they were taken when every image is
+// dated, else in upload order
+func chronologicalOrder(images []models.ImageContext, n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if len(images) != n {
+		return order
+	}
+	for _, img := range images {
+		if img.TakenAt == nil {
+			return order
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return images[order[a]].TakenAt.Before(*images[order[b]].TakenAt) })
+	return order
+}
+
+// gradingForImages picks a grading from the images' mean brightness and dominant colors:
+// dark sets get contrast, bright ones a soft look, otherwise warm or cool casts are enhanced
+// and dull colors boosted; fallback when nothing stands out
+func gradingForImages(images []models.ImageContext, fallback string) string {
+	var brightness, warmth, chroma float64
+	colors := 0
+	for _, img := range images {
+		brightness += img.Brightness
+		for _, hex := range img.DominantColors {
+			c, err := ParseHexColor(hex)
+			if err != nil {
+				continue
+			}
+			r, g, b := float64(c.R), float64(c.G), float64(c.B)
+			warmth += r - b
+			chroma += max(r, g, b) - min(r, g, b)
+			colors++
+		}
+	}
+	if len(images) == 0 || colors == 0 {
+		return fallback
+	}
+	brightness /= float64(len(images))
+	warmth /= float64(colors)
+	chroma /= float64(colors)
+	switch {
+	case brightness < 0.3:
+		return "high-contrast"
+	case brightness > 0.75:
+		return "soft"
+	case warmth > 25:
+		return "warm"
+	case warmth < -25:
+		return "cool"
+	case chroma < 30:
+		return "vibrant"
+	}
+	return fallback
+}
+
+// pickRuleMusic returns the genre and mood the prompt asks for, else the look's
+func pickRuleMusic(words []string, look ruleLook) (string, string) {
+	genre, mood, bestHits := look.musicGenre, look.musicMood, 0
+	for _, m := range ruleMusic {
+		if hits := keywordHits(words, m.keywords); hits > bestHits {
+			genre, mood, bestHits = m.genre, m.mood, hits
+		}
+	}
+	return genre, mood
+}
+
+// keywordHits counts the words that start with one of keywords
+func keywordHits(words, keywords []string) int {
+	hits := 0
+	for _, w := range words {
+		for _, k := range keywords {
+			if strings.HasPrefix(w, k) {
+				hits++
+				break
+			}
+		}
+	}
+	return hits
+}
+
+// promptWords returns the lowercased words of text without punctuation
+func promptWords(text string) []string {
+	fields := strings.Fields(strings.ToLower(text))
+	words := fields[:0]
+	for _, f := range fields {
+		if w := wordCore(f); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// promptSentences splits the prompt into sentences that fit a text segment
+func promptSentences(prompt string) []string {
+	var out []string
+	for _, s := range sentenceEndRe.Split(strings.TrimSpace(prompt), -1) {
+		if s = strings.Join(strings.Fields(s), " "); s != "" {
+			out = append(out, truncateWords(s, maxSegmentText))
+		}
+	}
+	return out
+}
+
+// truncateWords shortens s to at most n characters, cutting at a word boundary when there is one
+func truncateWords(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:-")
+}
+
+func evenWeights(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 1
+	}
+	return w
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"sort"
+
+	// register decoders used by image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	models "social-media-ai-video/models"
+)
+
+// Saliency analysis: finds where the "interesting" part of an image is so that
+// fill-crops and Ken Burns moves keep faces/products in frame instead of blindly
+// using the center. Works on a small luminance grid so cost is independent of
+// the upload resolution (apart from decoding).
+
+const (
+	saliencyGridSize   = 96   // long side of the analysis grid in cells
+	saliencyTopPercent = 0.10 // fraction of most salient cells used for the centroid
+	saliencyCenterBias = 0.35 // weight of the center prior (0 disables)
+)
+
+// FaceDetector finds faces in an image. Implementations are optional; a pure-Go
+// cascade (e.g. pigo) can be plugged in without changing the analyzer.
+type FaceDetector interface {
+	DetectFaces(img image.Image) []image.Rectangle
+}
+
+type SaliencyAnalyzer struct {
+	faces FaceDetector
+}
+
+// NewSaliencyAnalyzer creates an analyzer; faces may be nil to use edge/entropy saliency only
+func NewSaliencyAnalyzer(faces FaceDetector) *SaliencyAnalyzer {
+	return &SaliencyAnalyzer{faces: faces}
+}
+
+// Analyze decodes the image at path and returns its dimensions and detected focal point
+func (sa *SaliencyAnalyzer) Analyze(path string) (models.ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return models.ImageInfo{}, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return models.ImageInfo{}, fmt.Errorf("failed to decode image %s: %v", path, err)
+	}
+	b := img.Bounds()
+	return models.ImageInfo{Width: b.Dx(), Height: b.Dy(), FocalPoint: sa.FocalPoint(img)}, nil
+}
+
+// Dimensions reads only the image header; used when the focal point is supplied by the client
+func (sa *SaliencyAnalyzer) Dimensions(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image header %s: %v", path, err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// FocalPoint computes the focal point of an already decoded image.
+// Faces win when a detector is configured and finds any; otherwise the centroid
+// of the top edge-energy * local-entropy cells (with a mild center prior) is used.
+func (sa *SaliencyAnalyzer) FocalPoint(img image.Image) models.FocalPoint {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return models.FocalPoint{X: 0.5, Y: 0.5}
+	}
+
+	if sa.faces != nil {
+		if fp, ok := facesFocalPoint(sa.faces.DetectFaces(img), b); ok {
+			return fp
+		}
+	}
+
+	gw, gh := gridDims(b.Dx(), b.Dy())
+	lum := luminanceGrid(img, gw, gh)
+	edges := sobelMagnitude(lum, gw, gh)
+	entropy := localEntropy(lum, gw, gh, 2)
+
+	scores := make([]float64, gw*gh)
+	maxScore := 0.0
+	for y := 0; y < gh; y++ {
+		for x := 0; x < gw; x++ {
+			i := y*gw + x
+			dx := (float64(x)+0.5)/float64(gw) - 0.5
+			dy := (float64(y)+0.5)/float64(gh) - 0.5
+			prior := math.Exp(-(dx*dx + dy*dy) / (2 * 0.3 * 0.3))
+			s := edges[i] * (0.5 + 0.5*entropy[i]) * ((1 - saliencyCenterBias) + saliencyCenterBias*prior)
+			scores[i] = s
+			if s > maxScore {
+				maxScore = s
+			}
+		}
+	}
+	// flat images (solid colors, heavy blur) have no meaningful saliency
+	if maxScore < 1e-3 {
+		return models.FocalPoint{X: 0.5, Y: 0.5}
+	}
+
+	sorted := make([]float64, len(scores))
+	copy(sorted, scores)
+	sort.Float64s(sorted)
+	threshold := sorted[int(float64(len(sorted)-1)*(1-saliencyTopPercent))]
+
+	var sx, sy, sw float64
+	for y := 0; y < gh; y++ {
+		for x := 0; x < gw; x++ {
+			s := scores[y*gw+x]
+			if s < threshold {
+				continue
+			}
+			sx += s * (float64(x) + 0.5)
+			sy += s * (float64(y) + 0.5)
+			sw += s
+		}
+	}
+	if sw == 0 {
+		return models.FocalPoint{X: 0.5, Y: 0.5}
+	}
+	return models.FocalPoint{X: clamp01(sx / sw / float64(gw)), Y: clamp01(sy / sw / float64(gh))}
+}
+
+// facesFocalPoint weights face centers by area so the dominant face leads
+func facesFocalPoint(faces []image.Rectangle, b image.Rectangle) (models.FocalPoint, bool) {
+	var sx, sy, sw float64
+	for _, r := range faces {
+		r = r.Intersect(b)
+		area := float64(r.Dx() * r.Dy())
+		if area <= 0 {
+			continue
+		}
+		sx += area * float64(r.Min.X+r.Max.X-2*b.Min.X) / 2
+		sy += area * float64(r.Min.Y+r.Max.Y-2*b.Min.Y) / 2
+		sw += area
+	}
+	if sw == 0 {
+		return models.FocalPoint{}, false
+	}
+	return models.FocalPoint{X: clamp01(sx / sw / float64(b.Dx())), Y: clamp01(sy / sw / float64(b.Dy()))}, true
+}
+
+func gridDims(w, h int) (int, int) {
+	if w >= h {
+		return saliencyGridSize, maxInt(int(math.Round(float64(saliencyGridSize)*float64(h)/float64(w))), 8)
+	}
+	return maxInt(int(math.Round(float64(saliencyGridSize)*float64(w)/float64(h))), 8), saliencyGridSize
+}
+
+// luminanceGrid box-averages luma (0..1) into a gw x gh grid, subsampling large cells
+func luminanceGrid(img image.Image, gw, gh int) []float64 {
+	b := img.Bounds()
+	out := make([]float64, gw*gh)
+	for gy := 0; gy < gh; gy++ {
+		y0 := b.Min.Y + gy*b.Dy()/gh
+		y1 := b.Min.Y + (gy+1)*b.Dy()/gh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for gx := 0; gx < gw; gx++ {
+			x0 := b.Min.X + gx*b.Dx()/gw
+			x1 := b.Min.X + (gx+1)*b.Dx()/gw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			stepX := maxInt((x1-x0)/4, 1)
+			stepY := maxInt((y1-y0)/4, 1)
+			var sum float64
+			var n int
+			for y := y0; y < y1; y += stepY {
+				for x := x0; x < x1; x += stepX {
+					r, g, bl, _ := img.At(x, y).RGBA()
+					sum += (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 65535
+					n++
+				}
+			}
+			out[gy*gw+gx] = sum / float64(n)
+		}
+	}
+	return out
+}
+
+// sobelMagnitude returns gradient magnitude normalized to 0..1
+func sobelMagnitude(lum []float64, w, h int) []float64 {
+	at := func(x, y int) float64 {
+		if x < 0 {
+			x = 0
+		} else if x >= w {
+			x = w - 1
+		}
+		if y < 0 {
+			y = 0
+		} else if y >= h {
+			y = h - 1
+		}
+		return lum[y*w+x]
+	}
+	out := make([]float64, w*h)
+	maxMag := 0.0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := -at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1) + at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1)
+			gy := -at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1) + at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1)
+			m := math.Sqrt(gx*gx + gy*gy)
+			out[y*w+x] = m
+			if m > maxMag {
+				maxMag = m
+			}
+		}
+	}
+	if maxMag < 0.02 {
+		// keep absolute scale for near-flat images so the caller can detect them
+		return out
+	}
+	for i := range out {
+		out[i] /= maxMag
+	}
+	return out
+}
+
+// localEntropy computes Shannon entropy of a 16-bin luma histogram in a (2r+1)^2 window, normalized to 0..1
+func localEntropy(lum []float64, w, h, r int) []float64 {
+	const bins = 16
+	out := make([]float64, w*h)
+	var hist [bins]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			hist = [bins]int{}
+			n := 0
+			for yy := y - r; yy <= y+r; yy++ {
+				if yy < 0 || yy >= h {
+					continue
+				}
+				for xx := x - r; xx <= x+r; xx++ {
+					if xx < 0 || xx >= w {
+						continue
+					}
+					bin := int(lum[yy*w+xx] * bins)
+					if bin >= bins {
+						bin = bins - 1
+					}
+					hist[bin]++
+					n++
+				}
+			}
+			var e float64
+			for _, c := range hist {
+				if c == 0 {
+					continue
+				}
+				p := float64(c) / float64(n)
+				e -= p * math.Log2(p)
+			}
+			out[y*w+x] = e / math.Log2(bins)
+		}
+	}
+	return out
+}
@@ -0,0 +1,568 @@
+package services
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// RenderScheduler runs render tasks on a fixed number of workers. Waiting tasks sit in a
+// bounded priority queue (higher priority first, FIFO within a priority); when it is full
+// Submit fails with ErrQueueFull so callers can push back on clients instead of piling up
+// ffmpeg processes. Every state change is written to the JobStore when one is configured.
+//
+// A job whose composition comes later (from an async generator) is held instead: it exists and
+// can be polled or canceled, but only enters the queue once Release hands it the composition.
+// Held jobs fail with ErrGenerationTimeout when nothing arrives in time.
+
+var (
+	ErrQueueFull         = errors.New("render queue is full")
+	ErrSchedulerClosed   = errors.New("render scheduler is shutting down")
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobFinished       = errors.New("job already finished")
+	ErrJobCanceled       = errors.New("job canceled")
+	ErrNotGenerating     = errors.New("job is not waiting for a composition")
+	ErrGenerationTimeout = errors.New("composition was not delivered in time")
+)
+
+const (
+	// finished jobs stay in memory this long; older ones are served from the store
+	finishedJobRetention = time.Hour
+	// assumed render duration until the first job finishes
+	defaultRenderEstimate = 30 * time.Second
+)
+
+// RenderExecutor runs one task; RenderPipeline.Execute in production. It must stop when ctx is done.
+type RenderExecutor func(ctx context.Context, id string, task RenderTask) (*models.RenderResult, error)
+
+// RenderDiscarder removes the outputs of a render whose job was canceled while it finished
+// successfully; RenderPipeline.Discard in production
+type RenderDiscarder func(id string, result *models.RenderResult)
+
+type scheduledJob struct {
+	job      models.RenderJob
+	task     RenderTask
+	attempts int
+	seq      uint64
+	index    int // position in the heap, -1 once dequeued
+	cancel   context.CancelFunc
+	// expires fails a held job when its composition does not arrive
+	expires  *time.Timer
+	canceled bool
+	err      error
+	done     chan struct{}
+}
+
+type RenderScheduler struct {
+	execute    RenderExecutor
+	discard    RenderDiscarder
+	store      *JobStore
+	maxQueue   int
+	workers    int
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      jobQueue
+	jobs       map[string]*scheduledJob
+	seq        uint64
+	closed     bool
+	avgRuntime time.Duration
+	// holdTimeout bounds how long a job waits for its composition
+	holdTimeout time.Duration
+	wg          sync.WaitGroup
+}
+
+// NewRenderScheduler starts cfg.RenderConcurrency workers; store and discard may be nil
+func NewRenderScheduler(cfg *config.APIConfig, store *JobStore, execute RenderExecutor, discard RenderDiscarder) *RenderScheduler {
+	s := &RenderScheduler{
+		execute:     execute,
+		discard:     discard,
+		store:       store,
+		maxQueue:    cfg.RenderQueueSize,
+		workers:     cfg.RenderConcurrency,
+		jobs:        map[string]*scheduledJob{},
+		avgRuntime:  defaultRenderEstimate,
+		holdTimeout: cfg.N8NCallbackTimeout,
+	}
+	if s.workers < 1 {
+		s.workers = 1
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	return s
+}
+
+// Submit queues a task and returns the job snapshot (with its queue position).
+// userID files the job under that user's history; it may be empty.
+func (s *RenderScheduler) Submit(task RenderTask, priority models.JobPriority, userID string) (models.RenderJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return models.RenderJob{}, ErrSchedulerClosed
+	}
+	if s.maxQueue > 0 && s.queue.Len() >= s.maxQueue {
+		return models.RenderJob{}, ErrQueueFull
+	}
+	s.pruneLocked()
+
+	task.UserID = userID
+	s.seq++
+	sj := &scheduledJob{
+		job: models.RenderJob{
+			ID:        NewID(),
+			UserID:    userID,
+			Status:    models.JobQueued,
+			Priority:  priority,
+			CreatedAt: time.Now(),
+		},
+		task: task,
+		seq:  s.seq,
+		done: make(chan struct{}),
+	}
+	heap.Push(&s.queue, sj)
+	s.jobs[sj.job.ID] = sj
+	s.persistLocked(sj)
+	s.cond.Signal()
+	return s.snapshotLocked(sj), nil
+}
+
+// Hold registers a job that waits for its composition; Release queues it. The task must be
+// kept and detached, since no request waits on it.
+func (s *RenderScheduler) Hold(task RenderTask, priority models.JobPriority, userID string) (models.RenderJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return models.RenderJob{}, ErrSchedulerClosed
+	}
+	if s.maxQueue > 0 && s.queue.Len() >= s.maxQueue {
+		return models.RenderJob{}, ErrQueueFull
+	}
+	s.pruneLocked()
+
+	task.UserID = userID
+	sj := &scheduledJob{
+		job: models.RenderJob{
+			ID:        NewID(),
+			UserID:    userID,
+			Status:    models.JobGenerating,
+			Priority:  priority,
+			CreatedAt: time.Now(),
+		},
+		task:  task,
+		index: -1,
+		done:  make(chan struct{}),
+	}
+	s.jobs[sj.job.ID] = sj
+	s.expireLocked(sj)
+	s.persistLocked(sj)
+	return s.snapshotLocked(sj), nil
+}
+
+// Release hands a held job its composition and queues it. It is queued even when the queue is
+// full, having been accepted already; while shutting down it is stored queued for the next start.
+func (s *RenderScheduler) Release(id string, composition []byte) (models.RenderJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sj, ok := s.jobs[id]
+	if !ok {
+		return models.RenderJob{}, ErrJobNotFound
+	}
+	if sj.job.Status != models.JobGenerating {
+		return s.snapshotLocked(sj), ErrNotGenerating
+	}
+	sj.expires.Stop()
+	sj.task.Composition = composition
+	sj.job.Status = models.JobQueued
+	s.persistLocked(sj)
+	if s.closed {
+		return s.snapshotLocked(sj), nil
+	}
+	s.seq++
+	sj.seq = s.seq
+	heap.Push(&s.queue, sj)
+	s.cond.Signal()
+	return s.snapshotLocked(sj), nil
+}
+
+// FailGeneration fails a held job, e.g. when the generator reports an error
+func (s *RenderScheduler) FailGeneration(id string, err error) (models.RenderJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sj, ok := s.jobs[id]
+	if !ok {
+		return models.RenderJob{}, ErrJobNotFound
+	}
+	if sj.job.Status != models.JobGenerating {
+		return s.snapshotLocked(sj), ErrNotGenerating
+	}
+	sj.expires.Stop()
+	s.finishLocked(sj, nil, err)
+	return s.snapshotLocked(sj), nil
+}
+
+// expireLocked arms the timeout of a held job, counted from its creation
+func (s *RenderScheduler) expireLocked(sj *scheduledJob) {
+	id := sj.job.ID
+	sj.expires = time.AfterFunc(time.Until(sj.job.CreatedAt.Add(s.holdTimeout)), func() {
+		s.FailGeneration(id, ErrGenerationTimeout)
+	})
+}
+
+// Get returns the current state of a job, falling back to the store for older jobs
+func (s *RenderScheduler) Get(id string) (models.RenderJob, error) {
+	s.mu.Lock()
+	if sj, ok := s.jobs[id]; ok {
+		defer s.mu.Unlock()
+		return s.snapshotLocked(sj), nil
+	}
+	s.mu.Unlock()
+	if s.store == nil {
+		return models.RenderJob{}, ErrJobNotFound
+	}
+	rec, err := s.store.Get(id)
+	return rec.Job, err
+}
+
+// Task returns a job along with the task it was submitted with, e.g. to derive new renders from it
+func (s *RenderScheduler) Task(id string) (models.RenderJob, RenderTask, error) {
+	s.mu.Lock()
+	if sj, ok := s.jobs[id]; ok {
+		defer s.mu.Unlock()
+		return s.snapshotLocked(sj), sj.task, nil
+	}
+	s.mu.Unlock()
+	if s.store == nil {
+		return models.RenderJob{}, RenderTask{}, ErrJobNotFound
+	}
+	rec, err := s.store.Get(id)
+	return rec.Job, rec.Task, err
+}
+
+// History lists a user's jobs, newest first
+func (s *RenderScheduler) History(userID string, status models.JobStatus, limit int) ([]models.RenderJob, error) {
+	if s.store == nil {
+		return nil, nil
+	}
+	jobs, err := s.store.ListByUser(userID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	// live jobs carry a queue position the store does not track
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range jobs {
+		if sj, ok := s.jobs[job.ID]; ok {
+			jobs[i] = s.snapshotLocked(sj)
+		}
+	}
+	return jobs, nil
+}
+
+// Wait blocks until the job finishes and returns its final state and execution error.
+// If ctx ends first (e.g. the client disconnected) the job is canceled and Wait returns
+// once it has stopped and cleaned up.
+func (s *RenderScheduler) Wait(ctx context.Context, id string) (models.RenderJob, error) {
+	s.mu.Lock()
+	sj, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		return models.RenderJob{}, ErrJobNotFound
+	}
+	select {
+	case <-sj.done:
+	case <-ctx.Done():
+		s.Cancel(id)
+		<-sj.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked(sj), sj.err
+}
+
+// Cancel stops a job: queued jobs are dropped, running jobs have their context canceled
+// (which kills ffmpeg) and finish as canceled once the executor returns.
+func (s *RenderScheduler) Cancel(id string) (models.RenderJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sj, ok := s.jobs[id]
+	if !ok {
+		return models.RenderJob{}, ErrJobNotFound
+	}
+	if sj.job.Status.Finished() {
+		return s.snapshotLocked(sj), ErrJobFinished
+	}
+	sj.canceled = true
+	switch {
+	case sj.job.Status == models.JobGenerating:
+		sj.expires.Stop()
+		s.finishLocked(sj, nil, ErrJobCanceled)
+	case sj.job.Status == models.JobQueued:
+		if sj.index >= 0 {
+			heap.Remove(&s.queue, sj.index)
+		}
+		s.finishLocked(sj, nil, ErrJobCanceled)
+	case sj.cancel != nil:
+		sj.cancel()
+	}
+	return s.snapshotLocked(sj), nil
+}
+
+// RetryAfter estimates how long until a queue slot frees up
+func (s *RenderScheduler) RetryAfter() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// with every worker busy, some render finishes (and frees a slot) every avgRuntime/workers
+	d := s.avgRuntime / time.Duration(s.workers)
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// Shutdown stops accepting jobs and lets running renders finish until ctx is done, after which
+// they are canceled. Queued detached jobs, and resumable jobs interrupted by the deadline, stay
+// queued in the store for the next start; queued jobs a request is waiting on fail with
+// ErrSchedulerClosed. Returns the number of jobs left for resumption.
+func (s *RenderScheduler) Shutdown(ctx context.Context) int {
+	s.mu.Lock()
+	s.closed = true
+	for s.queue.Len() > 0 {
+		sj := heap.Pop(&s.queue).(*scheduledJob)
+		if sj.task.Detached && s.store != nil {
+			continue
+		}
+		s.finishLocked(sj, nil, ErrSchedulerClosed)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for _, sj := range s.jobs {
+			if sj.job.Status == models.JobRunning && sj.cancel != nil {
+				sj.cancel()
+			}
+		}
+		s.mu.Unlock()
+		<-drained
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	left := 0
+	for _, sj := range s.jobs {
+		if sj.job.Status == models.JobQueued || sj.job.Status == models.JobGenerating {
+			left++
+		}
+	}
+	return left
+}
+
+// Restore re-queues jobs recovered from the store, keeping their IDs so clients can keep polling;
+// held jobs are held again for what is left of their timeout
+func (s *RenderScheduler) Restore(records []JobRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range records {
+		if rec.Job.Status == models.JobGenerating {
+			sj := &scheduledJob{job: rec.Job, task: rec.Task, index: -1, done: make(chan struct{})}
+			s.jobs[rec.Job.ID] = sj
+			s.expireLocked(sj)
+			continue
+		}
+		s.seq++
+		job := rec.Job
+		job.Status = models.JobQueued
+		job.QueuePosition = 0
+		sj := &scheduledJob{job: job, task: rec.Task, attempts: rec.Attempts, seq: s.seq, done: make(chan struct{})}
+		heap.Push(&s.queue, sj)
+		s.jobs[job.ID] = sj
+		s.persistLocked(sj)
+	}
+	s.cond.Broadcast()
+}
+
+// ActiveWorkspaces returns the workspace dirs of jobs that have not finished yet
+func (s *RenderScheduler) ActiveWorkspaces() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirs := map[string]bool{}
+	for _, sj := range s.jobs {
+		if !sj.job.Status.Finished() {
+			dirs[filepath.Clean(sj.task.WorkspaceDir)] = true
+		}
+	}
+	return dirs
+}
+
+// Forget drops a finished job from memory so reads go to the store, e.g. after the janitor changed it there
+func (s *RenderScheduler) Forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sj, ok := s.jobs[id]; ok && sj.job.Status.Finished() && s.store != nil {
+		delete(s.jobs, id)
+	}
+}
+
+func (s *RenderScheduler) worker() {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		for s.queue.Len() == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.queue.Len() == 0 {
+			s.mu.Unlock()
+			return
+		}
+		sj := heap.Pop(&s.queue).(*scheduledJob)
+		started := time.Now()
+		ctx, cancel := context.WithCancel(context.Background())
+		sj.job.Status = models.JobRunning
+		sj.job.StartedAt = &started
+		sj.attempts++
+		sj.cancel = cancel
+		s.persistLocked(sj)
+		s.mu.Unlock()
+
+		result, err := s.execute(ctx, sj.job.ID, sj.task)
+		cancel()
+
+		s.mu.Lock()
+		// a cancel that lost the race to a successful render leaves outputs nobody will collect
+		orphaned := sj.canceled && err == nil && result != nil
+		switch {
+		case sj.canceled:
+			s.finishLocked(sj, nil, ErrJobCanceled)
+		case err != nil && s.closed && sj.task.Keep && s.store != nil:
+			// killed by the shutdown deadline: leave it queued for the next start
+			sj.job.Status = models.JobQueued
+			sj.job.StartedAt = nil
+			sj.err = ErrSchedulerClosed
+			s.persistLocked(sj)
+			close(sj.done)
+		default:
+			s.finishLocked(sj, result, err)
+			// exponential moving average keeps the Retry-After estimate current
+			s.avgRuntime = (s.avgRuntime*4 + sj.job.FinishedAt.Sub(started)) / 5
+		}
+		s.mu.Unlock()
+
+		if orphaned && s.discard != nil {
+			s.discard(sj.job.ID, result)
+		}
+	}
+}
+
+// finishLocked records the outcome of a job, releases a detached job's workspace and wakes its waiters
+func (s *RenderScheduler) finishLocked(sj *scheduledJob, result *models.RenderResult, err error) {
+	finished := time.Now()
+	sj.job.FinishedAt = &finished
+	sj.job.QueuePosition = 0
+	sj.err = err
+	switch {
+	case errors.Is(err, ErrJobCanceled):
+		sj.job.Status = models.JobCanceled
+		sj.job.Error = err.Error()
+	case err != nil:
+		sj.job.Status = models.JobFailed
+		sj.job.Error = err.Error()
+		var ffErr *FFmpegError
+		if errors.As(err, &ffErr) {
+			sj.job.ErrorDetails = ffErr.Output
+		}
+	default:
+		sj.job.Status = models.JobSucceeded
+		sj.job.Result = result
+	}
+	if sj.task.Detached {
+		os.RemoveAll(sj.task.WorkspaceDir)
+	}
+	s.persistLocked(sj)
+	close(sj.done)
+}
+
+// persistLocked writes the job to the store; failures are logged, the in-memory state stays authoritative
+func (s *RenderScheduler) persistLocked(sj *scheduledJob) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Put(JobRecord{Job: sj.job, Task: sj.task, Attempts: sj.attempts}); err != nil {
+		log.Printf("job %s: failed to persist: %v", sj.job.ID, err)
+	}
+}
+
+// snapshotLocked copies the job and fills in its queue position
+func (s *RenderScheduler) snapshotLocked(sj *scheduledJob) models.RenderJob {
+	job := sj.job
+	if job.Status == models.JobQueued && sj.index >= 0 {
+		job.QueuePosition = 1
+		for _, other := range s.queue {
+			if other != sj && other.before(sj) {
+				job.QueuePosition++
+			}
+		}
+	}
+	return job
+}
+
+// pruneLocked drops jobs that finished longer than finishedJobRetention ago from memory
+func (s *RenderScheduler) pruneLocked() {
+	cutoff := time.Now().Add(-finishedJobRetention)
+	for id, sj := range s.jobs {
+		if sj.job.FinishedAt != nil && sj.job.FinishedAt.Before(cutoff) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (sj *scheduledJob) before(other *scheduledJob) bool {
+	if a, b := sj.job.Priority.Rank(), other.job.Priority.Rank(); a != b {
+		return a > b
+	}
+	return sj.seq < other.seq
+}
+
+// jobQueue implements heap.Interface ordered by priority, then submission order
+type jobQueue []*scheduledJob
+
+func (q jobQueue) Len() int           { return len(q) }
+func (q jobQueue) Less(i, j int) bool { return q[i].before(q[j]) }
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x any) {
+	sj := x.(*scheduledJob)
+	sj.index = len(*q)
+	*q = append(*q, sj)
+}
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	n := len(old)
+	sj := old[n-1]
+	old[n-1] = nil
+	sj.index = -1
+	*q = old[:n-1]
+	return sj
+}
@@ -1,13 +1,16 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	models "social-media-ai-video/models"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,6 +33,8 @@ type AudioConfig struct {
 	MusicPath         MusicFiles
 	MusicVolume       float64 // 0..1
 	NarrationVolume   float64 // 0..1, if 0 treat as 1.0
+	// NarrationFit stretches and pads/trims the narration to the video length
+	NarrationFit narrationFit
 }
 
 type ttsNarartionFiles struct {
@@ -57,12 +62,28 @@ type CommandBuildInput struct {
 	Timeline        models.Timeline
 	// Images referenced by index in timeline (ImageIndex)
 	ImagePaths []string
+	// Optional asset IDs, parallel to ImagePaths; an asset render's ImageIndex picks from this list
+	AssetIDs []string
+	// Optional per-image dimensions/focal points, parallel to ImagePaths; used for fill crops and Ken Burns
+	ImageInfos []models.ImageInfo
+	// How images are fitted on the canvas; "zoom" segments always fill
+	CropMode models.CropMode
+	// Optional ASS script burned in place of the drawtext overlays
+	SubtitlesPath string
+	// Color grading from the composition theme (warm, cool, vibrant, muted, high-contrast, soft)
+	Grading string
+	// Optional brand kit: watermark, text colors/fonts, intro title and end card
+	Brand         *models.BrandKit
+	BrandLogoPath string
 	// Audio assets
 	Audio AudioConfig
 	// Output file path (absolute or working-directory relative)
 	OutputPath string
 }
 
+// kenBurnsMaxZoom is the zoom factor reached at the end of a "zoom" segment
+const kenBurnsMaxZoom = 1.15
+
 // FFmpegCommandBuilder converts a high-level composition into a single ffmpeg command
 
 type FFmpegCommandBuilder struct{}
@@ -76,40 +97,76 @@ type CompositionCompiler struct {
 	builder      *FFmpegCommandBuilder
 	bgMusic      *BackgroundMusic
 	voiceService *ElevenLabsService
+	saliency     *SaliencyAnalyzer
+	brandKits    *BrandKitStore
+	// ffprobePath measures narration for fitting
+	ffprobePath string
 }
 
 //Can see the compiler takes the music and voice services; all-in-one stop
 
-func NewCompositionCompiler(builder *FFmpegCommandBuilder, bg *BackgroundMusic, els *ElevenLabsService) *CompositionCompiler {
-	return &CompositionCompiler{builder: builder, bgMusic: bg, voiceService: els}
+func NewCompositionCompiler(builder *FFmpegCommandBuilder, bg *BackgroundMusic, els *ElevenLabsService, sa *SaliencyAnalyzer, bk *BrandKitStore) *CompositionCompiler {
+	return &CompositionCompiler{builder: builder, bgMusic: bg, voiceService: els, saliency: sa, brandKits: bk, ffprobePath: "ffprobe"}
 }
 
 type Compilier interface {
-	Compile(jsonAISchemaBlob []byte, imagePaths []string) ([]string, []string, string, error)
+	Compile(ctx context.Context, jsonAISchemaBlob []byte, imagePaths []string, outputPath string, opts models.RenderOptions) (*CompiledRender, error)
 }
 
-// Compile takes the AI JSON blob and image paths (ordered by index) and returns ffmpeg args and resolved output paths used.
-func (cc *CompositionCompiler) Compile(jsonAISchemaBlob []byte, imagePaths []string) ([]string, []string, string, error) {
-	//schema object
-	var vc models.VideoCompositionResponse
+// CompiledRender is everything needed to run ffmpeg and derive artifacts from its output
+type CompiledRender struct {
+	Args           []string
+	NarrationPaths []string
+	// NarrationFiles are the full paths of the TTS clips, in segment order
+	NarrationFiles []string
+	OutputPath     string
+	Composition    models.VideoCompositionResponse
+	Metadata       Metadata_FFmpeg
+	// Sidecars are files produced at compile time (caption exports) that belong to the render result
+	Sidecars []models.Artifact
+	// TempFiles are compile-time helpers (narration audio, an ASS script only used for burning) the caller should remove
+	TempFiles []string
+	// TTS reports narration cache hits and misses; nil when no narration was generated
+	TTS *models.TTSStats
+}
 
-	// unwrap optional top-level {"output": ...} wrapper if present
-	var outer struct {
-		Output json.RawMessage `json:"output"`
-	}
-	if err := json.Unmarshal(jsonAISchemaBlob, &outer); err == nil && len(outer.Output) > 0 {
-		jsonAISchemaBlob = outer.Output
+func (cr *CompiledRender) sidecar(kind models.ArtifactKind) (models.Artifact, bool) {
+	for _, a := range cr.Sidecars {
+		if a.Kind == kind {
+			return a, true
+		}
 	}
+	return models.Artifact{}, false
+}
 
-	//jsonAISchemaBlob should conform to schema, place in vc
-	if err := json.Unmarshal(jsonAISchemaBlob, &vc); err != nil {
-		return nil, []string{}, "", fmt.Errorf("invalid composition json: %v. Given json: %s", err, string(jsonAISchemaBlob))
+// Compile takes the AI JSON blob and image paths (ordered by index) and returns ffmpeg args and resolved output paths used.
+// An empty outputPath renders to a unique file under the OS temp directory. ctx bounds the TTS calls.
+func (cc *CompositionCompiler) Compile(ctx context.Context, jsonAISchemaBlob []byte, imagePaths []string, outputPath string, opts models.RenderOptions) (*CompiledRender, error) {
+	//schema object
+	parsed, err := ParseComposition(jsonAISchemaBlob)
+	if err != nil {
+		return nil, err
 	}
+	vc := *parsed
 
 	// Map Properties.Metadata.Properties
 	if len(vc.Metadata.Resolution) != 2 {
-		return nil, []string{}, "", fmt.Errorf("invalid resolution resolution array %v", vc.Metadata.Resolution)
+		return nil, fmt.Errorf("invalid resolution resolution array %v", vc.Metadata.Resolution)
+	}
+	// Resolve the brand kit up front so a bad ID fails before any TTS spend
+	var brand *models.BrandKit
+	brandLogo := ""
+	if opts.BrandKitID != "" {
+		if cc.brandKits == nil {
+			return nil, fmt.Errorf("brand kits are not configured")
+		}
+		kit, err := cc.brandKits.load(opts.BrandKitID)
+		if err != nil {
+			return nil, fmt.Errorf("brand kit %s: %v", opts.BrandKitID, err)
+		}
+		brand, brandLogo = kit, cc.brandKits.LogoPath(kit)
 	}
+
 	fps := 30
 	if vc.Metadata.Fps != "" {
 		if parsed, err := strconv.Atoi(vc.Metadata.Fps); err == nil {
@@ -124,30 +181,55 @@ func (cc *CompositionCompiler) Compile(jsonAISchemaBlob []byte, imagePaths []str
 		Height:        vc.Metadata.Resolution[1],
 	}
 
-	// Resolve narration via ElevenLabs
+	// Resolve narration via ElevenLabs. Narration keeps the pause/emphasis markup; the screen does not.
 	ttsInput := models.TTSInput{
-		TextInput:     vc.Timeline.TextTimeline.TextSegments,
+		TextInput:     append([]models.TextSegment(nil), vc.Timeline.TextTimeline.TextSegments...),
 		VoiceSettings: vc.Audio.Narration.Voice,
+		Lexicon:       opts.Lexicon,
+		VoiceID:       opts.VoiceID,
+	}
+	for i, seg := range vc.Timeline.TextTimeline.TextSegments {
+		vc.Timeline.TextTimeline.TextSegments[i].Text = StripSpeechMarkup(seg.Text)
 	}
 
-	ttsNarrationPathsMap := map[string]string{}
-	ttsNarrationPaths := []string{}
+	narration := narrationTrack{paths: map[string]string{}}
+	var ttsStats *models.TTSStats
+	var fit narrationFit
 
 	//Generate tts narration elevenlabs
 	if cc.voiceService != nil {
 		// Ensure a tmp dir for TTS
-		ttsDir := filepath.Join(os.TempDir(), "tts_audio")
+		ttsDir := ttsTempDir()
 		if err := os.MkdirAll(ttsDir, 0o755); err != nil {
-			return nil, nil, "", fmt.Errorf("failed to create tts tmp dir: %v", err)
+			return nil, fmt.Errorf("failed to create tts tmp dir: %v", err)
 		}
-		filenames, fileoutputmap, err := cc.voiceService.GenerateSpeechToTmp(ttsInput, ttsDir)
+		var err error
+		narration, err = cc.synthesize(ctx, ttsInput, opts.NeedsCaptions(), ttsDir)
 		if err != nil {
-			return nil, nil, "", fmt.Errorf("tts generation failed: %v", err)
+			return nil, fmt.Errorf("tts generation failed: %w", err)
 		}
+		if err := ctx.Err(); err != nil {
+			removeFiles(narration.files())
+			return nil, err
+		}
+		// Bring narration and timeline to the same length; may reflow the timeline or regenerate
+		fit, err = cc.fitNarration(ctx, &vc, ttsInput, opts, brand, &narration, ttsDir)
+		if err != nil {
+			removeFiles(narration.files())
+			return nil, fmt.Errorf("narration fit failed: %w", err)
+		}
+		meta.TotalDuration = vc.Metadata.TotalDuration
+		ttsStats = &narration.stats
+	}
 
-		ttsNarrationPathsMap = fileoutputmap
-		ttsNarrationPaths = filenames
-
+	// Narration audio only lives as long as this render
+	narrationFiles := narration.files()
+	fail := func(err error) (*CompiledRender, error) {
+		removeFiles(narrationFiles)
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
 	}
 
 	// Resolve music if enabled
@@ -157,32 +239,192 @@ func (cc *CompositionCompiler) Compile(jsonAISchemaBlob []byte, imagePaths []str
 	if vc.Audio.Music.Enabled && cc.bgMusic != nil {
 		mf, err := cc.bgMusic.CreateBackgroundMusic(vc.Audio.Music.Mood, vc.Audio.Music.Genre)
 		if err != nil {
-			return nil, nil, "", fmt.Errorf("bgm download failed: %v", err)
+			return fail(fmt.Errorf("bgm download failed: %v", err))
 		}
 		musicPath = mf.FilePath
 		musicName = mf.FileName
 	}
 
+	// Focal points are only needed when some segment crops instead of letterboxing
+	imageInfos, err := cc.resolveImageInfos(vc.Timeline, imagePaths, opts)
+	if err != nil {
+		return fail(err)
+	}
+
 	// Auto-generate an output path under the OS temp directory
-	autoOutput := filepath.Join(os.TempDir(), fmt.Sprintf("short_%d.mp4", time.Now().UnixNano()))
+	if outputPath == "" {
+		outputPath = filepath.Join(os.TempDir(), fmt.Sprintf("short_%d.mp4", time.Now().UnixNano()))
+	}
+
+	sidecars, subtitlesPath, tempFiles, err := writeCaptions(vc, meta, narration.words, brand, outputPath, opts)
+	if err != nil {
+		return fail(err)
+	}
 
 	args, err := cc.builder.Build(CommandBuildInput{
 		Metadata_FFmpeg: meta,
 		Timeline:        vc.Timeline,
+		Grading:         vc.Theme.Grading,
 		ImagePaths:      imagePaths,
+		AssetIDs:        opts.AssetIDs,
+		ImageInfos:      imageInfos,
+		CropMode:        opts.CropMode,
+		SubtitlesPath:   subtitlesPath,
+		Brand:           brand,
+		BrandLogoPath:   brandLogo,
 		Audio: AudioConfig{
-			ttsNarrationPaths: ttsNarartionFiles{FilePath: ttsNarrationPathsMap, FileName: ttsNarrationPaths},
+			ttsNarrationPaths: ttsNarartionFiles{FilePath: narration.paths, FileName: narration.names},
+			NarrationFit:      fit,
 			MusicEnabled:      vc.Audio.Music.Enabled,
 			MusicPath:         MusicFiles{MusicPath: musicPath, MusicName: musicName},
 			MusicVolume:       vc.Audio.Music.Volume,
 			NarrationVolume:   1.0,
 		},
-		OutputPath: autoOutput,
+		OutputPath: outputPath,
 	})
 	if err != nil {
-		return nil, []string{}, "", err
+		removeFiles(tempFiles)
+		return fail(err)
+	}
+	return &CompiledRender{
+		Args:           args,
+		NarrationPaths: narration.names,
+		NarrationFiles: narrationFiles,
+		OutputPath:     outputPath,
+		Composition:    vc,
+		Metadata:       meta,
+		Sidecars:       sidecars,
+		TempFiles:      append(tempFiles, narrationFiles...),
+		TTS:            ttsStats,
+	}, nil
+}
+
+// writeCaptions exports caption files next to outputPath for every requested subtitle artifact and,
+// when burning, returns the ASS script path for the builder. An ASS file written only for burning is
+// reported as a temp file.
+func writeCaptions(vc models.VideoCompositionResponse, meta Metadata_FFmpeg, words []models.WordTiming, brand *models.BrandKit, outputPath string, opts models.RenderOptions) ([]models.Artifact, string, []string, error) {
+	if !opts.NeedsCaptions() {
+		return nil, "", nil, nil
+	}
+	cues := BuildCaptionCues(vc.Timeline.TextTimeline, words)
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+
+	var sidecars []models.Artifact
+	var tempFiles []string
+	fail := func(err error) ([]models.Artifact, string, []string, error) {
+		removeFiles(tempFiles)
+		for _, a := range sidecars {
+			os.Remove(a.Path)
+		}
+		return nil, "", nil, fmt.Errorf("caption export failed: %v", err)
+	}
+
+	if opts.Wants(models.ArtifactSubtitlesSRT) {
+		if err := WriteSRT(cues, base+".srt"); err != nil {
+			return fail(err)
+		}
+		sidecars = append(sidecars, models.Artifact{Kind: models.ArtifactSubtitlesSRT, Path: base + ".srt", ContentType: "application/x-subrip"})
+	}
+	if opts.Wants(models.ArtifactSubtitlesVTT) {
+		if err := WriteVTT(cues, base+".vtt"); err != nil {
+			return fail(err)
+		}
+		sidecars = append(sidecars, models.Artifact{Kind: models.ArtifactSubtitlesVTT, Path: base + ".vtt", ContentType: "text/vtt"})
 	}
-	return args, ttsNarrationPaths, autoOutput, nil
+
+	subtitlesPath := ""
+	if opts.BurnCaptions || opts.Wants(models.ArtifactSubtitlesASS) {
+		style := ASSStyle{
+			FontFamily: vc.Timeline.TextTimeline.TextStyle.FontFamily,
+			Bold:       vc.Timeline.TextTimeline.TextStyle.TextStyle == "bold",
+		}
+		if brand != nil {
+			if brand.Fonts.Body != "" {
+				style.FontFamily = brand.Fonts.Body
+			}
+			style.TextColor, style.OutlineColor = brand.PrimaryColor, brand.SecondaryColor
+		}
+		if err := WriteASS(cues, style, meta.Width, meta.Height, base+".ass"); err != nil {
+			return fail(err)
+		}
+		if opts.Wants(models.ArtifactSubtitlesASS) {
+			sidecars = append(sidecars, models.Artifact{Kind: models.ArtifactSubtitlesASS, Path: base + ".ass", ContentType: "text/x-ssa"})
+		} else {
+			tempFiles = append(tempFiles, base+".ass")
+		}
+		if opts.BurnCaptions {
+			subtitlesPath = base + ".ass"
+		}
+	}
+
+	for i := range sidecars {
+		if fi, err := os.Stat(sidecars[i].Path); err == nil {
+			sidecars[i].Size = fi.Size()
+		}
+	}
+	return sidecars, subtitlesPath, tempFiles, nil
+}
+
+func removeFiles(paths []string) {
+	for _, p := range paths {
+		os.Remove(p)
+	}
+}
+
+// ParseComposition decodes an AI composition blob, unwrapping the optional top-level {"output": ...}
+// wrapper that n8n agents add.
+func ParseComposition(jsonAISchemaBlob []byte) (*models.VideoCompositionResponse, error) {
+	var vc models.VideoCompositionResponse
+	jsonAISchemaBlob = unwrapComposition(jsonAISchemaBlob)
+
+	//jsonAISchemaBlob should conform to schema, place in vc
+	if err := json.Unmarshal(jsonAISchemaBlob, &vc); err != nil {
+		return nil, fmt.Errorf("invalid composition json: %v. Given json: %s", err, string(jsonAISchemaBlob))
+	}
+	return &vc, nil
+}
+
+// unwrapComposition strips the optional top-level {"output": ...} wrapper
+func unwrapComposition(blob []byte) []byte {
+	var outer struct {
+		Output json.RawMessage `json:"output"`
+	}
+	if err := json.Unmarshal(blob, &outer); err == nil && len(outer.Output) > 0 {
+		return outer.Output
+	}
+	return blob
+}
+
+// resolveImageInfos returns dimensions and focal points for each image, preferring client overrides.
+// Returns nil when no segment needs them (fit mode without zoom segments).
+func (cc *CompositionCompiler) resolveImageInfos(tl models.Timeline, imagePaths []string, opts models.RenderOptions) ([]models.ImageInfo, error) {
+	needed := opts.CropMode == models.CropModeFill
+	for _, seg := range tl.ImageTimeline.ImageSegments {
+		if seg.Transition.Effect == "zoom" {
+			needed = true
+		}
+	}
+	if !needed || cc.saliency == nil {
+		return nil, nil
+	}
+
+	infos := make([]models.ImageInfo, len(imagePaths))
+	for i, p := range imagePaths {
+		if i < len(opts.FocalPoints) && opts.FocalPoints[i] != nil {
+			w, h, err := cc.saliency.Dimensions(p)
+			if err != nil {
+				return nil, err
+			}
+			infos[i] = models.ImageInfo{Width: w, Height: h, FocalPoint: *opts.FocalPoints[i]}
+			continue
+		}
+		info, err := cc.saliency.Analyze(p)
+		if err != nil {
+			return nil, fmt.Errorf("focal point detection failed: %v", err)
+		}
+		infos[i] = info
+	}
+	return infos, nil
 }
 
 func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
@@ -200,7 +442,10 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 		}
 	}
 
-	// Validate image indices
+	// Validate image indices; for asset renders they index the referenced assets
+	if len(in.AssetIDs) > 0 && len(in.AssetIDs) != len(in.ImagePaths) {
+		return nil, fmt.Errorf("%d asset IDs for %d images", len(in.AssetIDs), len(in.ImagePaths))
+	}
 	for _, t := range in.Timeline.ImageTimeline.ImageSegments {
 		if t.ImageIndex < 0 || t.ImageIndex >= len(in.ImagePaths) {
 			return nil, fmt.Errorf("image item %d references invalid image index", t.ImageIndex)
@@ -215,16 +460,21 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 
 	// Input list: images + audio(s)
 	args := []string{"-y"}
+	// inputCount is the index the next "-i" input gets; streams are referenced by these indices
+	inputCount := 0
+	addInput := func(path string) int {
+		args = append(args, "-i", path)
+		inputCount++
+		return inputCount - 1
+	}
 
-	// Image inputs (each once); we will reference by indices
+	// Image inputs (each once); input index == image index
 	for _, p := range in.ImagePaths {
 		// Images as looping inputs turned into video in filters using loop filter
-		args = append(args, "-i", p)
+		addInput(p)
 	}
 
-	// Audio inputs appended at the end so index math is predictable
-	numImageInputs := len(in.ImagePaths)
-	audioInputStart := numImageInputs
+	// Audio inputs appended after the images
 	var narrationPath []string
 	// Validate narration and music file paths before adding as inputs
 	for i := 0; i < len(in.Audio.ttsNarrationPaths.FileName); i++ {
@@ -242,37 +492,41 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 			return nil, fmt.Errorf("missing music file: %s: %v", in.Audio.MusicPath.MusicPath, err)
 		}
 	}
+	// narration clips are consecutive inputs starting at narrIdx
+	narrIdx := -1
 	for i := 0; i < len(in.Audio.ttsNarrationPaths.FileName); i++ {
 		narrationPath = append(narrationPath, in.Audio.ttsNarrationPaths.FilePath[in.Audio.ttsNarrationPaths.FileName[i]])
-		args = append(args, "-i", narrationPath[i])
+		if idx := addInput(narrationPath[i]); i == 0 {
+			narrIdx = idx
+		}
 	}
 	musicIdx := -1
-	narrIdx := -1
-	if len(narrationPath) > 0 {
-		narrIdx = audioInputStart
-		if in.Audio.MusicEnabled && in.Audio.MusicPath.MusicPath != "" {
-			// append music input after narration inputs
-			args = append(args, "-i", in.Audio.MusicPath.MusicPath)
-			musicIdx = audioInputStart + len(narrationPath)
-		}
-	} else if in.Audio.MusicEnabled && in.Audio.MusicPath.MusicPath != "" {
-		// Only music
-		args = append(args, "-i", in.Audio.MusicPath.MusicPath)
-		musicIdx = audioInputStart
-	}
-	if in.Audio.MusicEnabled && in.Audio.MusicPath.MusicPath != "" && musicIdx == -1 {
-		// Music not yet added (narration present handled earlier). Add now.
-		args = append(args, "-i", in.Audio.MusicPath.MusicPath)
-		if narrIdx >= 0 {
-			musicIdx = narrIdx + len(narrationPath)
-		} else {
-			musicIdx = audioInputStart
+	if in.Audio.MusicEnabled && in.Audio.MusicPath.MusicPath != "" {
+		// append music input after narration inputs
+		musicIdx = addInput(in.Audio.MusicPath.MusicPath)
+	}
+
+	logoIdx := -1
+	if in.Brand != nil && in.BrandLogoPath != "" {
+		if _, err := os.Stat(in.BrandLogoPath); err != nil {
+			return nil, fmt.Errorf("missing brand logo: %s: %v", in.BrandLogoPath, err)
 		}
+		logoIdx = addInput(in.BrandLogoPath)
 	}
 
 	// Build filter_complex
 	filter := ""
 
+	// "dissolve" and "slide" segments blend in from the previous one (see joinSegments)
+	blend := make([]float64, len(sorted))
+	blended := false
+	for idx := 1; idx < len(sorted); idx++ {
+		if xfadeTransition(sorted[idx]) != "" {
+			blend[idx] = blendSeconds(sorted[idx])
+			blended = true
+		}
+	}
+
 	// For each image timeline item, construct a stream that lasts its duration
 	// We map image input index -> variable label like [imgN]
 	imageStreamCount := 0
@@ -283,31 +537,48 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 		imgInputIdx := t.ImageIndex
 		labelIn := fmt.Sprintf("[%d:v]", imgInputIdx)
 		labelOut := fmt.Sprintf("[seg%d]", idx)
-		// scale to canvas, pad/crop, set fps, set duration
-		// Use: scale, pad (if needed), fps, tpad=stop_mode=clone:stop_duration=duration, setpts=N/(FPS*TB)
-		// Use loop filter to make image into frames: loop=loop=FPS*duration:size=1:start=0, fps=FPS
-		// Use tpad to clone last frame to desired duration for still images, then normalize PTS
-		filter += fmt.Sprintf("%s scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,format=yuv420p,fps=%d,tpad=stop_mode=clone:stop_duration=%f,setpts=PTS-STARTPTS %s;",
-			labelIn, in.Metadata_FFmpeg.Width, in.Metadata_FFmpeg.Height, in.Metadata_FFmpeg.Width, in.Metadata_FFmpeg.Height, in.Metadata_FFmpeg.FPS, float64(t.Duration), labelOut)
+		chain := segmentFilter(in, t)
+		if blended {
+			// hold the last frame while the next segment blends in, so the timeline keeps its length
+			if idx+1 < len(sorted) && blend[idx+1] > 0 {
+				chain += fmt.Sprintf(",tpad=stop_mode=clone:stop_duration=%.3f", blend[idx+1])
+			}
+			// concat outputs AV_TIME_BASE and xfade needs both inputs on the same time base
+			chain += ",settb=AVTB"
+		}
+		filter += fmt.Sprintf("%s %s %s;", labelIn, chain, labelOut)
 		imageStreamCount++
 	}
+	if imageStreamCount == 0 {
+		return nil, fmt.Errorf("no visual segments present")
+	}
 
-	// Concatenate all video segments in order
-	concatInputs := ""
-	for idx, t := range sorted {
-		if t.ImageIndex >= 0 && t.ImageIndex < len(in.ImagePaths) {
+	if blended {
+		filter += joinSegments(sorted, blend)
+	} else {
+		// Concatenate all video segments in order
+		concatInputs := ""
+		for idx := range sorted {
 			concatInputs += fmt.Sprintf("[seg%d]", idx)
 		}
+		filter += fmt.Sprintf("%s concat=n=%d:v=1:a=0[basev];", concatInputs, imageStreamCount)
 	}
-	if concatInputs == "" {
-		return nil, fmt.Errorf("no visual segments present")
+
+	videoLabel := "[basev]"
+	if grade := gradingFilter(in.Grading); grade != "" {
+		filter += fmt.Sprintf("[basev]%s[graded];", grade)
+		videoLabel = "[graded]"
 	}
-	filter += fmt.Sprintf("%s concat=n=%d:v=1:a=0[basev];", concatInputs, imageStreamCount)
 
 	// Apply text overlays with enable between(t, start, end)
-	videoLabel := "[basev]"
 	textIdx := 0
 	textsegments := in.Timeline.TextTimeline.TextSegments
+	if in.SubtitlesPath != "" {
+		// burned captions replace the drawtext overlays entirely
+		filter += fmt.Sprintf("%sass=filename=%s[vsub];", videoLabel, escapeFilterPath(in.SubtitlesPath))
+		videoLabel = "[vsub]"
+		textsegments = nil
+	}
 	for _, t := range sorted {
 		if t.ImageIndex < 0 || t.ImageIndex >= len(in.ImagePaths) {
 			continue
@@ -317,7 +588,7 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 		}
 		text := escapeDrawtext(textsegments[textIdx].Text)
 		xy := positionXY(textsegments[textIdx].Position, in.Metadata_FFmpeg.Width, in.Metadata_FFmpeg.Height)
-		bg := ""
+		fontColor, fontSize, bg := drawtextStyle(in)
 		/*
 			if textsegments[textIdx].BackgroundColor != "" {
 				bg = fmt.Sprintf(":box=1:boxcolor=%s@0.6", textsegments[textIdx].BackgroundColor)
@@ -326,11 +597,17 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 		labelOut := fmt.Sprintf("[vtx%d]", textIdx)
 		enable := fmt.Sprintf("enable='between(t,%.3f,%.3f)'", float64(t.StartTime), float64(t.StartTime+t.Duration))
 		filter += fmt.Sprintf("%s drawtext=text=%s:fontcolor=%s:fontsize=%d:x=%s:y=%s%s:%s %s;",
-			videoLabel, text, colorOrDefault("white"), maxInt(0, 12), xy[0], xy[1], bg, enable, labelOut)
+			videoLabel, text, fontColor, fontSize, xy[0], xy[1], bg, enable, labelOut)
 		videoLabel = labelOut
 		textIdx++
 	}
 
+	if in.Brand != nil {
+		var brandFilter string
+		brandFilter, videoLabel = brandFilters(in, videoLabel, sorted, logoIdx)
+		filter += brandFilter
+	}
+
 	// Label final video stream
 	finalVideoLabel := videoLabel
 	if finalVideoLabel == "[basev]" {
@@ -338,26 +615,37 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 		finalVideoLabel = "[vout]"
 	}
 
-	// Audio mixing
+	// Audio mixing; narration split into several clips (one per emphasis run) is joined first
 	audioMap := ""
+	narrSrc := fmt.Sprintf("[%d:a]", narrIdx)
+	if len(narrationPath) > 1 {
+		for i := range narrationPath {
+			filter += fmt.Sprintf("[%d:a]", narrIdx+i)
+		}
+		filter += fmt.Sprintf("concat=n=%d:v=0:a=1[narr];", len(narrationPath))
+		narrSrc = "[narr]"
+	}
 	if narrIdx >= 0 && musicIdx >= 0 {
 		mv := clamp01(in.Audio.MusicVolume)
 		nv := in.Audio.NarrationVolume
 		if nv <= 0 {
 			nv = 1.0
 		}
-		filter += fmt.Sprintf("[%d:a]volume=%0.2f[na];", narrIdx, nv)
+		filter += fmt.Sprintf("%s%svolume=%0.2f[na];", narrSrc, in.Audio.NarrationFit.filter(), nv)
 		filter += fmt.Sprintf("[%d:a]volume=%0.2f[ma];", musicIdx, mv)
 		filter += "[na][ma]amix=inputs=2:duration=first:dropout_transition=2[aout];"
 		audioMap = "[aout]"
 	} else if narrIdx >= 0 {
-		filter += fmt.Sprintf("[%d:a]volume=%0.2f[aout];", narrIdx, maxFloat(in.Audio.NarrationVolume, 1.0))
+		filter += fmt.Sprintf("%s%svolume=%0.2f[aout];", narrSrc, in.Audio.NarrationFit.filter(), maxFloat(in.Audio.NarrationVolume, 1.0))
 		audioMap = "[aout]"
 	} else if musicIdx >= 0 {
 		filter += fmt.Sprintf("[%d:a]volume=%0.2f[aout];", musicIdx, clamp01(in.Audio.MusicVolume))
 		audioMap = "[aout]"
 	}
 
+	if err := validateFiltergraph(filter); err != nil {
+		return nil, fmt.Errorf("invalid filtergraph: %v", err)
+	}
 	args = append(args,
 		"-filter_complex", filter,
 		"-map", finalVideoLabel,
@@ -386,6 +674,206 @@ func (b *FFmpegCommandBuilder) Build(in CommandBuildInput) ([]string, error) {
 	return args, nil
 }
 
+// drawtextStyle returns font color, size and extra drawtext options: brand styling when a kit is
+// set, plain white text otherwise
+func drawtextStyle(in CommandBuildInput) (string, int, string) {
+	if in.Brand == nil {
+		return colorOrDefault(""), 12, ""
+	}
+	return in.Brand.PrimaryColor, in.Metadata_FFmpeg.Height / 28, brandTextStyle(in.Brand.Fonts.Body, in.Brand.SecondaryColor)
+}
+
+// brandFilters appends the brand layers after the text overlays:
+// an intro title over the opening seconds, the end card (solid primary color with
+// outro text and CTA) concatenated after the content, then the logo watermark over everything.
+func brandFilters(in CommandBuildInput, videoLabel string, sorted []models.ImageSegment, logoIdx int) (string, string) {
+	brand := in.Brand
+	w, h, fps := in.Metadata_FFmpeg.Width, in.Metadata_FFmpeg.Height, in.Metadata_FFmpeg.FPS
+	filter := ""
+
+	if brand.IntroText != "" && len(sorted) > 0 {
+		introEnd := math.Min(2.5, float64(sorted[0].Duration))
+		filter += fmt.Sprintf("%s drawtext=text=%s:fontcolor=%s:fontsize=%d:x=(w-tw)/2:y=h/5%s:enable='between(t,0,%.3f)' [vintro];",
+			videoLabel, escapeDrawtext(brand.IntroText), brand.PrimaryColor, h/18, brandTextStyle(brand.Fonts.Heading, brand.SecondaryColor), introEnd)
+		videoLabel = "[vintro]"
+	}
+
+	if brand.HasEndCard() {
+		card := fmt.Sprintf("color=c=%s:s=%dx%d:r=%d:d=%.3f,format=yuv420p,setsar=1", brand.PrimaryColor, w, h, fps, brand.EndCardDuration)
+		if brand.OutroText != "" {
+			card += fmt.Sprintf(",drawtext=text=%s:fontcolor=%s:fontsize=%d:x=(w-tw)/2:y=(h/2)-th-%d%s",
+				escapeDrawtext(brand.OutroText), brand.SecondaryColor, h/20, h/40, brandFontOption(brand.Fonts.Heading))
+		}
+		if brand.CTA != "" {
+			card += fmt.Sprintf(",drawtext=text=%s:fontcolor=%s:fontsize=%d:x=(w-tw)/2:y=(h/2)+%d%s:box=1:boxcolor=%s:boxborderw=%d",
+				escapeDrawtext(brand.CTA), brand.PrimaryColor, h/26, h/40, brandFontOption(brand.Fonts.Body), brand.SecondaryColor, h/60)
+		}
+		filter += card + "[endcard];"
+		filter += fmt.Sprintf("%s setsar=1[vcontent];[vcontent][endcard]concat=n=2:v=1:a=0[vcard];", videoLabel)
+		videoLabel = "[vcard]"
+	}
+
+	if logoIdx >= 0 {
+		logoW := maxInt(int(float64(w)*brand.Watermark.Scale), 16)
+		margin := w / 30
+		x, y := watermarkXY(brand.Watermark.Position, margin)
+		filter += fmt.Sprintf("[%d:v]scale=%d:-1,format=rgba,colorchannelmixer=aa=%.2f[wm];%s[wm]overlay=x=%s:y=%s[vbrand];",
+			logoIdx, logoW, clamp01(brand.Watermark.Opacity), videoLabel, x, y)
+		videoLabel = "[vbrand]"
+	}
+	return filter, videoLabel
+}
+
+// brandTextStyle renders brand text on a translucent secondary-color box
+func brandTextStyle(font, boxColor string) string {
+	return fmt.Sprintf("%s:box=1:boxcolor=%s@0.6:boxborderw=16", brandFontOption(font), boxColor)
+}
+
+func brandFontOption(font string) string {
+	if font == "" {
+		return ""
+	}
+	return ":font=" + escapeFilterValue(font)
+}
+
+func watermarkXY(pos models.WatermarkPosition, margin int) (string, string) {
+	switch pos {
+	case models.WatermarkTopLeft:
+		return fmt.Sprint(margin), fmt.Sprint(margin)
+	case models.WatermarkTopRight:
+		return fmt.Sprintf("W-w-%d", margin), fmt.Sprint(margin)
+	case models.WatermarkBottomLeft:
+		return fmt.Sprint(margin), fmt.Sprintf("H-h-%d", margin)
+	default:
+		return fmt.Sprintf("W-w-%d", margin), fmt.Sprintf("H-h-%d", margin)
+	}
+}
+
+// segmentFilter returns the filter chain turning one still image into a clip of t.Duration seconds.
+// Fit mode letterboxes the image; fill mode scales to cover and crops around the focal point;
+// "zoom" segments additionally get a Ken Burns push-in anchored on the focal point.
+func segmentFilter(in CommandBuildInput, t models.ImageSegment) string {
+	w, h, fps := in.Metadata_FFmpeg.Width, in.Metadata_FFmpeg.Height, in.Metadata_FFmpeg.FPS
+	kenBurns := t.Transition.Effect == "zoom"
+	if in.CropMode != models.CropModeFill && !kenBurns {
+		// Use tpad to clone last frame to desired duration for still images, then normalize PTS
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,format=yuv420p,fps=%d,tpad=stop_mode=clone:stop_duration=%f,setpts=PTS-STARTPTS%s",
+			w, h, w, h, fps, float64(t.Duration), fadeFilter(t))
+	}
+
+	info := models.ImageInfo{FocalPoint: models.FocalPoint{X: 0.5, Y: 0.5}}
+	if t.ImageIndex < len(in.ImageInfos) {
+		info = in.ImageInfos[t.ImageIndex]
+	}
+	crop, fx, fy := fillCrop(info, w, h)
+
+	if !kenBurns {
+		return fmt.Sprintf("%s,format=yuv420p,fps=%d,tpad=stop_mode=clone:stop_duration=%f,setpts=PTS-STARTPTS%s",
+			crop, fps, float64(t.Duration), fadeFilter(t))
+	}
+
+	// zoompan emits d frames from the single input frame, so no tpad is needed.
+	// Upscale first to reduce the sub-pixel jitter zoompan is known for.
+	frames := maxInt(int(math.Round(float64(t.Duration)*float64(fps))), 1)
+	zoomStep := (kenBurnsMaxZoom - 1) / float64(frames)
+	return fmt.Sprintf("%s,scale=%d:%d,zoompan=z='min(1+%.6f*on,%.3f)':x='(iw-iw/zoom)*%.4f':y='(ih-ih/zoom)*%.4f':d=%d:s=%dx%d:fps=%d,format=yuv420p,setpts=PTS-STARTPTS",
+		crop, w*2, h*2, zoomStep, kenBurnsMaxZoom, fx, fy, frames, w, h, fps)
+}
+
+// xfadeTransition is the xfade transition a segment blends in with; "" for effects that cut
+func xfadeTransition(t models.ImageSegment) string {
+	switch t.Transition.Effect {
+	case "dissolve":
+		return "dissolve"
+	case "slide":
+		return "slideleft"
+	}
+	return ""
+}
+
+// blendSeconds is how long a segment takes to blend in
+func blendSeconds(t models.ImageSegment) float64 {
+	return math.Min(0.5, float64(t.Duration)/4)
+}
+
+// joinSegments joins the [segN] clips into [basev]: segments with blend[i] > 0 cross into the
+// previous clip with xfade starting blend[i] before its end, the others are concatenated. Every
+// clip is held blend[i+1] longer than its segment, so each blend starts at its segment's start.
+func joinSegments(sorted []models.ImageSegment, blend []float64) string {
+	filter := ""
+	acc := "[seg0]"
+	// length of acc in seconds; only called with a blend, so there are at least two segments
+	length := float64(sorted[0].Duration) + blend[1]
+	for i := 1; i < len(sorted); i++ {
+		clip := float64(sorted[i].Duration)
+		if i+1 < len(sorted) {
+			clip += blend[i+1]
+		}
+		out := fmt.Sprintf("[join%d]", i)
+		if i == len(sorted)-1 {
+			out = "[basev]"
+		}
+		if blend[i] > 0 {
+			filter += fmt.Sprintf("%s[seg%d]xfade=transition=%s:duration=%.3f:offset=%.3f%s;",
+				acc, i, xfadeTransition(sorted[i]), blend[i], length-blend[i], out)
+			length += clip - blend[i]
+		} else {
+			filter += fmt.Sprintf("%s[seg%d]concat=n=2:v=1:a=0%s;", acc, i, out)
+			length += clip
+		}
+		acc = out
+	}
+	return filter
+}
+
+// fadeFilter dips "fade" segments through black at both ends; other effects cut
+func fadeFilter(t models.ImageSegment) string {
+	if t.Transition.Effect != "fade" || t.Duration <= 0 {
+		return ""
+	}
+	d := math.Min(0.3, float64(t.Duration)/4)
+	return fmt.Sprintf(",fade=t=in:st=0:d=%.2f,fade=t=out:st=%.3f:d=%.2f", d, float64(t.Duration)-d, d)
+}
+
+// gradingFilter maps a theme grading onto eq/colorbalance adjustments; unknown gradings are left alone
+func gradingFilter(grading string) string {
+	switch grading {
+	case "warm":
+		return "colorbalance=rs=0.08:gs=0.02:bs=-0.08:rm=0.05:bm=-0.05"
+	case "cool":
+		return "colorbalance=rs=-0.06:bs=0.08:rm=-0.04:bm=0.05"
+	case "vibrant":
+		return "eq=saturation=1.35:contrast=1.05"
+	case "muted":
+		return "eq=saturation=0.7:contrast=0.95"
+	case "high-contrast":
+		return "eq=contrast=1.3:saturation=1.1"
+	case "soft":
+		return "eq=contrast=0.9:brightness=0.03:saturation=0.9"
+	}
+	return ""
+}
+
+// fillCrop scales the image to cover w x h and crops a w x h window centred on the focal point
+// (clamped to the image). Returns the filter plus the focal point in cropped-window coordinates.
+// Without known dimensions the crop is expressed relative to the scaled input instead.
+func fillCrop(info models.ImageInfo, w, h int) (string, float64, float64) {
+	fx, fy := clamp01(info.FocalPoint.X), clamp01(info.FocalPoint.Y)
+	if info.Width <= 0 || info.Height <= 0 {
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d:'min(max(iw*%.4f-ow/2,0),iw-ow)':'min(max(ih*%.4f-oh/2,0),ih-oh)'",
+			w, h, w, h, fx, fy), 0.5, 0.5
+	}
+
+	scale := math.Max(float64(w)/float64(info.Width), float64(h)/float64(info.Height))
+	sw := maxInt(int(math.Ceil(float64(info.Width)*scale)), w)
+	sh := maxInt(int(math.Ceil(float64(info.Height)*scale)), h)
+	cx := math.Min(math.Max(fx*float64(sw)-float64(w)/2, 0), float64(sw-w))
+	cy := math.Min(math.Max(fy*float64(sh)-float64(h)/2, 0), float64(sh-h))
+
+	crop := fmt.Sprintf("scale=%d:%d,crop=%d:%d:%d:%d", sw, sh, w, h, int(cx), int(cy))
+	return crop, clamp01((fx*float64(sw) - cx) / float64(w)), clamp01((fy*float64(sh) - cy) / float64(h))
+}
+
 func clamp01(v float64) float64 {
 	if v < 0 {
 		return 0
@@ -417,31 +905,11 @@ func colorOrDefault(hex string) string {
 	return hex
 }
 
-// escapeDrawtext escapes characters for ffmpeg drawtext
+// escapeDrawtext escapes text for a drawtext text= option: '\' and '%' for drawtext's own
+// expansion, so a lone '%' is not read as a %{...} sequence, then for the option value and
+// the filtergraph, so ',', ';' and brackets in the text stay text
 func escapeDrawtext(s string) string {
-	// Basic escaping: colon, backslash, quotes
-	esc := s
-	esc = replaceAll(esc, "\\", "\\\\")
-	esc = replaceAll(esc, ":", "\\:")
-	// Avoid using \' which some linters flag; build as "\\" + "'"
-	esc = replaceAll(esc, "'", "\\"+"'")
-	return esc
-}
-
-func replaceAll(s, old, new string) string {
-	for {
-		idx := -1
-		for i := 0; i+len(old) <= len(s); i++ {
-			if s[i:i+len(old)] == old {
-				idx = i
-				break
-			}
-		}
-		if idx < 0 {
-			return s
-		}
-		s = s[:idx] + new + s[idx+len(old):]
-	}
+	return escapeFilterValue(backslashEscape(s, `\%`))
 }
 
 // positionXY maps semantic positions to x/y expressions usable by ffmpeg drawtext
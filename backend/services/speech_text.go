@@ -0,0 +1,267 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	models "social-media-ai-video/models"
+)
+
+// Narration text is prepared before it goes to the TTS provider:
+//   - markup in TextSegment.Text: "[pause]", "[pause 1.5s]" or "[pause 300ms]" becomes a break tag,
+//     "*words*" are stressed (ElevenLabs stresses capitalized words). On screen the markup is removed.
+//   - lexicon entries replace matching words (whole words, case-insensitive) with a phoneme tag
+//     when the model supports them, otherwise with their alias.
+//   - emphasis (voice-wide or per segment) becomes voice settings; segments whose emphasis differs
+//     from their neighbours are synthesized as separate clips.
+// The spoken text then differs from what is shown, so speechText also records which spoken words
+// each shown word became; caption timings are mapped back through it.
+
+var pauseMarkupRe = regexp.MustCompile(`\[pause(?:\s+(\d+(?:\.\d+)?)\s*(ms|s))?\]`)
+
+const defaultTTSModel = "eleven_multilingual_v2"
+
+// phonemeModels are the ElevenLabs models that honor phoneme tags; others get lexicon aliases
+var phonemeModels = map[string]bool{
+	"eleven_flash_v2":       true,
+	"eleven_turbo_v2":       true,
+	"eleven_monolingual_v1": true,
+}
+
+const (
+	defaultPause = 0.5
+	// longest break ElevenLabs honors
+	maxPause = 3.0
+)
+
+// speechToken is one shown word, or a pause when pause > 0
+type speechToken struct {
+	word       string
+	emphasized bool
+	pause      float64
+}
+
+// wordGroup maps consecutive shown words onto the number of spoken words produced for them
+type wordGroup struct {
+	shown  []string
+	spoken int
+}
+
+func hasSpeechMarkup(text string) bool {
+	return strings.Contains(text, "*") || pauseMarkupRe.MatchString(text)
+}
+
+// StripSpeechMarkup returns text as it should appear on screen
+func StripSpeechMarkup(text string) string {
+	if !hasSpeechMarkup(text) {
+		return text
+	}
+	var words []string
+	for _, t := range tokenizeSpeech(text) {
+		if t.pause == 0 {
+			words = append(words, t.word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func tokenizeSpeech(text string) []speechToken {
+	var tokens []speechToken
+	emphasized := false
+	addWords := func(chunk string) {
+		for _, f := range strings.Fields(chunk) {
+			if strings.HasPrefix(f, "*") {
+				emphasized = true
+			}
+			closes := strings.Contains(strings.TrimPrefix(f, "*"), "*")
+			if w := strings.ReplaceAll(f, "*", ""); w != "" {
+				tokens = append(tokens, speechToken{word: w, emphasized: emphasized})
+			}
+			if closes {
+				emphasized = false
+			}
+		}
+	}
+	last := 0
+	for _, m := range pauseMarkupRe.FindAllStringSubmatchIndex(text, -1) {
+		addWords(text[last:m[0]])
+		last = m[1]
+		pause := defaultPause
+		if m[2] >= 0 {
+			pause, _ = strconv.ParseFloat(text[m[2]:m[3]], 64)
+			if text[m[4]:m[5]] == "ms" {
+				pause /= 1000
+			}
+		}
+		if pause = min(pause, maxPause); pause > 0 {
+			tokens = append(tokens, speechToken{pause: pause})
+		}
+	}
+	addWords(text[last:])
+	return tokens
+}
+
+// speechText builds the text sent to the provider from the narrated segments
+func speechText(segments []models.TextSegment, lexicon []models.LexiconEntry, phonemes bool) (string, []wordGroup) {
+	entries := map[string]models.LexiconEntry{}
+	longest := 0
+	for _, e := range lexicon {
+		key := strings.ToLower(strings.Join(strings.Fields(e.Word), " "))
+		entries[key] = e
+		longest = max(longest, len(strings.Fields(key)))
+	}
+
+	var parts []string
+	var groups []wordGroup
+	for _, seg := range segments {
+		tokens := tokenizeSpeech(seg.Text)
+		for i := 0; i < len(tokens); {
+			t := tokens[i]
+			if t.pause > 0 {
+				parts = append(parts, fmt.Sprintf(`<break time="%.1fs" />`, t.pause))
+				i++
+				continue
+			}
+			if n, e := matchLexicon(tokens[i:], entries, longest); n > 0 {
+				spoken, count := pronounce(tokens[i:i+n], e, phonemes)
+				parts = append(parts, spoken)
+				groups = append(groups, wordGroup{shown: shownWords(tokens[i : i+n]), spoken: count})
+				i += n
+				continue
+			}
+			w := t.word
+			if t.emphasized {
+				w = strings.ToUpper(w)
+			}
+			parts = append(parts, w)
+			groups = append(groups, wordGroup{shown: []string{t.word}, spoken: 1})
+			i++
+		}
+	}
+	return strings.Join(parts, " "), groups
+}
+
+// matchLexicon returns the length and entry of the longest lexicon phrase at the start of tokens
+func matchLexicon(tokens []speechToken, entries map[string]models.LexiconEntry, longest int) (int, models.LexiconEntry) {
+	for n := min(longest, len(tokens)); n >= 1; n-- {
+		cores := make([]string, 0, n)
+		for _, t := range tokens[:n] {
+			if t.pause > 0 {
+				break
+			}
+			cores = append(cores, strings.ToLower(wordCore(t.word)))
+		}
+		if len(cores) < n {
+			continue
+		}
+		if e, ok := entries[strings.Join(cores, " ")]; ok {
+			return n, e
+		}
+	}
+	return 0, models.LexiconEntry{}
+}
+
+// pronounce renders matched tokens through a lexicon entry, keeping surrounding punctuation,
+// and returns how many words will be spoken
+func pronounce(tokens []speechToken, e models.LexiconEntry, phonemes bool) (string, int) {
+	first, last := tokens[0].word, tokens[len(tokens)-1].word
+	lead := first[:strings.Index(first, wordCore(first))]
+	trail := last[strings.LastIndex(last, wordCore(last))+len(wordCore(last)):]
+	cores := make([]string, len(tokens))
+	for i, t := range tokens {
+		cores[i] = wordCore(t.word)
+	}
+	phrase := strings.Join(cores, " ")
+	switch {
+	case phonemes && e.Phoneme != "":
+		return fmt.Sprintf(`%s<phoneme alphabet="%s" ph="%s">%s</phoneme>%s`, lead, e.Alphabet, e.Phoneme, phrase, trail), len(cores)
+	case e.Alias != "":
+		return lead + e.Alias + trail, len(strings.Fields(e.Alias))
+	}
+	// phoneme-only entry on a model without phoneme support
+	return lead + phrase + trail, len(cores)
+}
+
+// wordCore strips leading and trailing punctuation
+func wordCore(w string) string {
+	core := strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if core == "" {
+		return w
+	}
+	return core
+}
+
+func shownWords(tokens []speechToken) []string {
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.word
+	}
+	return words
+}
+
+// displayWordTimings maps provider word timings (of the spoken text) back onto the shown words.
+// nil means they do not line up; captions then fall back to segment timing.
+func displayWordTimings(spoken []models.WordTiming, groups []wordGroup) []models.WordTiming {
+	total := 0
+	for _, g := range groups {
+		total += g.spoken
+	}
+	if len(spoken) != total {
+		return nil
+	}
+	out := make([]models.WordTiming, 0, len(spoken))
+	i := 0
+	for _, g := range groups {
+		span := spoken[i : i+g.spoken]
+		i += g.spoken
+		if len(span) == len(g.shown) {
+			for k, w := range g.shown {
+				out = append(out, models.WordTiming{Word: w, Start: span[k].Start, End: span[k].End})
+			}
+			continue
+		}
+		out = append(out, spreadWords(g.shown, span[0].Start, span[len(span)-1].End)...)
+	}
+	return out
+}
+
+// emphasisSettings maps the composition's emphasis (normal, strong, soft, excited) onto
+// ElevenLabs stability and style: less stability and more style read as more expressive
+func emphasisSettings(emphasis string, stability float64) (float64, float64) {
+	switch strings.ToLower(emphasis) {
+	case "strong":
+		return clampFloat(stability-0.15, 0, 1), 0.35
+	case "excited":
+		return clampFloat(stability-0.3, 0, 1), 0.6
+	case "soft":
+		return clampFloat(stability+0.15, 0, 1), 0
+	}
+	return stability, 0
+}
+
+// narrationRuns splits the narrated segments into runs of equal emphasis, each synthesized as
+// one clip with its own voice settings. Segments without emphasis follow the voice's.
+func narrationRuns(input models.TTSInput) []models.TTSInput {
+	var runs []models.TTSInput
+	for _, seg := range input.TextInput {
+		if strings.TrimSpace(seg.Text) == "" {
+			continue
+		}
+		emphasis := strings.ToLower(seg.Emphasis)
+		if emphasis == "" {
+			emphasis = strings.ToLower(input.VoiceSettings.Emphasis)
+		}
+		if n := len(runs); n > 0 && strings.ToLower(runs[n-1].VoiceSettings.Emphasis) == emphasis {
+			runs[n-1].TextInput = append(runs[n-1].TextInput, seg)
+			continue
+		}
+		run := input
+		run.TextInput = []models.TextSegment{seg}
+		run.VoiceSettings.Emphasis = emphasis
+		runs = append(runs, run)
+	}
+	return runs
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// Storage holds what outlives a request: kept render outputs (videos, thumbnails, narration
+// audio, ...) and the uploaded images they were rendered from. Objects are addressed by
+// slash-separated keys such as renders/<job id>/video.mp4; clients only ever get expiring
+// signed URLs. Rendering itself still works on local files, so objects are copied in and out.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns ErrObjectNotFound for missing keys
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds for missing keys
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a download URL for key that stops working after ttl
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// NewStorage builds the backend selected by STORAGE_BACKEND
+func NewStorage(cfg *config.APIConfig) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		return NewLocalStorage(cfg)
+	case "s3":
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (expected local or s3)", cfg.StorageBackend)
+	}
+}
+
+// validKey rejects keys that could escape a prefix or a local root
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key || key == "." || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
+
+// PutFile uploads a local file
+func PutFile(ctx context.Context, st Storage, key, localPath, contentType string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", localPath, err)
+	}
+	return st.Put(ctx, key, f, fi.Size(), contentType)
+}
+
+// FetchFile downloads an object to localPath
+func FetchFile(ctx context.Context, st Storage, key, localPath string) error {
+	r, err := st.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create dir for %s: %v", localPath, err)
+	}
+	f, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", localPath, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(localPath)
+		return fmt.Errorf("failed to download %s: %v", key, err)
+	}
+	return f.Close()
+}
+
+// renderKey is where a kept render's artifact is stored
+func renderKey(jobID, name string) string {
+	return "renders/" + jobID + "/" + name
+}
+
+// uploadKey is where an upload workspace's file is stored
+func uploadKey(workspaceDir, name string) string {
+	return "uploads/" + filepath.Base(workspaceDir) + "/" + filepath.Base(name)
+}
+
+// StoreInputs uploads a workspace's input images and returns their keys, in order
+func StoreInputs(ctx context.Context, st Storage, workspaceDir string, paths []string) ([]string, error) {
+	keys := make([]string, len(paths))
+	for i, p := range paths {
+		keys[i] = uploadKey(workspaceDir, p)
+		if err := PutFile(ctx, st, keys[i], p, mime.TypeByExtension(filepath.Ext(p))); err != nil {
+			return nil, fmt.Errorf("failed to store input image: %v", err)
+		}
+	}
+	return keys, nil
+}
+
+// SignResult returns a copy of result whose stored artifacts carry fresh signed URLs.
+// Artifacts without a key (renders kept before storage existed) keep their URL.
+func SignResult(st Storage, result *models.RenderResult, ttl time.Duration) (*models.RenderResult, error) {
+	if result == nil {
+		return nil, nil
+	}
+	signed := *result
+	signed.Artifacts = make([]models.Artifact, len(result.Artifacts))
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	for i, a := range result.Artifacts {
+		if a.Key != "" {
+			url, err := st.SignedURL(a.Key, ttl)
+			if err != nil {
+				return nil, err
+			}
+			a.URL = url
+			a.ExpiresAt = &expires
+		}
+		signed.Artifacts[i] = a
+	}
+	return &signed, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"social-media-ai-video/config"
+)
+
+// LocalStorage keeps objects as files under StorageDir. Signed URLs point at the API's
+// /files route, which checks the HMAC and expiry before serving the file.
+type LocalStorage struct {
+	root   string
+	secret []byte
+}
+
+var ErrInvalidSignature = errors.New("invalid or expired download link")
+
+func NewLocalStorage(cfg *config.APIConfig) (*LocalStorage, error) {
+	root, err := filepath.Abs(cfg.StorageDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STORAGE_DIR: %v", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir: %v", err)
+	}
+	secret := []byte(cfg.StorageURLSecret)
+	if len(secret) == 0 {
+		// links then only work until the next restart
+		log.Printf("STORAGE_URL_SECRET is not set; using a random key for download links")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate storage url secret: %v", err)
+		}
+	}
+	return &LocalStorage{root: root, secret: secret}, nil
+}
+
+// Path maps a key onto its file
+func (ls *LocalStorage) Path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(ls.root, filepath.FromSlash(key)), nil
+}
+
+func (ls *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := ls.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create storage dir: %v", err)
+	}
+	// write next to the target and rename so readers never see partial files
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put_*")
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	return nil
+}
+
+func (ls *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := ls.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return f, nil
+}
+
+func (ls *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := ls.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+// SignedURL returns /files/<key>?expires=<unix>&signature=<hmac>
+func (ls *LocalStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{"expires": {expires}, "signature": {ls.sign(key, expires)}}
+	return (&url.URL{Path: "/files/" + key, RawQuery: q.Encode()}).String(), nil
+}
+
+// Verify checks a signed URL's parameters and returns the file to serve
+func (ls *LocalStorage) Verify(key, expires, signature string) (string, error) {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(ls.sign(key, expires))) {
+		return "", ErrInvalidSignature
+	}
+	return ls.Path(key)
+}
+
+func (ls *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, ls.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	models "social-media-ai-video/models"
+)
+
+// Caption export: turns the TextTimeline (refined by narration word timings when
+// available) into SRT/WebVTT sidecars and an ASS script with karaoke highlighting
+// that ffmpeg's ass filter can burn into the video.
+
+// CaptionCue is one caption on screen; Words drive karaoke timing in ASS output
+type CaptionCue struct {
+	Start    float64
+	End      float64
+	Text     string
+	Position string
+	Words    []models.WordTiming
+}
+
+// BuildCaptionCues maps text segments to cues. When narration word timings are given,
+// each segment takes the next run of words (narration is the segments joined in order)
+// and its cue follows the spoken interval; otherwise the segment's own timing is used
+// and words are spread across it proportionally to their length.
+func BuildCaptionCues(tl models.TextTimeline, words []models.WordTiming) []CaptionCue {
+	segs := make([]models.TextSegment, 0, len(tl.TextSegments))
+	for _, s := range tl.TextSegments {
+		if strings.TrimSpace(s.Text) != "" {
+			segs = append(segs, s)
+		}
+	}
+	// narration is generated in segment order, so only re-sort when there is no alignment
+	if len(words) == 0 {
+		sort.SliceStable(segs, func(i, j int) bool { return segs[i].StartTime < segs[j].StartTime })
+	}
+
+	cues := make([]CaptionCue, 0, len(segs))
+	wi := 0
+	for _, s := range segs {
+		fields := strings.Fields(s.Text)
+		cue := CaptionCue{Text: strings.Join(fields, " "), Position: s.Position}
+
+		if wi+len(fields) <= len(words) {
+			cue.Words = words[wi : wi+len(fields)]
+			cue.Start = cue.Words[0].Start
+			cue.End = cue.Words[len(cue.Words)-1].End
+			wi += len(fields)
+		} else {
+			cue.Start = float64(s.StartTime)
+			cue.End = float64(s.StartTime + s.Duration)
+			cue.Words = spreadWords(fields, cue.Start, cue.End)
+		}
+		if cue.End <= cue.Start {
+			cue.End = cue.Start + 0.5
+		}
+		cues = append(cues, cue)
+	}
+	return cues
+}
+
+func spreadWords(fields []string, start, end float64) []models.WordTiming {
+	total := 0
+	for _, f := range fields {
+		total += len([]rune(f))
+	}
+	if total == 0 {
+		return nil
+	}
+	out := make([]models.WordTiming, 0, len(fields))
+	t := start
+	for _, f := range fields {
+		d := (end - start) * float64(len([]rune(f))) / float64(total)
+		out = append(out, models.WordTiming{Word: f, Start: t, End: t + d})
+		t += d
+	}
+	return out
+}
+
+// WriteSRT writes cues as a SubRip file
+func WriteSRT(cues []CaptionCue, path string) error {
+	var b strings.Builder
+	for i, c := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTime(c.Start), srtTime(c.End), c.Text)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// WriteVTT writes cues as a WebVTT file
+func WriteVTT(cues []CaptionCue, path string) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for i, c := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s%s\n%s\n\n", i+1, vttTime(c.Start), vttTime(c.End), vttCueSettings(c.Position), c.Text)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// ASSStyle controls the look of burned-in captions
+type ASSStyle struct {
+	FontFamily string
+	Bold       bool
+	// Colors are "#RRGGBB"; Highlight is the karaoke color once a word has been spoken
+	TextColor      string
+	HighlightColor string
+	OutlineColor   string
+}
+
+// WriteASS writes an Advanced SubStation script sized for a w x h canvas with per-word karaoke (\k) timing
+func WriteASS(cues []CaptionCue, style ASSStyle, w, h int, path string) error {
+	font := style.FontFamily
+	if font == "" {
+		font = "Arial"
+	}
+	bold := 0
+	if style.Bold {
+		bold = -1
+	}
+	fontSize := maxInt(h/22, 12)
+	marginV := h / 10
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Script Info]\nScriptType: v4.00+\nPlayResX: %d\nPlayResY: %d\nWrapStyle: 0\nScaledBorderAndShadow: yes\n\n", w, h)
+	b.WriteString("[V4+ Styles]\n")
+	b.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	// karaoke fills from SecondaryColour to PrimaryColour as each word is spoken
+	fmt.Fprintf(&b, "Style: Default,%s,%d,%s,%s,%s,&H80000000,%d,0,0,0,100,100,0,0,1,%d,1,5,%d,%d,%d,1\n\n",
+		assEscapeField(font), fontSize,
+		assColor(style.HighlightColor, "#FFD400"), assColor(style.TextColor, "#FFFFFF"), assColor(style.OutlineColor, "#000000"),
+		bold, maxInt(fontSize/12, 2), w/12, w/12, marginV)
+	b.WriteString("[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+
+	for _, c := range cues {
+		var text strings.Builder
+		text.WriteString(assAlignment(c.Position))
+		prev := c.Start
+		for i, wd := range c.Words {
+			// \k durations are in centiseconds and count from the previous word's end; fold gaps in
+			cs := int(math.Round((wd.End - prev) * 100))
+			if cs < 1 {
+				cs = 1
+			}
+			prev = wd.End
+			if i > 0 {
+				text.WriteString(" ")
+			}
+			fmt.Fprintf(&text, "{\\k%d}%s", cs, assEscapeText(wd.Word))
+		}
+		if len(c.Words) == 0 {
+			text.WriteString(assEscapeText(c.Text))
+		}
+		fmt.Fprintf(&b, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", assTime(c.Start), assTime(c.End), text.String())
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func srtTime(sec float64) string {
+	h, m, s, ms := splitTime(sec)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
+}
+
+func vttTime(sec float64) string {
+	h, m, s, ms := splitTime(sec)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+}
+
+func assTime(sec float64) string {
+	h, m, s, ms := splitTime(sec)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", h, m, s, ms/10)
+}
+
+func splitTime(sec float64) (int, int, int, int) {
+	if sec < 0 {
+		sec = 0
+	}
+	total := int(math.Round(sec * 1000))
+	return total / 3600000, (total / 60000) % 60, (total / 1000) % 60, total % 1000
+}
+
+// vttCueSettings mirrors the semantic text positions used by drawtext
+func vttCueSettings(pos string) string {
+	switch pos {
+	case "center-left":
+		return " line:50% position:25% align:center"
+	case "center-right":
+		return " line:50% position:75% align:center"
+	default:
+		return " line:50% align:center"
+	}
+}
+
+func assAlignment(pos string) string {
+	switch pos {
+	case "center-left":
+		return "{\\an4}"
+	case "center-right":
+		return "{\\an6}"
+	default:
+		return "{\\an5}"
+	}
+}
+
+// assColor converts "#RRGGBB" to ASS "&H00BBGGRR"
+func assColor(hex, def string) string {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) != 6 {
+		hex = strings.TrimPrefix(def, "#")
+	}
+	return fmt.Sprintf("&H00%s%s%s", strings.ToUpper(hex[4:6]), strings.ToUpper(hex[2:4]), strings.ToUpper(hex[0:2]))
+}
+
+// assEscapeText keeps user text from being read as override blocks or line breaks
+func assEscapeText(s string) string {
+	s = strings.ReplaceAll(s, "\\", "/")
+	s = strings.ReplaceAll(s, "{", "(")
+	s = strings.ReplaceAll(s, "}", ")")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func assEscapeField(s string) string {
+	return strings.ReplaceAll(s, ",", " ")
+}
+
+// escapeFilterPath escapes a file path for use as a filter option value (see escapeFilterValue)
+func escapeFilterPath(p string) string {
+	return escapeFilterValue(filepath.ToSlash(p))
+}
+
+// escapeFilterValue backslash-escapes s for use as a filter option value inside
+// -filter_complex: once for the option value (':' separates options) and once for the
+// filtergraph itself. No quoting, since a backslash is literal inside ffmpeg's single quotes.
+func escapeFilterValue(s string) string {
+	s = backslashEscape(s, `\':`)
+	return backslashEscape(s, `\'[],;`)
+}
+
+func backslashEscape(s, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
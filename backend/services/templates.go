@@ -0,0 +1,275 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"social-media-ai-video/config"
+	models "social-media-ai-video/models"
+)
+
+// Composition templates: built-ins defined below plus optional JSON files in
+// <DataDir>/templates. A filled template is a plain VideoCompositionResponse, so
+// everything downstream (compiler, brand kits, captions) works unchanged.
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+type TemplateRegistry struct {
+	mu        sync.RWMutex
+	templates map[string]models.CompositionTemplate
+}
+
+// NewTemplateRegistry loads the built-in templates and any custom ones from <DataDir>/templates/*.json
+func NewTemplateRegistry(cfg *config.APIConfig) (*TemplateRegistry, error) {
+	tr := &TemplateRegistry{templates: map[string]models.CompositionTemplate{}}
+	for _, t := range builtinTemplates() {
+		if err := validateTemplate(t); err != nil {
+			return nil, fmt.Errorf("invalid built-in template %s: %v", t.ID, err)
+		}
+		tr.templates[t.ID] = t
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cfg.DataDir, "templates", "*.json"))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %v", f, err)
+		}
+		var t models.CompositionTemplate
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, fmt.Errorf("invalid template %s: %v", f, err)
+		}
+		if t.ID == "" {
+			t.ID = strings.TrimSuffix(filepath.Base(f), ".json")
+		}
+		if err := validateTemplate(t); err != nil {
+			return nil, fmt.Errorf("invalid template %s: %v", f, err)
+		}
+		tr.templates[t.ID] = t
+	}
+	return tr, nil
+}
+
+func (tr *TemplateRegistry) List() []models.CompositionTemplate {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	out := make([]models.CompositionTemplate, 0, len(tr.templates))
+	for _, t := range tr.templates {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (tr *TemplateRegistry) Get(id string) (models.CompositionTemplate, error) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	t, ok := tr.templates[id]
+	if !ok {
+		return models.CompositionTemplate{}, ErrTemplateNotFound
+	}
+	return t, nil
+}
+
+// Fill builds a composition from the template. texts maps slot names to client text;
+// ai (optional) is an AI-generated composition whose text segments fill slots the client left empty,
+// matched by narrativeSource first and then by order.
+func (tr *TemplateRegistry) Fill(t models.CompositionTemplate, imageCount int, texts map[string]string, ai *models.VideoCompositionResponse) (*models.VideoCompositionResponse, error) {
+	if imageCount <= 0 {
+		return nil, fmt.Errorf("template %s needs at least one image", t.ID)
+	}
+
+	var vc models.VideoCompositionResponse
+	vc.Metadata = models.Metadata{
+		Resolution:  append([]int(nil), t.Resolution...),
+		AspectRatio: t.AspectRatio,
+		Fps:         t.Fps,
+	}
+	vc.Theme.Style, vc.Theme.Mood, vc.Theme.Grading = t.Theme.Style, t.Theme.Mood, t.Theme.Grading
+
+	start := 0
+	for i, seg := range t.Segments {
+		vc.Timeline.ImageTimeline.ImageSegments = append(vc.Timeline.ImageTimeline.ImageSegments, models.ImageSegment{
+			Ordering:   i,
+			ImageIndex: i % imageCount,
+			StartTime:  start,
+			Duration:   seg.Duration,
+			Transition: seg.Transition,
+		})
+		start += seg.Duration
+	}
+	vc.Metadata.TotalDuration = start
+	vc.Timeline.TotalDuration = start
+
+	aiTexts := aiSlotTexts(t, ai)
+	vc.Timeline.TextTimeline.TextStyle = t.TextStyle
+	for i, slot := range t.TextSlots {
+		text := strings.TrimSpace(texts[slot.Slot])
+		if text == "" {
+			text = aiTexts[slot.Slot]
+		}
+		if text == "" {
+			text = slot.Default
+		}
+		if text == "" {
+			if slot.Required {
+				return nil, fmt.Errorf("template %s: text slot %q is required", t.ID, slot.Slot)
+			}
+			continue
+		}
+		if max := slot.MaxLength; max > 0 && len([]rune(text)) > max {
+			text = strings.TrimSpace(string([]rune(text)[:max]))
+		}
+		vc.Timeline.TextTimeline.TextSegments = append(vc.Timeline.TextTimeline.TextSegments, models.TextSegment{
+			ID:              i,
+			Text:            text,
+			StartTime:       slot.StartTime,
+			Duration:        slot.Duration,
+			Position:        slot.Position,
+			NarrativeSource: slot.Slot,
+		})
+	}
+
+	vc.Audio.Music.Enabled = t.Music.Enabled
+	vc.Audio.Music.Genre = t.Music.Genre
+	vc.Audio.Music.Mood = t.Music.Mood
+	vc.Audio.Music.Volume = t.Music.Volume
+	if ai != nil {
+		vc.Audio.Narration.Voice = ai.Audio.Narration.Voice
+	} else {
+		vc.Audio.Narration.Voice = models.TTSVoice{Emphasis: "normal", Speed: 1.0, Pitch: 1.0, Stability: 0.75}
+	}
+	return &vc, nil
+}
+
+// aiSlotTexts maps template slots to AI text: exact narrativeSource matches win,
+// remaining slots take the remaining AI segments in timeline order.
+func aiSlotTexts(t models.CompositionTemplate, ai *models.VideoCompositionResponse) map[string]string {
+	out := map[string]string{}
+	if ai == nil {
+		return out
+	}
+	segs := make([]models.TextSegment, len(ai.Timeline.TextTimeline.TextSegments))
+	copy(segs, ai.Timeline.TextTimeline.TextSegments)
+	sort.SliceStable(segs, func(i, j int) bool { return segs[i].StartTime < segs[j].StartTime })
+
+	used := make([]bool, len(segs))
+	for _, slot := range t.TextSlots {
+		for i, s := range segs {
+			if !used[i] && s.NarrativeSource == slot.Slot && strings.TrimSpace(s.Text) != "" {
+				out[slot.Slot], used[i] = s.Text, true
+				break
+			}
+		}
+	}
+	next := 0
+	for _, slot := range t.TextSlots {
+		if _, ok := out[slot.Slot]; ok {
+			continue
+		}
+		for next < len(segs) && (used[next] || strings.TrimSpace(segs[next].Text) == "") {
+			next++
+		}
+		if next == len(segs) {
+			break
+		}
+		out[slot.Slot], used[next] = segs[next].Text, true
+	}
+	return out
+}
+
+func validateTemplate(t models.CompositionTemplate) error {
+	if len(t.Resolution) != 2 || t.Resolution[0] <= 0 || t.Resolution[1] <= 0 {
+		return fmt.Errorf("resolution must be [width, height]")
+	}
+	if len(t.Segments) == 0 {
+		return fmt.Errorf("at least one segment is required")
+	}
+	total := 0
+	for i, s := range t.Segments {
+		if s.Duration <= 0 {
+			return fmt.Errorf("segment %d: duration must be > 0", i)
+		}
+		total += s.Duration
+	}
+	seen := map[string]bool{}
+	for _, slot := range t.TextSlots {
+		if slot.Slot == "" || seen[slot.Slot] {
+			return fmt.Errorf("text slot names must be unique and non-empty")
+		}
+		seen[slot.Slot] = true
+		if slot.Duration <= 0 || slot.StartTime < 0 || slot.StartTime+slot.Duration > total {
+			return fmt.Errorf("text slot %q must fit inside the %ds timeline", slot.Slot, total)
+		}
+	}
+	return nil
+}
+
+func builtinTemplates() []models.CompositionTemplate {
+	fade := models.TransitionTimelineItem{Effect: "fade", Easing: "ease-in-out"}
+	zoom := models.TransitionTimelineItem{Effect: "zoom", Easing: "ease-in-out"}
+	cut := models.TransitionTimelineItem{Effect: "cut", Easing: "linear"}
+
+	var product models.CompositionTemplate
+	product.ID = "product-showcase-5"
+	product.Name = "Product showcase (5 images)"
+	product.Description = "Punchy hook, three feature beats and a call to action over five product shots."
+	product.AspectRatio, product.Resolution, product.Fps = "9:16", []int{1080, 1920}, "30"
+	product.Theme.Style, product.Theme.Mood, product.Theme.Grading = "energetic", "exciting", "vibrant"
+	product.TextStyle = models.TextStyle{FontFamily: "Montserrat", TextStyle: "bold"}
+	product.Segments = []models.TemplateSegment{
+		{Duration: 2, Transition: zoom}, {Duration: 2, Transition: cut}, {Duration: 2, Transition: cut},
+		{Duration: 2, Transition: cut}, {Duration: 3, Transition: fade},
+	}
+	product.TextSlots = []models.TemplateTextSlot{
+		{Slot: "hook", StartTime: 0, Duration: 2, Position: "center", MaxLength: 40, Required: true},
+		{Slot: "story[0]", StartTime: 2, Duration: 2, Position: "center", MaxLength: 60},
+		{Slot: "story[1]", StartTime: 4, Duration: 2, Position: "center", MaxLength: 60},
+		{Slot: "story[2]", StartTime: 6, Duration: 2, Position: "center", MaxLength: 60},
+		{Slot: "cta", StartTime: 8, Duration: 3, Position: "center", MaxLength: 40, Default: "Shop now"},
+	}
+	product.Music.Enabled, product.Music.Genre, product.Music.Mood, product.Music.Volume = true, "upbeat", "energetic", 0.3
+
+	var realEstate models.CompositionTemplate
+	realEstate.ID = "real-estate-tour"
+	realEstate.Name = "Real estate tour"
+	realEstate.Description = "Slow Ken Burns walk-through: exterior, living spaces, details and contact card."
+	realEstate.AspectRatio, realEstate.Resolution, realEstate.Fps = "9:16", []int{1080, 1920}, "30"
+	realEstate.Theme.Style, realEstate.Theme.Mood, realEstate.Theme.Grading = "luxury", "sophisticated", "warm"
+	realEstate.TextStyle = models.TextStyle{FontFamily: "Playfair Display", TextStyle: "regular"}
+	realEstate.Segments = []models.TemplateSegment{
+		{Duration: 3, Transition: zoom}, {Duration: 3, Transition: zoom}, {Duration: 3, Transition: zoom},
+		{Duration: 3, Transition: zoom}, {Duration: 3, Transition: fade},
+	}
+	realEstate.TextSlots = []models.TemplateTextSlot{
+		{Slot: "hook", StartTime: 0, Duration: 3, Position: "center", MaxLength: 50, Required: true},
+		{Slot: "story[0]", StartTime: 3, Duration: 3, Position: "center-left", MaxLength: 60},
+		{Slot: "story[1]", StartTime: 6, Duration: 3, Position: "center-right", MaxLength: 60},
+		{Slot: "story[2]", StartTime: 9, Duration: 3, Position: "center-left", MaxLength: 60},
+		{Slot: "cta", StartTime: 12, Duration: 3, Position: "center", MaxLength: 50, Default: "Book a viewing"},
+	}
+	realEstate.Music.Enabled, realEstate.Music.Genre, realEstate.Music.Mood, realEstate.Music.Volume = true, "ambient", "peaceful", 0.25
+
+	var square models.CompositionTemplate
+	square.ID = "quick-promo-square"
+	square.Name = "Quick promo (square, 3 images)"
+	square.Description = "Short 1:1 promo for feeds: hook, one benefit, call to action."
+	square.AspectRatio, square.Resolution, square.Fps = "1:1", []int{1080, 1080}, "30"
+	square.Theme.Style, square.Theme.Mood, square.Theme.Grading = "modern", "friendly", "soft"
+	square.TextStyle = models.TextStyle{FontFamily: "Inter", TextStyle: "bold"}
+	square.Segments = []models.TemplateSegment{{Duration: 3, Transition: fade}, {Duration: 3, Transition: fade}, {Duration: 3, Transition: fade}}
+	square.TextSlots = []models.TemplateTextSlot{
+		{Slot: "hook", StartTime: 0, Duration: 3, Position: "center", MaxLength: 40, Required: true},
+		{Slot: "story[0]", StartTime: 3, Duration: 3, Position: "center", MaxLength: 60},
+		{Slot: "cta", StartTime: 6, Duration: 3, Position: "center", MaxLength: 40, Default: "Learn more"},
+	}
+	square.Music.Enabled, square.Music.Genre, square.Music.Mood, square.Music.Volume = true, "corporate", "professional", 0.3
+
+	return []models.CompositionTemplate{product, realEstate, square}
+}
@@ -1 +1,212 @@
 package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"social-media-ai-video/config"
+	"social-media-ai-video/models"
+)
+
+// TTSCache keeps narration audio on disk keyed by everything that shapes the speech (text,
+// voice, model and voice settings), so re-rendering a composition does not bill the TTS
+// provider again. An entry is <key>.mp3 plus, when it was fetched with word timings,
+// <key>.json; a plain request can reuse a timed entry but not the other way round. Hits
+// refresh an entry's mtime, which is what size-based eviction orders by.
+type TTSCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+// NewTTSCache returns nil (no caching) when TTS_CACHE_MAX_BYTES is 0
+func NewTTSCache(cfg *config.APIConfig) *TTSCache {
+	if cfg.TTSCacheMaxBytes <= 0 {
+		return nil
+	}
+	return &TTSCache{dir: cfg.TTSCacheDir, ttl: cfg.TTSCacheTTL, maxBytes: cfg.TTSCacheMaxBytes}
+}
+
+// TTSCacheKey hashes the voice and the request body (text, model, voice settings)
+func TTSCacheKey(voiceID string, req TTSRequest) string {
+	// encoding/json sorts map keys, so equal settings always hash the same
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(append([]byte(voiceID+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get copies a cached clip into destDir under a fresh name and returns its path. With
+// needWords only entries that carry word timings match.
+func (c *TTSCache) Get(key, destDir string, needWords bool) (string, []models.WordTiming, bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	audio := filepath.Join(c.dir, key+".mp3")
+	info, err := os.Stat(audio)
+	if err != nil {
+		return "", nil, false
+	}
+	if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+		c.removeLocked(key)
+		return "", nil, false
+	}
+	var words []models.WordTiming
+	if data, err := os.ReadFile(filepath.Join(c.dir, key+".json")); err == nil {
+		if err := json.Unmarshal(data, &words); err != nil {
+			return "", nil, false
+		}
+	} else if needWords {
+		return "", nil, false
+	}
+
+	out := filepath.Join(destDir, fmt.Sprintf("audio_%s_%d.mp3", key[:16], time.Now().UnixNano()))
+	if err := linkOrCopy(audio, out); err != nil {
+		log.Printf("tts cache: %v", err)
+		return "", nil, false
+	}
+	now := time.Now()
+	os.Chtimes(audio, now, now)
+	return out, words, true
+}
+
+// Put stores a freshly generated clip (and its word timings, if any), then evicts to stay within limits
+func (c *TTSCache) Put(key, audioPath string, words []models.WordTiming) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.putLocked(key, audioPath, words); err != nil {
+		log.Printf("tts cache: %v", err)
+		c.removeLocked(key)
+		return
+	}
+	c.pruneLocked()
+}
+
+func (c *TTSCache) putLocked(key, audioPath string, words []models.WordTiming) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %v", err)
+	}
+	if words != nil {
+		data, err := json.Marshal(words)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(c.dir, key+".json"), data); err != nil {
+			return err
+		}
+	}
+	src, err := os.ReadFile(audioPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", audioPath, err)
+	}
+	return writeFileAtomic(filepath.Join(c.dir, key+".mp3"), src)
+}
+
+// pruneLocked drops expired entries, then the least recently used ones above maxBytes
+func (c *TTSCache) pruneLocked() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	type entry struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var live []entry
+	var total int64
+	sizes := map[string]int64{}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && strings.HasSuffix(e.Name(), ".json") {
+			sizes[strings.TrimSuffix(e.Name(), ".json")] += info.Size()
+		}
+	}
+	for _, e := range entries {
+		key, ok := strings.CutSuffix(e.Name(), ".mp3")
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+			c.removeLocked(key)
+			continue
+		}
+		size := info.Size() + sizes[key]
+		live = append(live, entry{key: key, size: size, modTime: info.ModTime()})
+		total += size
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].modTime.Before(live[j].modTime) })
+	for _, e := range live {
+		if total <= c.maxBytes {
+			break
+		}
+		c.removeLocked(e.key)
+		total -= e.size
+	}
+}
+
+func (c *TTSCache) removeLocked(key string) {
+	os.Remove(filepath.Join(c.dir, key+".mp3"))
+	os.Remove(filepath.Join(c.dir, key+".json"))
+}
+
+// writeFileAtomic writes through a temp file so readers never see partial entries
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp_*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// linkOrCopy hard-links src to dst, copying when they are on different filesystems
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	models "social-media-ai-video/models"
+)
+
+// A/B variants render one generated composition several times, each copy differing only in the
+// requested dimensions so the results can be compared. Variant 0 is the composition as generated;
+// the others take the remaining schema values of each dimension in turn. New hooks are written by
+// the caller (the generator is asked again) and passed in. A request may not ask for more
+// variants than its dimensions have distinct values (see MaxDistinctVariants).
+//
+// Music is varied by genre and mood, which pick the track (see SelectMusicHelper); pairs that
+// would select the track another variant already plays are skipped.
+
+// MaxVariants bounds the variants of one request
+const MaxVariants = 6
+
+var (
+	variantGradings    = []string{"warm", "cool", "vibrant", "muted", "high-contrast", "soft"}
+	variantTransitions = []string{"fade", "dissolve", "slide", "zoom", "cut"}
+	// genre and mood pairs that go together; each selects a different track
+	variantMusic = [][2]string{
+		{"upbeat", "energetic"},
+		{"ambient", "peaceful"},
+		{"corporate", "professional"},
+		{"uplifting", "motivational"},
+		{"minimal", "creative"},
+	}
+)
+
+// ParseVariantDimensions parses a comma-separated list such as "hook,grading"
+func ParseVariantDimensions(raw string) ([]models.VariantDimension, error) {
+	var out []models.VariantDimension
+	seen := map[models.VariantDimension]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		d := models.VariantDimension(strings.ToLower(strings.TrimSpace(part)))
+		switch d {
+		case "":
+			continue
+		case models.VaryHook, models.VaryMusic, models.VaryTransition, models.VaryGrading:
+		default:
+			return nil, fmt.Errorf("unknown variant dimension %q (expected hook, music, transition or grading)", d)
+		}
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no variant dimension given")
+	}
+	return out, nil
+}
+
+// MaxDistinctVariants is how many variants can differ in vary: every variant gets a hook of its
+// own, while music, transitions and gradings run out after each value is used once
+func MaxDistinctVariants(vary []models.VariantDimension) int {
+	n := 1
+	for _, d := range vary {
+		switch d {
+		case models.VaryHook:
+			n = max(n, MaxVariants)
+		case models.VaryMusic:
+			n = max(n, len(variantMusic))
+		case models.VaryTransition:
+			n = max(n, len(variantTransitions))
+		case models.VaryGrading:
+			n = max(n, len(variantGradings))
+		}
+	}
+	return min(n, MaxVariants)
+}
+
+// HookSegment returns the index of the composition's hook: the "hook" text segment, else the
+// earliest one; -1 without text segments
+func HookSegment(vc *models.VideoCompositionResponse) int {
+	segs := vc.Timeline.TextTimeline.TextSegments
+	hook := -1
+	for i, seg := range segs {
+		if strings.EqualFold(seg.NarrativeSource, "hook") {
+			return i
+		}
+		if hook < 0 || seg.StartTime < segs[hook].StartTime {
+			hook = i
+		}
+	}
+	return hook
+}
+
+// BuildVariants derives n compositions from base, varying the given dimensions. With VaryHook,
+// hooks[k] is the hook text of variant k (hooks[0] is ignored). It returns the compositions and,
+// for each, the values of the varied parameters.
+func BuildVariants(base []byte, n int, vary []models.VariantDimension, hooks []string) ([][]byte, []models.VariantParams, error) {
+	parsed, err := ParseComposition(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n < 1 || n > MaxVariants {
+		return nil, nil, fmt.Errorf("variants must be between 1 and %d", MaxVariants)
+	}
+	if limit := MaxDistinctVariants(vary); n > limit {
+		return nil, nil, fmt.Errorf("varying %s gives at most %d distinct variants", joinDimensions(vary), limit)
+	}
+
+	blobs := make([][]byte, n)
+	params := make([]models.VariantParams, n)
+	for k := 0; k < n; k++ {
+		// a fresh decode per variant so no two share segment slices
+		vc, err := ParseComposition(base)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, d := range vary {
+			if err := applyVariant(vc, parsed, d, k, hooks, &params[k]); err != nil {
+				return nil, nil, err
+			}
+		}
+		if blobs[k], err = json.Marshal(vc); err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal variant %d: %v", k, err)
+		}
+	}
+	return blobs, params, nil
+}
+
+// applyVariant sets dimension d of variant k on vc and records the value in p
+func applyVariant(vc, base *models.VideoCompositionResponse, d models.VariantDimension, k int, hooks []string, p *models.VariantParams) error {
+	switch d {
+	case models.VaryHook:
+		i := HookSegment(vc)
+		if i < 0 {
+			return fmt.Errorf("composition has no text segment to vary the hook of")
+		}
+		if k > 0 {
+			if k >= len(hooks) || strings.TrimSpace(hooks[k]) == "" {
+				return fmt.Errorf("no hook for variant %d", k)
+			}
+			vc.Timeline.TextTimeline.TextSegments[i].Text = strings.TrimSpace(hooks[k])
+		}
+		p.Hook = StripSpeechMarkup(vc.Timeline.TextTimeline.TextSegments[i].Text)
+	case models.VaryMusic:
+		current := [2]string{base.Audio.Music.Genre, base.Audio.Music.Mood}
+		if k > 0 {
+			others := otherMusic(base)
+			current = others[(k-1)%len(others)]
+			vc.Audio.Music.Genre, vc.Audio.Music.Mood = current[0], current[1]
+			// a variant about music should have some
+			vc.Audio.Music.Enabled = true
+			if vc.Audio.Music.Volume <= 0 {
+				vc.Audio.Music.Volume = 0.3
+			}
+		}
+		p.MusicGenre, p.MusicMood = current[0], current[1]
+		if vc.Audio.Music.Enabled {
+			if track, ok := selectTrack(current[0], current[1]); ok {
+				p.MusicTrack = trackTitle(track.file)
+			}
+		}
+	case models.VaryTransition:
+		current := dominantTransition(base)
+		if k > 0 {
+			current = rotateExcluding(variantTransitions, current, k)
+			for i := range vc.Timeline.ImageTimeline.ImageSegments {
+				vc.Timeline.ImageTimeline.ImageSegments[i].Transition.Effect = current
+			}
+		}
+		p.Transition = current
+	case models.VaryGrading:
+		current := base.Theme.Grading
+		if k > 0 {
+			current = rotateExcluding(variantGradings, current, k)
+			vc.Theme.Grading = current
+		}
+		p.Grading = current
+	}
+	return nil
+}
+
+func joinDimensions(vary []models.VariantDimension) string {
+	names := make([]string, len(vary))
+	for i, d := range vary {
+		names[i] = string(d)
+	}
+	return strings.Join(names, ",")
+}
+
+// otherMusic lists the variantMusic pairs whose track differs from base's and from each other's
+func otherMusic(base *models.VideoCompositionResponse) [][2]string {
+	seen := map[string]bool{}
+	if base.Audio.Music.Enabled {
+		if track, ok := selectTrack(base.Audio.Music.Genre, base.Audio.Music.Mood); ok {
+			seen[track.file] = true
+		}
+	}
+	var out [][2]string
+	for _, m := range variantMusic {
+		track, _ := selectTrack(m[0], m[1])
+		if !seen[track.file] {
+			seen[track.file] = true
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// rotateExcluding returns the k-th (from 1) value of values other than current, wrapping around
+func rotateExcluding(values []string, current string, k int) string {
+	var others []string
+	for _, v := range values {
+		if v != current {
+			others = append(others, v)
+		}
+	}
+	return others[(k-1)%len(others)]
+}
+
+// dominantTransition is the most used transition effect of the composition
+func dominantTransition(vc *models.VideoCompositionResponse) string {
+	counts := map[string]int{}
+	for _, seg := range vc.Timeline.ImageTimeline.ImageSegments {
+		counts[seg.Transition.Effect]++
+	}
+	effects := make([]string, 0, len(counts))
+	for e := range counts {
+		effects = append(effects, e)
+	}
+	sort.Slice(effects, func(i, j int) bool {
+		if counts[effects[i]] != counts[effects[j]] {
+			return counts[effects[i]] > counts[effects[j]]
+		}
+		return effects[i] < effects[j]
+	})
+	if len(effects) == 0 {
+		return ""
+	}
+	return effects[0]
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	// webp headers for DecodeConfig
+	_ "golang.org/x/image/webp"
+
+	"social-media-ai-video/config"
+)
+
+// Workspace is a private, per-request directory for uploads and intermediate files.
+// Uploads are stored under content-hash names (never the client filename), are
+// MIME-sniffed and have their pixel dimensions checked before anything decodes
+// them, and the whole directory is removed by Cleanup when the request/job ends.
+
+var (
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	ErrUploadTooLarge   = errors.New("upload too large")
+	ErrImageTooLarge    = errors.New("image dimensions too large")
+)
+
+// uploadExtensions maps accepted sniffed types to the extension used on disk
+var uploadExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/heic": ".heic",
+}
+
+// maxImageHeaderBytes caps header reads when no upload size limit is configured
+const maxImageHeaderBytes = 16 << 20
+
+// heifConvertPath is libheif's decoder, which also assembles tiled (grid) HEIC images.
+// HEIC uploads are rejected when it is not installed.
+const heifConvertPath = "heif-convert"
+
+var heicSupported = sync.OnceValue(func() bool {
+	_, err := exec.LookPath(heifConvertPath)
+	return err == nil
+})
+
+type UploadLimits struct {
+	MaxFileBytes int64
+	MaxPixels    int64
+	MaxDimension int
+}
+
+func UploadLimitsFromConfig(cfg *config.APIConfig) UploadLimits {
+	return UploadLimits{
+		MaxFileBytes: cfg.MaxUploadBytes,
+		MaxPixels:    cfg.MaxImagePixels,
+		MaxDimension: cfg.MaxImageDimension,
+	}
+}
+
+type Workspace struct {
+	Dir    string
+	limits UploadLimits
+	once   sync.Once
+}
+
+// NewWorkspace creates a unique directory under root
+func NewWorkspace(root string, limits UploadLimits) (*Workspace, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace root: %v", err)
+	}
+	dir, err := os.MkdirTemp(root, "ws_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %v", err)
+	}
+	return &Workspace{Dir: dir, limits: limits}, nil
+}
+
+// Path returns a path for an intermediate file inside the workspace
+func (w *Workspace) Path(name string) string {
+	return filepath.Join(w.Dir, filepath.Base(name))
+}
+
+// Cleanup removes the workspace and everything in it; safe to call more than once
+func (w *Workspace) Cleanup() {
+	w.once.Do(func() {
+		if err := os.RemoveAll(w.Dir); err != nil {
+			log.Printf("workspace cleanup %s: %v", w.Dir, err)
+		}
+	})
+}
+
+// Detach hands the directory over to someone else (e.g. a background job); Cleanup becomes a no-op
+func (w *Workspace) Detach() {
+	w.once.Do(func() {})
+}
+
+// SaveUpload validates an uploaded image and stores it as <sha256>.<ext>, returning the local path
+func (w *Workspace) SaveUpload(fh *multipart.FileHeader) (string, error) {
+	if w.limits.MaxFileBytes > 0 && fh.Size > w.limits.MaxFileBytes {
+		return "", fmt.Errorf("%w: %s is %d bytes (max %d)", ErrUploadTooLarge, fh.Filename, fh.Size, w.limits.MaxFileBytes)
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %v", err)
+	}
+	defer src.Close()
+	return w.SaveImage(src, fh.Filename)
+}
+
+// SaveImage validates image bytes from r and stores them under a content-hash name.
+// label is only used in error messages.
+func (w *Workspace) SaveImage(r io.Reader, label string) (string, error) {
+	// header large enough for MIME sniffing and for HEIC's meta box, which holds the image sizes
+	head := make([]byte, 64*1024)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read uploaded file: %v", err)
+	}
+	head = head[:n]
+
+	contentType := sniffImageType(head)
+	ext, ok := uploadExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("%w: %s (%s)", ErrUnsupportedMedia, label, contentType)
+	}
+	if contentType == "image/heic" && !heicSupported() {
+		return "", fmt.Errorf("%w: %s (HEIC decoding is not available)", ErrUnsupportedMedia, label)
+	}
+	// the decoder may read past the sniffed prefix (phones put large EXIF/XMP/ICC segments before
+	// a JPEG's frame header); what it consumes is buffered and replayed into the stored file
+	var consumed bytes.Buffer
+	header := io.MultiReader(bytes.NewReader(head), io.TeeReader(io.LimitReader(r, w.headerLimit()), &consumed))
+	if err := w.checkDimensions(head, header, contentType, label); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(w.Dir, "upload_*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp image file: %v", err)
+	}
+	hasher := sha256.New()
+	body := io.MultiReader(bytes.NewReader(head), &consumed, r)
+	if w.limits.MaxFileBytes > 0 {
+		body = io.LimitReader(body, w.limits.MaxFileBytes+1)
+	}
+	written, err := io.Copy(io.MultiWriter(tmp, hasher), body)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write temp image file: %v", err)
+	}
+	if w.limits.MaxFileBytes > 0 && written > w.limits.MaxFileBytes {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("%w: %s exceeds %d bytes", ErrUploadTooLarge, label, w.limits.MaxFileBytes)
+	}
+
+	final := filepath.Join(w.Dir, hex.EncodeToString(hasher.Sum(nil))[:32]+ext)
+	if err := os.Rename(tmp.Name(), final); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to store image file: %v", err)
+	}
+	return final, nil
+}
+
+// headerLimit bounds how much a decoder may read while looking for the image dimensions
+func (w *Workspace) headerLimit() int64 {
+	if w.limits.MaxFileBytes > 0 {
+		return w.limits.MaxFileBytes
+	}
+	return maxImageHeaderBytes
+}
+
+// checkDimensions rejects decompression bombs using only the image header. head is the sniffed
+// prefix; header reads the whole header, continuing past head when needed.
+func (w *Workspace) checkDimensions(head []byte, header io.Reader, contentType, label string) error {
+	var width, height int
+	if contentType == "image/heic" {
+		width, height = heicDimensions(head)
+	} else {
+		cfg, _, err := image.DecodeConfig(header)
+		if err != nil {
+			return fmt.Errorf("%w: %s: unreadable image header: %v", ErrUnsupportedMedia, label, err)
+		}
+		width, height = cfg.Width, cfg.Height
+	}
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: %s: could not determine image dimensions", ErrUnsupportedMedia, label)
+	}
+	if w.limits.MaxDimension > 0 && (width > w.limits.MaxDimension || height > w.limits.MaxDimension) {
+		return fmt.Errorf("%w: %s is %dx%d (max side %d)", ErrImageTooLarge, label, width, height, w.limits.MaxDimension)
+	}
+	if w.limits.MaxPixels > 0 && int64(width)*int64(height) > w.limits.MaxPixels {
+		return fmt.Errorf("%w: %s is %dx%d (max %d pixels)", ErrImageTooLarge, label, width, height, w.limits.MaxPixels)
+	}
+	return nil
+}
+
+// sniffImageType extends http.DetectContentType with HEIC/HEIF, which it does not know
+func sniffImageType(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return "image/heic"
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// heicDimensions returns the size of the primary image: pitm names the primary item and ipma
+// links it to its properties in ipco, one of which is its ispe (image spatial extents). Tiled
+// (grid) images have an ispe per tile as well, so the first ispe in the file is often just a
+// tile's. Returns zeros when the boxes are not all within the sniffed prefix.
+func heicDimensions(head []byte) (int, int) {
+	meta := findBox(isoBoxes(head), "meta")
+	// meta is a full box: version and flags come first
+	if len(meta) < 4 {
+		return 0, 0
+	}
+	children := isoBoxes(meta[4:])
+	pitm := findBox(children, "pitm")
+	var primary uint32
+	switch {
+	case len(pitm) >= 6 && pitm[0] == 0:
+		primary = uint32(binary.BigEndian.Uint16(pitm[4:6]))
+	case len(pitm) >= 8:
+		primary = binary.BigEndian.Uint32(pitm[4:8])
+	default:
+		return 0, 0
+	}
+	iprp := isoBoxes(findBox(children, "iprp"))
+	props := isoBoxes(findBox(iprp, "ipco"))
+	for _, ipma := range iprp {
+		if ipma.typ != "ipma" {
+			continue
+		}
+		for _, idx := range itemProperties(ipma.payload, primary) {
+			if idx == 0 || idx > len(props) || props[idx-1].typ != "ispe" {
+				continue
+			}
+			// version and flags, then width and height as uint32
+			ispe := props[idx-1].payload
+			if len(ispe) < 12 {
+				return 0, 0
+			}
+			return int(binary.BigEndian.Uint32(ispe[4:8])), int(binary.BigEndian.Uint32(ispe[8:12]))
+		}
+	}
+	return 0, 0
+}
+
+// isoBox is an ISO BMFF (HEIF) box: its four-character type and its content
+type isoBox struct {
+	typ     string
+	payload []byte
+}
+
+// isoBoxes splits data into boxes, stopping at the first one that does not fit
+func isoBoxes(data []byte) []isoBox {
+	var out []isoBox
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		typ, hdr := string(data[4:8]), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return out
+			}
+			size, hdr = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < hdr || size > uint64(len(data)) {
+			return out
+		}
+		out = append(out, isoBox{typ: typ, payload: data[hdr:size]})
+		data = data[size:]
+	}
+	return out
+}
+
+func findBox(boxes []isoBox, typ string) []byte {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.payload
+		}
+	}
+	return nil
+}
+
+// itemProperties returns the 1-based ipco indexes ipma associates with item
+func itemProperties(ipma []byte, item uint32) []int {
+	if len(ipma) < 8 {
+		return nil
+	}
+	version, wideIndex := ipma[0], ipma[3]&1 == 1
+	count := binary.BigEndian.Uint32(ipma[4:8])
+	data := ipma[8:]
+	for ; count > 0; count-- {
+		var id uint32
+		if version < 1 {
+			if len(data) < 3 {
+				return nil
+			}
+			id, data = uint32(binary.BigEndian.Uint16(data)), data[2:]
+		} else {
+			if len(data) < 5 {
+				return nil
+			}
+			id, data = binary.BigEndian.Uint32(data), data[4:]
+		}
+		n := int(data[0])
+		data = data[1:]
+		var indexes []int
+		for ; n > 0; n-- {
+			// the top bit marks the property as essential
+			if wideIndex {
+				if len(data) < 2 {
+					return nil
+				}
+				indexes, data = append(indexes, int(binary.BigEndian.Uint16(data)&0x7fff)), data[2:]
+			} else {
+				if len(data) < 1 {
+					return nil
+				}
+				indexes, data = append(indexes, int(data[0]&0x7f)), data[1:]
+			}
+		}
+		if id == item {
+			return indexes
+		}
+	}
+	return nil
+}